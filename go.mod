@@ -7,4 +7,4 @@ require (
 	golang.org/x/exp v0.0.0-20220713135740-79cabaa25d75
 )
 
-require github.com/davecgh/go-spew v1.1.1 // indirect
+require github.com/davecgh/go-spew v1.1.1
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"io"
+	"os"
+)
+
+// runDump prints the tokens the parser reads and the syntax tree of a
+// template, to debug the parser and the extensions.
+func runDump(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	jsonTree := flags.Bool("json", false, "print the syntax tree as JSON, with the line numbers")
+	noTokens := flags.Bool("no-tokens", false, "don't print the tokens")
+	noTree := flags.Bool("no-ast", false, "don't print the syntax tree")
+	lineStatementPrefix := flags.String("line-statement-prefix", "", "`prefix` of the line statements")
+	lineCommentPrefix := flags.String("line-comment-prefix", "", "`prefix` of the line comments")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a single template")
+	}
+	file := flags.Arg(0)
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	opts := environment.DefaultEnvOpts()
+	opts.LineStatementPrefix = optionalString(*lineStatementPrefix)
+	opts.LineCommentPrefix = optionalString(*lineCommentPrefix)
+	opts.Extensions = allExtensions
+	env, err := environment.New(opts)
+	if err != nil {
+		return err
+	}
+
+	if !*noTokens {
+		stream, err := env.Tokenize(string(source), nil, &file, nil)
+		if err != nil {
+			return err
+		}
+		for token := stream.Next(); token.Type != lexer.TokenEOF; token = stream.Next() {
+			if _, err = fmt.Fprintf(stdout, "%s\t%s\t%#v\n", token.Span.Start, token.Type, token.Value); err != nil {
+				return err
+			}
+		}
+	}
+	if *noTree {
+		return nil
+	}
+	template, err := env.Parse(string(source), nil, &file)
+	if err != nil {
+		return err
+	}
+	var tree []byte
+	if *jsonTree {
+		if tree, err = nodes.DumpJSON(template); err != nil {
+			return err
+		}
+	} else {
+		tree = []byte(nodes.Dump(template))
+	}
+	if !*noTokens {
+		if _, err = fmt.Fprintln(stdout); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(stdout, "%s\n", tree)
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.html")
+	if err := os.WriteFile(path, []byte("{% for x in y %}\n{{ x }}{% break %}{% endfor %}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runDump([]string{path}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"1:1\tblock_begin\t\"{%\"\n1:4\tname\t\"for\"\n",
+		"2:4\tname\t\"x\"\n",
+		"\nTemplate(\n  body=[\n    For(\n      target=Name(name='x', ctx='store'),",
+		"Break()",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := runDump([]string{"-json", "-no-tokens", path}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "{\n  \"type\": \"Template\",") || !strings.Contains(out.String(), `"lineno": 2`) {
+		t.Fatal("unexpected JSON dump", out.String())
+	}
+
+	if err := runDump([]string{path, path}, &out); err == nil {
+		t.Fatal("expected an error for several templates")
+	}
+}
+
+func TestDumpLineStatements(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.j2")
+	if err := os.WriteFile(path, []byte("% for x in y\n{{ x }} ## comment\n% endfor\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := runDump([]string{"-line-statement-prefix", "%", "-line-comment-prefix", "##", "-no-tokens", path}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "Template(\n  body=[\n    For(") {
+		t.Fatal("unexpected dump", out.String())
+	}
+}
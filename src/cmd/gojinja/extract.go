@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions/i18n"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stringsFlag is a flag that can be repeated.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// runExtract extracts the messages of the templates given as arguments (or
+// found in the directories given as arguments) and writes a .pot file.
+func runExtract(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("extract", flag.ContinueOnError)
+	output := flags.String("o", "", "write the catalog to `file` instead of the standard output")
+	project := flags.String("project", "", "project name written in the header")
+	version := flags.String("version", "", "project version written in the header")
+	bugsAddress := flags.String("msgid-bugs-address", "", "address to report message bugs to")
+	trimBlocks := flags.Bool("trim-blocks", false, "read templates rendered with trim_blocks")
+	lstripBlocks := flags.Bool("lstrip-blocks", false, "read templates rendered with lstrip_blocks")
+	lineStatementPrefix := flags.String("line-statement-prefix", "", "`prefix` of the line statements")
+	lineCommentPrefix := flags.String("line-comment-prefix", "", "`prefix` of the line comments")
+	exts := flags.String("ext", ".html,.htm,.xml,.txt,.j2,.jinja,.jinja2", "comma separated `extensions` of the templates searched in directories")
+	var keywords, commentTags stringsFlag
+	flags.Var(&keywords, "k", "additional `function` to extract messages from, like gettext")
+	flags.Var(&commentTags, "c", "`prefix` of the comments extracted for translators (default \"Translators:\")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("no templates given")
+	}
+
+	opts := environment.DefaultEnvOpts()
+	opts.TrimBlocks = *trimBlocks
+	opts.LStripBlocks = *lstripBlocks
+	opts.LineStatementPrefix = optionalString(*lineStatementPrefix)
+	opts.LineCommentPrefix = optionalString(*lineCommentPrefix)
+	opts.Extensions = allExtensions
+	env, err := environment.New(opts)
+	if err != nil {
+		return err
+	}
+
+	extractOpts := i18n.ExtractOptions{Keywords: i18n.DefaultKeywords}
+	if len(keywords) > 0 {
+		extractOpts.Keywords = make(map[string]i18n.Keyword)
+		for k, v := range i18n.DefaultKeywords {
+			extractOpts.Keywords[k] = v
+		}
+		for _, k := range keywords {
+			extractOpts.Keywords[k] = i18n.Keyword{Context: -1, ID: 0, Plural: -1}
+		}
+	}
+	if len(commentTags) > 0 {
+		extractOpts.CommentTags = commentTags
+	}
+
+	files, err := templateFiles(flags.Args(), strings.Split(*exts, ","))
+	if err != nil {
+		return err
+	}
+	var messages []i18n.Message
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		found, err := i18n.Extract(env, string(source), filepath.ToSlash(file), extractOpts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		messages = append(messages, found...)
+	}
+
+	potOpts := i18n.POTOptions{
+		Project:          *project,
+		Version:          *version,
+		MsgidBugsAddress: *bugsAddress,
+	}
+	if *output == "" {
+		return i18n.WritePOT(stdout, i18n.MergeMessages(messages), potOpts)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = i18n.WritePOT(f, i18n.MergeMessages(messages), potOpts); err != nil {
+		_ = f.Close()
+		return err
+	}
+	// the catalog may be truncated if closing fails
+	return f.Close()
+}
+
+// templateFiles returns the files among paths and the templates with one of
+// the extensions in the directories among paths, sorted so the output
+// doesn't depend on the file system.
+func templateFiles(paths []string, exts []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			for _, ext := range exts {
+				if ext != "" && strings.HasSuffix(path, ext) {
+					files = append(files, path)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
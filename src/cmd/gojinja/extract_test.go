@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":       `{{ _("Home") }}`,
+		"shop/cart.j2":     `{% trans %}Cart{% endtrans %} {{ label("Total") }}`,
+		"shop/notes.md":    `{{ _("Not a template") }}`,
+		"shop/product.htm": `{{ _("Home") }}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := runExtract([]string{"-project", "shop", "-k", "label", dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	pot := strings.ReplaceAll(out.String(), filepath.ToSlash(dir)+"/", "")
+	for _, expected := range []string{
+		"#: index.html:1 shop/product.htm:1\nmsgid \"Home\"",
+		"#: shop/cart.j2:1\nmsgid \"Cart\"",
+		"#: shop/cart.j2:1\nmsgid \"Total\"",
+	} {
+		if !strings.Contains(pot, expected) {
+			t.Fatal("expected", expected, "in", pot)
+		}
+	}
+	if strings.Contains(pot, "Not a template") {
+		t.Fatal("only templates should be extracted")
+	}
+
+	output := filepath.Join(dir, "messages.pot")
+	if err := runExtract([]string{"-o", output, filepath.Join(dir, "index.html")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(output); err != nil || !strings.Contains(string(data), `msgid "Home"`) {
+		t.Fatal("expected the catalog in the output file", err)
+	}
+
+	if err := runExtract([]string{filepath.Join(dir, "missing.html")}, &out); err == nil {
+		t.Fatal("expected an error for a missing template")
+	}
+}
+
+func TestExtractExtensions(t *testing.T) {
+	// the templates of the other commands are read, with their tags and
+	// their lexer settings
+	path := filepath.Join(t.TempDir(), "loop.html")
+	source := `{% for x in y %}{% if x %}{% break %}{% endif %}{% do x.append(_("Loop")) %}{% endfor %}
+# set title = _("Title")
+{% debug %}{{ _("Hi") }}`
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := runExtract([]string{"-line-statement-prefix", "#", "-trim-blocks", path}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`msgid "Loop"`, `msgid "Title"`, `msgid "Hi"`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatal("expected", expected, "in", out.String())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/formatter"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// runFmt formats the templates given as arguments (or found in the
+// directories given as arguments), or the standard input if there are none.
+func runFmt(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result to the templates instead of the standard output")
+	list := flags.Bool("l", false, "list the templates whose formatting differs")
+	indent := flags.String("indent", "", "`string` indenting the nested tags where the whitespace is stripped")
+	quote := flags.String("quote", `"`, "quote of the string literals, \" or '")
+	trimBlocks := flags.Bool("trim-blocks", false, "format templates rendered with trim_blocks")
+	lstripBlocks := flags.Bool("lstrip-blocks", false, "format templates rendered with lstrip_blocks")
+	lineStatementPrefix := flags.String("line-statement-prefix", "", "`prefix` of the line statements")
+	lineCommentPrefix := flags.String("line-comment-prefix", "", "`prefix` of the line comments")
+	exts := flags.String("ext", ".html,.htm,.xml,.txt,.j2,.jinja,.jinja2", "comma separated `extensions` of the templates searched in directories")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	q, size := utf8.DecodeRuneInString(*quote)
+	if size != len(*quote) {
+		return fmt.Errorf("invalid quote %q", *quote)
+	}
+
+	opts := environment.DefaultEnvOpts()
+	opts.TrimBlocks = *trimBlocks
+	opts.LStripBlocks = *lstripBlocks
+	opts.LineStatementPrefix = optionalString(*lineStatementPrefix)
+	opts.LineCommentPrefix = optionalString(*lineCommentPrefix)
+	opts.Extensions = allExtensions
+	env, err := environment.New(opts)
+	if err != nil {
+		return err
+	}
+	fmtOpts := formatter.Options{Quote: q, Indent: *indent}
+
+	if flags.NArg() == 0 {
+		if *write {
+			return fmt.Errorf("can't write the standard input")
+		}
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		formatted, err := formatter.Format(env, string(source), fmtOpts)
+		if err != nil {
+			return err
+		}
+		if *list {
+			if formatted != string(source) {
+				_, err = fmt.Fprintln(stdout, "<standard input>")
+			}
+			return err
+		}
+		_, err = io.WriteString(stdout, formatted)
+		return err
+	}
+
+	files, err := templateFiles(flags.Args(), strings.Split(*exts, ","))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		formatted, err := formatter.Format(env, string(source), fmtOpts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		changed := !bytes.Equal(source, []byte(formatted))
+		if *list && changed {
+			if _, err = fmt.Fprintln(stdout, file); err != nil {
+				return err
+			}
+		}
+		if *write {
+			if changed {
+				if err = os.WriteFile(file, []byte(formatted), 0o644); err != nil {
+					return err
+				}
+			}
+		} else if !*list {
+			if _, err = io.WriteString(stdout, formatted); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFmt(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":   "{% if a %}\n{%set x=y|upper%}\n{% endif %}\n",
+		"done.html":    "{% if a %}\n  {% set x = y|upper %}\n{% endif %}\n",
+		"layout.jinja": "{% for  x in y %}{{ x }}{% endfor %}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := runFmt([]string{"-lstrip-blocks", "-indent", "  ", filepath.Join(dir, "index.html")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if expected := files["done.html"]; out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := runFmt([]string{"-l", "-lstrip-blocks", "-indent", "  ", dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Join(dir, "index.html") + "\n" + filepath.Join(dir, "layout.jinja") + "\n"
+	if out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+
+	layout := filepath.Join(dir, "layout.jinja")
+	if err := runFmt([]string{"-w", layout}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(layout); err != nil || string(data) != "{% for x in y %}{{ x }}{% endfor %}" {
+		t.Fatal("expected the formatted template to be written", string(data), err)
+	}
+
+	if err := runFmt([]string{"-quote", "ab", layout}, &out); err == nil {
+		t.Fatal("expected an error for the quote")
+	}
+}
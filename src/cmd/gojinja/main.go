@@ -0,0 +1,81 @@
+// Command gojinja provides tools working on templates.
+//
+// Usage:
+//
+//	gojinja <command> [arguments]
+//
+// The commands are:
+//
+//	extract    extract the translatable messages of templates into a .pot file
+//	fmt        format templates
+//	dump       print the tokens and the syntax tree of a template
+package main
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/extensions/debug"
+	"github.com/gojinja/gojinja/src/extensions/do"
+	"github.com/gojinja/gojinja/src/extensions/i18n"
+	"github.com/gojinja/gojinja/src/extensions/loopcontrols"
+	"io"
+	"os"
+)
+
+type command struct {
+	name  string
+	short string
+	run   func(args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"extract", "extract the translatable messages of templates into a .pot file", runExtract},
+	{"fmt", "format templates", runFmt},
+	{"dump", "print the tokens and the syntax tree of a template", runDump},
+}
+
+// allExtensions are the extensions of the commands reading any template, so
+// their tags parse.
+var allExtensions = map[string]func(*environment.Environment) extensions.IExtension{
+	"debug":        debug.New,
+	"do":           do.New,
+	"i18n":         i18n.New,
+	"loopcontrols": loopcontrols.New,
+}
+
+// optionalString returns nil for an empty flag, like the line prefixes of
+// the environment options.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func usage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "Usage: gojinja <command> [arguments]")
+	_, _ = fmt.Fprintln(w, "\nThe commands are:")
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "\t%-10s %s\n", c.name, c.short)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:], os.Stdout); err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "gojinja "+c.name+":", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "gojinja: unknown command %q\n", os.Args[1])
+	usage(os.Stderr)
+	os.Exit(2)
+}
@@ -1,5 +1,7 @@
 package defaults
 
+import "github.com/gojinja/gojinja/src/runtime"
+
 const BlockStartString = "{%"
 const BlockEndString = "%}"
 const VariableStartString = "{{"
@@ -16,6 +18,8 @@ var LineCommentPrefix *string = nil
 
 var DefaultNamespace = map[string]any{
 	// TODO fill
+	"range":     runtime.Limits{}.Range,
+	"namespace": runtime.NamespaceClass{},
 }
 var DefaultPolicies = map[string]any{
 	"compiler.ascii_str":   true,
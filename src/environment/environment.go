@@ -3,15 +3,19 @@ package environment
 import (
 	"fmt"
 	"github.com/gojinja/gojinja/src/defaults"
+	"github.com/gojinja/gojinja/src/errors"
 	"github.com/gojinja/gojinja/src/extensions"
 	"github.com/gojinja/gojinja/src/filters"
 	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/operator"
+	"github.com/gojinja/gojinja/src/optimizer"
+	"github.com/gojinja/gojinja/src/parser"
 	"github.com/gojinja/gojinja/src/runtime"
 	"github.com/gojinja/gojinja/src/utils/mapUtils"
+	"github.com/gojinja/gojinja/src/utils/set"
 	lru "github.com/hashicorp/golang-lru"
 	"golang.org/x/exp/maps"
-	"golang.org/x/exp/slices"
-	"log"
 	"strings"
 )
 
@@ -24,7 +28,9 @@ type ExtensionsMap map[string]extensions.IExtension
 // Modifications on environments after the first template was loaded
 // will lead to surprising effects and undefined behavior.
 type Environment struct {
-	Sandboxed     bool
+	Sandboxed bool
+	// Sandbox is the policy checking attribute accesses and calls in sandboxed environments.
+	Sandbox       SandboxPolicy
 	Overlayed     bool
 	LinkedTo      *Environment
 	Shared        bool
@@ -41,9 +47,18 @@ type Environment struct {
 	Cache      Cache
 	AutoReload bool
 	Filters    map[string]filters.Filter
-	Tests      map[string]Test
-	Globals    map[string]any
-	Policies   map[string]any
+	// PureFilters are the filters the optimizer may call at compile time,
+	// see ConstFilter. Custom filters whose result only depends on their
+	// arguments can be added to it.
+	PureFilters set.Set[string]
+	Tests       map[string]Test
+	Globals     map[string]any
+	Policies    map[string]any
+	// Binops and Unops are the operators used by templates, see CallBinop.
+	Binops map[string]BinaryOperator
+	Unops  map[string]UnaryOperator
+	// Limits are the resources a render may use, see NewBudget.
+	Limits runtime.Limits
 }
 
 type Cache interface {
@@ -65,7 +80,8 @@ func (m mapCache) Get(key interface{}) (value interface{}, ok bool) {
 func New(opts *EnvOpts) (*Environment, error) {
 	var err error
 	env := &Environment{
-		Sandboxed:           false,
+		Sandboxed:           opts.Sandbox != nil,
+		Sandbox:             opts.Sandbox,
 		Overlayed:           false,
 		LinkedTo:            nil,
 		Shared:              false,
@@ -79,10 +95,16 @@ func New(opts *EnvOpts) (*Environment, error) {
 		Loader:              opts.Loader,
 		AutoReload:          opts.AutoReload,
 		Filters:             maps.Clone(filters.Default),
+		PureFilters:         set.Set[string](maps.Clone(filters.Pure)),
 		Tests:               maps.Clone(Default),
 		Globals:             maps.Clone(defaults.DefaultNamespace),
 		Policies:            maps.Clone(defaults.DefaultPolicies),
+		Binops:              maps.Clone(DefaultBinops),
+		Unops:               maps.Clone(DefaultUnops),
+		Limits:              opts.Limits,
 	}
+	env.Globals["range"] = env.Range
+	env.Binops[lexer.TokenMul] = env.Mul
 	env.AutoEscape, err = convertAutoEscape(opts.AutoEscape)
 	if err != nil {
 		return nil, err
@@ -112,20 +134,19 @@ func convertAutoEscape(ae any) (func(name string) bool, error) {
 }
 
 func configCheck(env *Environment) error {
-	if env.BlockStartString == env.VariableStartString || env.BlockStartString == env.CommentStartString || env.CommentStartString == env.VariableStartString {
-		return fmt.Errorf("block, variable and comment start strings must be different")
-	}
-	if !slices.Contains([]string{"\n", "\r\n", "\r"}, env.NewlineSequence) {
-		return fmt.Errorf("'NewlineSequence' must be one of '\\n', '\\r\\n', or '\\r'")
-	}
-	return nil
+	return env.EnvLexerInformation.Validate()
 }
 
+// LoadExtensions creates the extensions and adds the filters, the tests and
+// the globals they provide to env.
 func LoadExtensions(env *Environment, extensions map[string]func(*Environment) extensions.IExtension) ExtensionsMap {
 	ret := make(ExtensionsMap)
 	for k, v := range extensions {
 		ret[k] = v(env)
 	}
+	for _, ext := range ret.sorted() {
+		provide(env, ext)
+	}
 	return ret
 }
 
@@ -149,23 +170,25 @@ type EnvOpts struct {
 	Loader     *Loader
 	CacheSize  int
 	AutoReload bool
+	// Sandbox makes the environment sandboxed with the given policy, see the sandbox package.
+	Sandbox SandboxPolicy
+	// Limits are the resources a render may use, the zero value doesn't limit anything.
+	Limits runtime.Limits
 }
 
-type UndefinedConstructor func(hint *string, obj any, name *string, exc func(msg string) error, logger *log.Logger) runtime.IUndefined
+type UndefinedConstructor = runtime.UndefinedConstructor
 
 func DefaultEnvOpts() *EnvOpts {
 	return &EnvOpts{
 		Optimized:           true,
 		Extensions:          nil,
 		EnvLexerInformation: lexer.DefaultEnvLexerInformation(),
-		Undefined: func(hint *string, obj any, name *string, exc func(msg string) error, logger *log.Logger) runtime.IUndefined {
-			return runtime.NewUndefined(hint, obj, name, exc, logger)
-		},
-		Finalize:   nil,
-		AutoEscape: false,
-		Loader:     nil,
-		CacheSize:  400,
-		AutoReload: true,
+		Undefined:           runtime.ToConstructor(runtime.NewUndefined),
+		Finalize:            nil,
+		AutoEscape:          false,
+		Loader:              nil,
+		CacheSize:           400,
+		AutoReload:          true,
 	}
 }
 
@@ -224,6 +247,92 @@ func (env *Environment) loadTemplate(name string, globals map[string]any) (ITemp
 	return template, nil
 }
 
+// Lex tokenizes the source of a template and returns all the tokens, the
+// ones the parser ignores like comments and whitespace included. It's meant
+// for tools working on the template source. Like in Jinja, the source isn't
+// preprocessed by the extensions, see Preprocess.
+func (env *Environment) Lex(source string, name *string, filename *string) ([]lexer.Token, error) {
+	tokens, err := lexer.GetLexer(env.EnvLexerInformation).Lex(source, name, filename)
+	if err != nil {
+		return nil, withSource(err, source)
+	}
+	return tokens, nil
+}
+
+// Parse parses the source of a template with the extensions of the
+// environment and returns its abstract syntax tree.
+func (env *Environment) Parse(source string, name *string, filename *string) (*nodes.Template, error) {
+	stream, err := env.Tokenize(source, name, filename, nil)
+	if err != nil {
+		return nil, withSource(err, source)
+	}
+	template, err := parser.NewParser(stream, env.IterExtensions(), name, filename, nil).Parse()
+	if err != nil {
+		return nil, withSource(err, source)
+	}
+	return template, nil
+}
+
+// Preprocess runs the preprocessors of the extensions on the source, in the
+// order of IterExtensions.
+func (env *Environment) Preprocess(source string, name *string, filename *string) string {
+	return extensions.Preprocess(env.IterExtensions(), source, name, filename)
+}
+
+// Optimize evaluates the constant parts of the AST of a template at compile
+// time, see the optimizer package. It does nothing if the environment isn't
+// `Optimized`. Parse doesn't call it, there's no compile step yet: callers
+// optimize the ASTs they parse themselves.
+func (env *Environment) Optimize(node nodes.Node, name *string) error {
+	if !env.Optimized {
+		return nil
+	}
+	ctx := optimizer.EvalContext{}
+	if name != nil {
+		ctx.Autoescape = env.AutoEscape(*name)
+	} else {
+		ctx.Autoescape = env.AutoEscape("")
+	}
+	return optimizer.Optimize(env, node, ctx)
+}
+
+// ConstFilter returns the filter name if the optimizer may call it at
+// compile time: it must be one of the `PureFilters`. The filters don't
+// depend on the evaluation context, they are never called in volatile
+// contexts.
+func (env *Environment) ConstFilter(name string, ctx optimizer.EvalContext) (filters.Filter, bool) {
+	if ctx.Volatile || !env.PureFilters.Has(name) {
+		return nil, false
+	}
+	fn, ok := env.Filters[name]
+	return fn, ok && fn != nil
+}
+
+// withSource adds the source to syntax errors, so they show the line of
+// the error.
+func withSource(err error, source string) error {
+	if syntaxErr, ok := err.(*errors.SyntaxError); ok && syntaxErr.Source == nil {
+		syntaxErr.Source = &source
+	}
+	return err
+}
+
+// NewBudget returns the budget a render should report its resource usage to.
+func (env *Environment) NewBudget() *runtime.Budget {
+	return runtime.NewBudget(env.Limits)
+}
+
+// Range is the `range` global, it fails if the result is longer than `Limits.MaxRangeSize`.
+func (env *Environment) Range(args ...int64) ([]int64, error) {
+	return env.Limits.Range(args...)
+}
+
+// Mul is the `*` operator, it fails if it repeats a string or a list into one
+// longer than `Limits.MaxRepetition`.
+func (env *Environment) Mul(a any, b any) (any, error) {
+	return operator.MulWithLimit(a, b, env.Limits.MaxRepetition)
+}
+
 func (env *Environment) MakeGlobals(globals map[string]any) map[string]any {
 	return mapUtils.Chain(globals, env.Globals)
 }
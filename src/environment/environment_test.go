@@ -1,7 +1,172 @@
 package environment
 
-import "testing"
+import (
+	stderrors "errors"
+	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/runtime"
+	"strings"
+	"testing"
+)
 
 func TestCompile(t *testing.T) {
 	// Just to compile this module
 }
+
+func TestLexAndParse(t *testing.T) {
+	env, err := New(DefaultEnvOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := env.Lex("{# note #}{{ x }}", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, token := range tokens {
+		types = append(types, token.Type)
+	}
+	expected := []string{
+		lexer.TokenCommentBegin, lexer.TokenComment, lexer.TokenCommentEnd,
+		lexer.TokenVariableBegin, lexer.TokenWhitespace, lexer.TokenName, lexer.TokenWhitespace, lexer.TokenVariableEnd,
+	}
+	if strings.Join(types, ",") != strings.Join(expected, ",") {
+		t.Fatal("unexpected tokens", types)
+	}
+
+	template, err := env.Parse("{{ x }}", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := template.Body[0].(*nodes.Output).Nodes[0].(*nodes.Name).Name; name != "x" {
+		t.Fatal("unexpected name", name)
+	}
+
+	filename := "page.html"
+	for _, source := range []string{"a\n{{ 'b\\x' }}", "a\n{% if %}"} {
+		_, err = env.Parse(source, nil, &filename)
+		syntaxErr, ok := err.(*errors.SyntaxError)
+		if !ok || syntaxErr.Lineno != 2 || syntaxErr.Source == nil || *syntaxErr.Source != source {
+			t.Fatal("expected a syntax error with the source, got", err)
+		}
+	}
+}
+
+func TestDelimiters(t *testing.T) {
+	opts := DefaultEnvOpts()
+	opts.VariableEndString = "}"
+	opts.BlockEndString = "}}"
+	if _, err := New(opts); err == nil {
+		t.Fatal("expected an error for end strings starting with one another")
+	}
+
+	opts = DefaultEnvOpts()
+	opts.BlockStartString, opts.BlockEndString = `\BLOCK{`, "}"
+	opts.VariableStartString, opts.VariableEndString = `\VAR{`, "}"
+	env, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := env.Parse(`\BLOCK{ if x }\VAR{ {'a': x}['a'] }\BLOCK{ endif }`, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := template.Body[0].(*nodes.If); !ok {
+		t.Fatal("unexpected template", nodes.Dump(template))
+	}
+}
+
+// failingGetter fails lookups with an error that isn't a missing attribute.
+type failingGetter struct{}
+
+func (failingGetter) GetAttribute(string) (any, error) {
+	return nil, stderrors.New("broken")
+}
+
+func isUndefined(v any) bool {
+	_, ok := v.(runtime.IUndefined)
+	return ok
+}
+
+func TestLookups(t *testing.T) {
+	env, err := New(DefaultEnvOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns, _ := runtime.NewNamespace(nil, map[string]any{"a": 1})
+	lookups := map[string]func() (any, error){
+		"namespace attr": func() (any, error) { return env.Getattr(ns, "b") },
+		"map attr":       func() (any, error) { return env.Getattr(map[string]any{}, "b") },
+		"map key":        func() (any, error) { return env.Getitem(map[string]any{}, "b") },
+		"index":          func() (any, error) { return env.Getitem([]any{1}, 3) },
+	}
+	for name, lookup := range lookups {
+		if v, err := lookup(); err != nil || !isUndefined(v) {
+			t.Fatal(name, "expected an undefined, got", v, err)
+		}
+	}
+	if v, err := env.Getitem(ns, "a"); err != nil || v != 1 {
+		t.Fatal("expected the attribute, got", v, err)
+	}
+	if _, err = env.Getattr(failingGetter{}, "b"); err == nil || err.Error() != "broken" {
+		t.Fatal("expected the error of the getter, got", err)
+	}
+
+	// like in Jinja, looking something up on an undefined fails, except for
+	// chainable undefined values
+	name := "missing"
+	for _, undefined := range []UndefinedConstructor{
+		runtime.ToConstructor(runtime.NewUndefined),
+		runtime.ToConstructor(runtime.NewStrictUndefined),
+		runtime.ToConstructor(runtime.NewChainableUndefined),
+	} {
+		missing := undefined(nil, nil, &name, nil, nil)
+		_, chainable := missing.(runtime.ChainableUndefined)
+		if v, err := env.Getattr(missing, "attr"); chainable != (err == nil) {
+			t.Fatalf("unexpected lookup on %T: %v %v", missing, v, err)
+		}
+		if v, err := env.Getitem(missing, "key"); chainable != (err == nil) {
+			t.Fatalf("unexpected lookup on %T: %v %v", missing, v, err)
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	env, err := New(DefaultEnvOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Filters["upper"] = func(args []any, kwargs map[string]any) any {
+		return strings.ToUpper(args[0].(string))
+	}
+
+	optimize := func(source string) nodes.Expr {
+		template, err := env.Parse(source, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = env.Optimize(template, nil); err != nil {
+			t.Fatal(err)
+		}
+		return template.Body[0].(*nodes.Output).Nodes[0]
+	}
+	if _, ok := optimize(`{{ "a"|upper }}`).(*nodes.Filter); !ok {
+		t.Fatal("filters that aren't pure shouldn't be called")
+	}
+	env.PureFilters.Add("upper")
+	if c, ok := optimize(`{{ ("a" * 2)|upper }}`).(*nodes.Const); !ok || c.Value != "AA" {
+		t.Fatal("expected a constant, got", c)
+	}
+
+	delete(env.Binops, lexer.TokenMul)
+	if _, ok := optimize(`{{ "a" * 2 }}`).(*nodes.BinExpr); !ok {
+		t.Fatal("removed operators shouldn't be evaluated")
+	}
+
+	env.Optimized = false
+	if _, ok := optimize(`{{ 1 + 2 }}`).(*nodes.BinExpr); !ok {
+		t.Fatal("the template shouldn't be optimized")
+	}
+}
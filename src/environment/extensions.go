@@ -0,0 +1,88 @@
+package environment
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/filters"
+	"github.com/gojinja/gojinja/src/lexer"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"reflect"
+)
+
+// FilterProvider is implemented by extensions adding filters to the
+// environment.
+type FilterProvider interface {
+	Filters() map[string]filters.Filter
+}
+
+// TestProvider is implemented by extensions adding tests to the environment.
+type TestProvider interface {
+	Tests() map[string]Test
+}
+
+// GlobalProvider is implemented by extensions adding globals to the
+// environment.
+type GlobalProvider interface {
+	Globals() map[string]any
+}
+
+// provide adds the filters, the tests and the globals of ext to env.
+func provide(env *Environment, ext extensions.IExtension) {
+	if p, ok := ext.(FilterProvider); ok {
+		maps.Copy(env.Filters, p.Filters())
+	}
+	if p, ok := ext.(TestProvider); ok {
+		maps.Copy(env.Tests, p.Tests())
+	}
+	if p, ok := ext.(GlobalProvider); ok {
+		maps.Copy(env.Globals, p.Globals())
+	}
+}
+
+// sorted returns the extensions sorted by priority, the ones with the same
+// priority are sorted by name.
+func (m ExtensionsMap) sorted() []extensions.IExtension {
+	names := maps.Keys(m)
+	slices.Sort(names)
+	ret := make([]extensions.IExtension, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, m[name])
+	}
+	extensions.SortByPriority(ret)
+	return ret
+}
+
+// IterExtensions returns the extensions sorted by priority, it's the order
+// the preprocessors and the stream filters run in.
+func (env *Environment) IterExtensions() []extensions.IExtension {
+	return env.Extensions.sorted()
+}
+
+// Tokenize preprocesses the source with the extensions, tokenizes it and
+// passes the tokens through the stream filters of the extensions.
+func (env *Environment) Tokenize(source string, name *string, filename *string, state *string) (*lexer.TokenStream, error) {
+	source = env.Preprocess(source, name, filename)
+	stream, err := lexer.GetLexer(env.EnvLexerInformation).Tokenize(source, name, filename, state)
+	if err != nil {
+		return nil, err
+	}
+	return extensions.FilterStream(env.IterExtensions(), stream)
+}
+
+// ExtensionAttribute returns the attribute name of the extension identified
+// by identifier (see extensions.Identifier), it evaluates the
+// ExtensionAttribute nodes. If several extensions have the same type, the
+// first one in the order of IterExtensions is used.
+func (env *Environment) ExtensionAttribute(identifier string, name string) (any, error) {
+	for _, ext := range env.IterExtensions() {
+		if extensions.Identifier(ext) != identifier {
+			continue
+		}
+		if method := reflect.ValueOf(ext).MethodByName(name); method.IsValid() {
+			return method.Interface(), nil
+		}
+		return nil, fmt.Errorf("extension %s has no attribute '%s'", identifier, name)
+	}
+	return nil, fmt.Errorf("extension %s is not loaded", identifier)
+}
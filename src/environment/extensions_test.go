@@ -0,0 +1,157 @@
+package environment
+
+import (
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/filters"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"strings"
+	"testing"
+)
+
+// testExtension adds `{% capture %}...{% endcapture %}`, assigning the
+// body to a free identifier, and appends its suffix to the sources.
+type testExtension struct {
+	suffix   string
+	priority int
+}
+
+func (e *testExtension) Tags() []string {
+	return []string{"capture"}
+}
+
+func (e *testExtension) Parse(p extensions.IParser) ([]nodes.Node, error) {
+	lineno := p.Stream().Next().Lineno
+	body, err := p.ParseStatements([]string{"name:endcapture"}, true)
+	if err != nil {
+		return nil, err
+	}
+	return []nodes.Node{&nodes.AssignBlock{
+		Target:     p.FreeIdentifier(nil),
+		Body:       body,
+		StmtCommon: nodes.StmtCommon{Lineno: lineno},
+	}}, nil
+}
+
+func (e *testExtension) Preprocess(source string, _ *string, _ *string) string {
+	return source + e.suffix
+}
+
+func (e *testExtension) Priority() int {
+	return e.priority
+}
+
+func (e *testExtension) Render() string {
+	return e.suffix
+}
+
+func (e *testExtension) Filters() map[string]filters.Filter {
+	return map[string]filters.Filter{e.suffix: nil}
+}
+
+func (e *testExtension) Tests() map[string]Test {
+	return map[string]Test{e.suffix: nil}
+}
+
+func (e *testExtension) Globals() map[string]any {
+	return map[string]any{"suffix": e.suffix}
+}
+
+// upperExtension uppercases the template data.
+type upperExtension struct{}
+
+func (upperExtension) Tags() []string {
+	return nil
+}
+
+func (upperExtension) Parse(extensions.IParser) ([]nodes.Node, error) {
+	return nil, nil
+}
+
+func (upperExtension) FilterStream(stream *lexer.TokenStream) (*lexer.TokenStream, error) {
+	var tokens []lexer.Token
+	for !stream.Eos() {
+		token := stream.Next()
+		if token.Type == lexer.TokenData {
+			token.Value = strings.ToUpper(token.Value.(string))
+		}
+		tokens = append(tokens, token)
+	}
+	return lexer.NewTokenStream(tokens, stream.Name(), stream.Filename()), nil
+}
+
+func TestExtensions(t *testing.T) {
+	opts := DefaultEnvOpts()
+	opts.Extensions = map[string]func(*Environment) extensions.IExtension{
+		"a":     func(*Environment) extensions.IExtension { return &testExtension{"a", 200} },
+		"b":     func(*Environment) extensions.IExtension { return &testExtension{"b", 50} },
+		"c":     func(*Environment) extensions.IExtension { return &testExtension{"c", extensions.DefaultPriority} },
+		"upper": func(*Environment) extensions.IExtension { return upperExtension{} },
+	}
+	env, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, ext := range env.IterExtensions() {
+		if e, ok := ext.(*testExtension); ok {
+			order = append(order, e.suffix)
+		} else {
+			order = append(order, "upper")
+		}
+	}
+	if strings.Join(order, ",") != "b,c,upper,a" {
+		t.Fatal("unexpected order", order)
+	}
+	if env.Globals["suffix"] != "a" {
+		t.Fatal("the extension with the highest priority should provide the global", env.Globals["suffix"])
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if _, ok := env.Filters[name]; !ok {
+			t.Fatal("missing filter", name)
+		}
+		if _, ok := env.Tests[name]; !ok {
+			t.Fatal("missing test", name)
+		}
+	}
+
+	if source := env.Preprocess("x", nil, nil); source != "xbca" {
+		t.Fatal("unexpected preprocessed source", source)
+	}
+	template, err := env.Parse("x{% capture %}y{% endcapture %}", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := template.Body[0].(*nodes.Output).Nodes[0].(*nodes.TemplateData).Data; data != "X" {
+		t.Fatal("unexpected data", data)
+	}
+	assign := template.Body[1].(*nodes.AssignBlock)
+	if name := assign.Target.(*nodes.InternalName).Name; name != "fi1" {
+		t.Fatal("unexpected identifier", name)
+	}
+	if data := assign.Body[0].(*nodes.Output).Nodes[0].(*nodes.TemplateData).Data; data != "Y" {
+		t.Fatal("unexpected data", data)
+	}
+	if data := template.Body[2].(*nodes.Output).Nodes[0].(*nodes.TemplateData).Data; data != "BCA" {
+		t.Fatal("the preprocessors should run by priority", data)
+	}
+
+	identifier := extensions.Identifier(&testExtension{})
+	if identifier != "github.com/gojinja/gojinja/src/environment.testExtension" {
+		t.Fatal("unexpected identifier", identifier)
+	}
+	render, err := env.ExtensionAttribute(identifier, "Render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := render.(func() string)(); res != "b" {
+		t.Fatal("unexpected result", res)
+	}
+	if _, err := env.ExtensionAttribute(identifier, "Missing"); err == nil {
+		t.Fatal("expected an error for a missing attribute")
+	}
+	if _, err := env.ExtensionAttribute("missing.Extension", "Render"); err == nil {
+		t.Fatal("expected an error for a missing extension")
+	}
+}
@@ -0,0 +1,56 @@
+package environment
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/operator"
+)
+
+// BinaryOperator implements a binary operator of the template language.
+type BinaryOperator func(a any, b any) (any, error)
+
+// UnaryOperator implements a unary operator of the template language.
+type UnaryOperator func(a any) (any, error)
+
+// DefaultBinops are the binary operators, by the name of their token (the
+// `Op` of `nodes.BinExpr`). `and` and `or` are not in the table as they
+// evaluate their right operand lazily.
+var DefaultBinops = map[string]BinaryOperator{
+	lexer.TokenAdd:      operator.Add,
+	lexer.TokenSub:      operator.Sub,
+	lexer.TokenMul:      operator.Mul,
+	lexer.TokenDiv:      operator.Div,
+	lexer.TokenFloordiv: operator.FloorDiv,
+	lexer.TokenMod:      operator.Mod,
+	lexer.TokenPow:      operator.Pow,
+}
+
+// DefaultUnops are the unary operators, by the name of their token (the
+// `Op` of `nodes.UnaryExpr`).
+var DefaultUnops = map[string]UnaryOperator{
+	lexer.TokenAdd: operator.Pos,
+	lexer.TokenSub: operator.Neg,
+	"not": func(a any) (any, error) {
+		return operator.Not(a)
+	},
+}
+
+// CallBinop applies the binary operator op to a and b. Environments can
+// override or veto operators by replacing them in `Binops`, the same way
+// Jinja's sandbox intercepts them with `call_binop`.
+func (env *Environment) CallBinop(op string, a any, b any) (any, error) {
+	fn, ok := env.Binops[op]
+	if !ok || fn == nil {
+		return nil, fmt.Errorf("unknown binary operator '%s'", op)
+	}
+	return fn(a, b)
+}
+
+// CallUnop applies the unary operator op to a, see CallBinop.
+func (env *Environment) CallUnop(op string, a any) (any, error) {
+	fn, ok := env.Unops[op]
+	if !ok || fn == nil {
+		return nil, fmt.Errorf("unknown unary operator '%s'", op)
+	}
+	return fn(a)
+}
@@ -0,0 +1,95 @@
+package environment
+
+import (
+	stderrors "errors"
+	"fmt"
+	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/operator"
+	"github.com/gojinja/gojinja/src/utils"
+)
+
+// SandboxPolicy decides what templates of a sandboxed environment may do.
+// operator.GetAttr consults it for the attributes.
+type SandboxPolicy interface {
+	operator.AttributePolicy
+	// IsSafeCallable tells if obj can be called.
+	IsSafeCallable(obj any) bool
+}
+
+// SandboxSetattrPolicy can be implemented by sandbox policies that
+// restrict which attributes templates may assign.
+type SandboxSetattrPolicy interface {
+	// IsSafeSetattr tells if attr of obj can be set to value.
+	IsSafeSetattr(obj any, attr string, value any) bool
+}
+
+// Getattr gets an attribute of an object. If the attribute doesn't exist
+// an undefined is returned, other lookup errors (like the ones of strict
+// undefined values) are returned as is. In sandboxed environments accessing
+// an unsafe attribute is a security error.
+func (env *Environment) Getattr(obj any, attr string) (any, error) {
+	value, err := operator.GetAttr(obj, attr, env.AttributePolicy())
+	if err != nil {
+		return env.undefinedLookup(obj, attr, err)
+	}
+	return value, nil
+}
+
+// AttributePolicy returns the policy the attribute lookups of the
+// environment must pass to operator.GetAttr, nil if it isn't sandboxed.
+// The filters looking attributes up, like `attr` or `map(attribute=...)`,
+// use it.
+func (env *Environment) AttributePolicy() operator.AttributePolicy {
+	if env.Sandbox == nil {
+		return nil
+	}
+	return env.Sandbox
+}
+
+// Getitem gets an item of an object. If there is no such item and the key is
+// a string, the attribute with that name is looked up instead. Missing items
+// are undefined like in Getattr.
+func (env *Environment) Getitem(obj any, key any) (any, error) {
+	value, err := operator.GetItem(obj, key)
+	if err == nil {
+		return value, nil
+	}
+	if !stderrors.Is(err, operator.ErrNotFound) {
+		return nil, err
+	}
+	if attr, ok := key.(string); ok {
+		return env.Getattr(obj, attr)
+	}
+	return env.undefinedLookup(obj, fmt.Sprint(key), err)
+}
+
+// undefinedLookup returns an undefined for the failed lookup of name in obj
+// if nothing was found, or the error of the lookup.
+func (env *Environment) undefinedLookup(obj any, name string, err error) (any, error) {
+	if !stderrors.Is(err, operator.ErrNotFound) {
+		return nil, err
+	}
+	return env.Undefined(nil, obj, &name, nil, nil), nil
+}
+
+// Setattr assigns an attribute of an object, for `{% set obj.attr = value %}`.
+// Like in Jinja, only namespace objects (values implementing
+// operator.ISetAttr) support it.
+func (env *Environment) Setattr(obj any, attr string, value any) error {
+	if _, ok := obj.(operator.ISetAttr); !ok {
+		return errors.TemplateError("cannot assign attribute on non-namespace object")
+	}
+	if policy, ok := env.Sandbox.(SandboxSetattrPolicy); ok && !policy.IsSafeSetattr(obj, attr, value) {
+		return errors.TemplateSecurityError(fmt.Sprintf("assignment to attribute '%s' of '%s' is unsafe.", attr, utils.ObjectTypeRepr(obj)))
+	}
+	return operator.SetAttr(obj, attr, value)
+}
+
+// Call calls obj with the given arguments. In sandboxed environments calling
+// an unsafe callable is a security error.
+func (env *Environment) Call(obj any, args []any, kwargs map[string]any) (any, error) {
+	if env.Sandbox != nil && !env.Sandbox.IsSafeCallable(obj) {
+		return nil, errors.TemplateSecurityError(fmt.Sprintf("%s is not safely callable", utils.ObjectTypeRepr(obj)))
+	}
+	return operator.Call(obj, args, kwargs)
+}
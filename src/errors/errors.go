@@ -1,21 +1,269 @@
 package errors
 
-import "fmt"
+import (
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NotFoundError is raised if a template does not exist.
+type NotFoundError struct {
+	Name    string
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return e.Name
+}
 
 func TemplateNotFound(name string, msg string) error {
-	// TODO real implementation
-	return fmt.Errorf("TEMPLATE NOT FOUND %s", name)
+	return &NotFoundError{Name: name, Message: msg}
+}
+
+// SyntaxError is raised to tell the user that there is a problem with the template.
+type SyntaxError struct {
+	Message string
+	Lineno  int
+	// Col is the 1-based column of the error, 0 if it's unknown.
+	Col      int
+	Name     *string
+	Filename *string
+	// Source is the template source, if known. It's used to print the erroneous line.
+	Source *string
+	// Assertion is set for errors that are like syntax errors but cover
+	// cases where something in the template caused an error at compile
+	// time that wasn't necessarily caused by a syntax error.
+	Assertion bool
+}
+
+func (e *SyntaxError) Error() string {
+	location := fmt.Sprintf("line %d", e.Lineno)
+	if name := firstNonNil(e.Filename, e.Name); name != nil {
+		location = fmt.Sprintf("File %q, %s", *name, location)
+	}
+	lines := []string{e.Message, "  " + location}
+
+	// if the source is set, add the line to the output
+	if e.Source != nil {
+		if line, ok := SourceLine(*e.Source, e.Lineno); ok {
+			trimmed := strings.TrimSpace(line)
+			lines = append(lines, "    "+trimmed)
+			// and point at the column, if it's in the printed part of the line
+			indent := len(line) - len(strings.TrimLeftFunc(line, unicode.IsSpace))
+			if caret := e.Col - 1 - indent; e.Col > 0 && caret >= 0 && caret <= len(trimmed) {
+				lines = append(lines, "    "+strings.Repeat(" ", caret)+"^")
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
 }
 
 func TemplateSyntaxError(msg string, lineno int, name *string, filename *string) error {
-	// TODO real implementation
-	return fmt.Errorf("TEMPLATE SYNTAX ERROR %s %d", msg, lineno)
+	return &SyntaxError{
+		Message:  msg,
+		Lineno:   lineno,
+		Name:     name,
+		Filename: filename,
+	}
+}
+
+// TemplateSyntaxErrorAt is like TemplateSyntaxError, for errors whose column is known.
+func TemplateSyntaxErrorAt(msg string, lineno int, col int, name *string, filename *string) error {
+	err := TemplateSyntaxError(msg, lineno, name, filename).(*SyntaxError)
+	err.Col = col
+	return err
 }
 
 func TemplateAssertionError(msg string, lineno int, name *string, filename *string) error {
-	return TemplateSyntaxError(msg, lineno, name, filename)
+	err := TemplateSyntaxError(msg, lineno, name, filename).(*SyntaxError)
+	err.Assertion = true
+	return err
+}
+
+// FrameKind tells what kind of template code a traceback frame was executing.
+type FrameKind int
+
+const (
+	// TopLevelFrame is the code of a template outside any block or macro.
+	TopLevelFrame FrameKind = iota
+	// BlockFrame is the body of a `{% block %}`.
+	BlockFrame
+	// MacroFrame is the body of a `{% macro %}` or of a `{% call %}` block.
+	MacroFrame
+	// IncludeFrame is the top level code of an included template.
+	IncludeFrame
+)
+
+// Frame is a single level of a template traceback.
+type Frame struct {
+	Kind FrameKind
+	// Symbol is the name of the block or the macro, or the name of the included template.
+	Symbol   string
+	Name     *string
+	Filename *string
+	Lineno   int
+	// Line is the source line the frame was executing, empty if the source is unknown.
+	Line string
+}
+
+// NewFrame creates a frame for the execution of node. Name and filename
+// describe the template the node comes from, source (optional) is used to
+// fill the line of the frame.
+func NewFrame(kind FrameKind, symbol string, node interface{ GetLineno() int }, name, filename, source *string) Frame {
+	f := Frame{
+		Kind:     kind,
+		Symbol:   symbol,
+		Name:     name,
+		Filename: filename,
+		Lineno:   node.GetLineno(),
+	}
+	if source != nil {
+		if line, ok := SourceLine(*source, f.Lineno); ok {
+			f.Line = strings.TrimSpace(line)
+		}
+	}
+	return f
+}
+
+// Function describes the code executed in the frame the way Python describes
+// functions in its tracebacks.
+func (f Frame) Function() string {
+	switch f.Kind {
+	case BlockFrame:
+		return fmt.Sprintf("block %q", f.Symbol)
+	case MacroFrame:
+		return fmt.Sprintf("macro %q", f.Symbol)
+	case IncludeFrame:
+		return fmt.Sprintf("included template %q", f.Symbol)
+	default:
+		return "top-level template code"
+	}
+}
+
+func (f Frame) String() string {
+	name := "<template>"
+	if n := firstNonNil(f.Filename, f.Name); n != nil {
+		name = *n
+	}
+	s := fmt.Sprintf("  File %q, line %d, in %s", name, f.Lineno, f.Function())
+	if f.Line != "" {
+		s += "\n    " + f.Line
+	}
+	return s
+}
+
+// RuntimeError is an error that happened while rendering a template. It
+// carries the template traceback leading to the error.
+type RuntimeError struct {
+	Message string
+	// Cause is the original error if the runtime error wraps one.
+	Cause error
+	// Frames are ordered like a Python traceback: the outermost frame first
+	// and the frame where the error happened last.
+	Frames []Frame
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Cause != nil && e.Message == "" {
+		return e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Cause
+}
+
+// Traceback renders the error like a Python traceback, showing template
+// lines instead of Python ones.
+func (e *RuntimeError) Traceback() string {
+	var builder strings.Builder
+	builder.WriteString("Traceback (most recent call last):\n")
+	for _, f := range e.Frames {
+		builder.WriteString(f.String())
+		builder.WriteString("\n")
+	}
+	builder.WriteString(e.Error())
+	return builder.String()
+}
+
+// WithFrame records that err passed through the given frame. It's meant to be
+// called while unwinding, so the frame is added as the outermost one.
+// Errors that aren't RuntimeErrors are wrapped into one.
+func WithFrame(err error, frame Frame) error {
+	if err == nil {
+		return nil
+	}
+	var rErr *RuntimeError
+	if !stderrors.As(err, &rErr) {
+		rErr = &RuntimeError{Cause: err}
+	}
+	rErr.Frames = append([]Frame{frame}, rErr.Frames...)
+	return rErr
+}
+
+// Frames returns the template traceback attached to err, nil if there is none.
+func Frames(err error) []Frame {
+	var rErr *RuntimeError
+	if stderrors.As(err, &rErr) {
+		return rErr.Frames
+	}
+	return nil
 }
 
 func TemplateError(msg string) error {
-	return fmt.Errorf("TEMPLATE ERROR: %s", msg)
+	return &RuntimeError{Message: msg}
+}
+
+// SecurityError is raised if a sandboxed template tries to do something insecure.
+type SecurityError struct {
+	Message string
+}
+
+func (e *SecurityError) Error() string {
+	return e.Message
+}
+
+func TemplateSecurityError(msg string) error {
+	return &SecurityError{Message: msg}
+}
+
+// LimitError is raised if a template exceeds one of the resource limits of
+// the environment. Limit is the name of the exceeded limit.
+type LimitError struct {
+	Limit string
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("template exceeded %s (%d)", e.Limit, e.Max)
+}
+
+func LimitExceeded(limit string, max int) error {
+	return &LimitError{Limit: limit, Max: max}
+}
+
+// SourceLine returns the line with the given (1-based) number.
+func SourceLine(source string, lineno int) (string, bool) {
+	if lineno < 1 {
+		return "", false
+	}
+	lines := strings.Split(source, "\n")
+	if lineno > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[lineno-1], "\r"), true
+}
+
+func firstNonNil(ss ...*string) *string {
+	for _, s := range ss {
+		if s != nil {
+			return s
+		}
+	}
+	return nil
 }
@@ -0,0 +1,97 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type lineNode int
+
+func (l lineNode) GetLineno() int {
+	return int(l)
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestTraceback(t *testing.T) {
+	index := "{% include 'a.html' %}"
+	a := "foo\n{{ m() }}"
+	macros := "{% macro m() %}\n  {{ 1 | bad }}\n{% endmacro %}"
+
+	err := fmt.Errorf("no filter named 'bad'")
+	err = WithFrame(err, NewFrame(MacroFrame, "m", lineNode(2), strPtr("macros.html"), nil, &macros))
+	err = WithFrame(err, NewFrame(IncludeFrame, "a.html", lineNode(2), strPtr("a.html"), nil, &a))
+	err = WithFrame(err, NewFrame(TopLevelFrame, "", lineNode(1), strPtr("index.html"), nil, &index))
+
+	var rErr *RuntimeError
+	if !stderrors.As(err, &rErr) {
+		t.Fatal("expected a runtime error, got", err)
+	}
+	expected := `Traceback (most recent call last):
+  File "index.html", line 1, in top-level template code
+    {% include 'a.html' %}
+  File "a.html", line 2, in included template "a.html"
+    {{ m() }}
+  File "macros.html", line 2, in macro "m"
+    {{ 1 | bad }}
+no filter named 'bad'`
+	if rErr.Traceback() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, rErr.Traceback())
+	}
+
+	frames := Frames(err)
+	symbols := make([]string, 0, len(frames))
+	for _, f := range frames {
+		symbols = append(symbols, f.Symbol)
+	}
+	if !reflect.DeepEqual(symbols, []string{"", "a.html", "m"}) {
+		t.Fatal("unexpected frames order", symbols)
+	}
+}
+
+func TestWithFrameKeepsCause(t *testing.T) {
+	cause := TemplateSyntaxError("unexpected end of template", 3, strPtr("a.html"), nil)
+	err := WithFrame(cause, Frame{Kind: BlockFrame, Symbol: "body", Lineno: 7})
+
+	var sErr *SyntaxError
+	if !stderrors.As(err, &sErr) || sErr.Lineno != 3 {
+		t.Fatal("syntax error should be reachable from the runtime error")
+	}
+	if err.Error() != cause.Error() {
+		t.Fatal("got:", err.Error(), "expected:", cause.Error())
+	}
+	if WithFrame(nil, Frame{}) != nil {
+		t.Fatal("nil error shouldn't get a frame")
+	}
+}
+
+func TestSyntaxErrorMessage(t *testing.T) {
+	source := "{% for %}\n  {% if x y %}\n"
+	err := &SyntaxError{
+		Message:  "expected token 'end of statement block', got 'y'",
+		Lineno:   2,
+		Name:     strPtr("index.html"),
+		Filename: strPtr("templates/index.html"),
+		Source:   &source,
+	}
+	expected := `expected token 'end of statement block', got 'y'
+  File "templates/index.html", line 2
+    {% if x y %}`
+	if err.Error() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, err.Error())
+	}
+
+	err.Col = 11
+	if err.Error() != expected+"\n            ^" {
+		t.Fatalf("expected a caret under 'y', got:\n%s", err.Error())
+	}
+
+	assertion := TemplateAssertionError("can't assign", 1, nil, nil).(*SyntaxError)
+	if !assertion.Assertion || assertion.Error() != "can't assign\n  line 1" {
+		t.Fatal("unexpected assertion error", assertion)
+	}
+}
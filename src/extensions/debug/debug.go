@@ -0,0 +1,70 @@
+// Package debug provides the extension adding the `{% debug %}` tag, which
+// renders the current context and the available filters and tests.
+package debug
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/runtime"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// maxDepth is how deep the context is printed, deeper values are elided.
+const maxDepth = 3
+
+// Extension adds `{% debug %}`, the tag is parsed to an output calling
+// Render with the context.
+type Extension struct {
+	env *environment.Environment
+}
+
+var _ extensions.IExtension = &Extension{}
+
+func New(env *environment.Environment) extensions.IExtension {
+	return &Extension{env: env}
+}
+
+func (e *Extension) Tags() []string {
+	return []string{"debug"}
+}
+
+func (e *Extension) Parse(p extensions.IParser) ([]nodes.Node, error) {
+	lineno := p.Stream().Next().Lineno
+	context := &nodes.ContextReference{ExprCommon: nodes.ExprCommon{Lineno: lineno}}
+	call := extensions.CallMethod(e, "Render", []nodes.Expr{context}, nil, nil, nil, lineno)
+	return []nodes.Node{&nodes.Output{
+		Nodes:      []nodes.Expr{call},
+		StmtCommon: nodes.StmtCommon{Lineno: lineno},
+	}}, nil
+}
+
+// Render pretty prints the variables of the context and the names of the
+// filters and the tests of the environment.
+func (e *Extension) Render(context *runtime.Context) string {
+	filters := maps.Keys(e.env.Filters)
+	slices.Sort(filters)
+	tests := maps.Keys(e.env.Tests)
+	slices.Sort(tests)
+
+	var vars map[string]any
+	if context != nil {
+		vars = context.GetAll()
+	}
+	return Pformat(map[string]any{
+		"context": vars,
+		"filters": filters,
+		"tests":   tests,
+	}, maxDepth)
+}
+
+// Pformat formats v like Python's `pprint.pformat`: values are written on
+// a single line if they fit in 80 columns, otherwise every item of the
+// mappings and the sequences gets its own line. Mappings are sorted by
+// key, containers nested deeper than depth are elided (depth <= 0 means
+// no limit).
+func Pformat(v any, depth int) string {
+	f := &formatter{width: 80, maxDepth: depth}
+	return f.format(v, 0, 0)
+}
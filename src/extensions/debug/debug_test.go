@@ -0,0 +1,109 @@
+package debug
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/parser"
+	"github.com/gojinja/gojinja/src/runtime"
+	"golang.org/x/exp/maps"
+	"strings"
+	"testing"
+)
+
+func TestDebug(t *testing.T) {
+	opts := environment.DefaultEnvOpts()
+	opts.Extensions = map[string]func(*environment.Environment) extensions.IExtension{"debug": New}
+	env, err := environment.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := lexer.GetLexer(env.EnvLexerInformation).Tokenize("x\n{% debug %}", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := parser.NewParser(stream, maps.Values(env.Extensions), nil, nil, nil).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, ok := template.Body[1].(*nodes.Output)
+	if !ok || output.Lineno != 2 {
+		t.Fatalf("expected an output on line 2, got %#v", template.Body[1])
+	}
+	call := output.Nodes[0].(*nodes.Call)
+	if _, ok := call.Args[0].(*nodes.ContextReference); !ok || len(call.Args) != 1 {
+		t.Fatalf("expected the context as argument, got %#v", call.Args)
+	}
+	attr, ok := call.Node.(*nodes.ExtensionAttribute)
+	if !ok || attr.Identifier != "github.com/gojinja/gojinja/src/extensions/debug.Extension" || attr.Name != "Render" {
+		t.Fatalf("expected the render method, got %#v", call.Node)
+	}
+	method, err := env.ExtensionAttribute(attr.Identifier, attr.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := method.(func(*runtime.Context) string)
+
+	context := runtime.NewContext(map[string]any{"a": 1, "b": "x"})
+	context.Vars["a"] = 2
+	out := render(context)
+	if !strings.HasPrefix(out, "{'context': {'a': 2, 'b': 'x'},\n 'filters': [],\n 'tests': ['!=',\n           '<',") {
+		t.Fatal("unexpected output", out)
+	}
+	if !strings.Contains(out, "'defined',\n") {
+		t.Fatal("unexpected output", out)
+	}
+
+	if _, err := parser.NewParser(mustTokenize(t, env, `{% debug x %}`), maps.Values(env.Extensions), nil, nil, nil).Parse(); err == nil {
+		t.Fatal("expected an error for arguments")
+	}
+}
+
+func mustTokenize(t *testing.T, env *environment.Environment, source string) *lexer.TokenStream {
+	t.Helper()
+	stream, err := lexer.GetLexer(env.EnvLexerInformation).Tokenize(source, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+type repr struct{}
+
+func (repr) Repr() string {
+	return "<repr>"
+}
+
+func TestPformat(t *testing.T) {
+	long := strings.Repeat("x", 40)
+	tests := []struct {
+		value    any
+		depth    int
+		expected string
+	}{
+		{nil, 0, "None"},
+		{true, 0, "True"},
+		{"it's", 0, `"it's"`},
+		{"a'\"\n", 0, `'a\'"\n'`},
+		{1.5, 0, "1.5"},
+		{repr{}, 0, "<repr>"},
+		{[]any{}, 0, "[]"},
+		{map[string]int{"b": 2, "a": 1}, 0, "{'a': 1, 'b': 2}"},
+		{[]any{1, []any{2, []any{3}}}, 2, "[1, [2, [...]]]"},
+		{map[string]any{"a": map[string]any{"b": 1}}, 1, "{'a': {...}}"},
+		{[]any{[]any{}}, 1, "[[]]"},
+		{[]string{long, long}, 0, "['" + long + "',\n '" + long + "']"},
+		{
+			map[string]any{"key": []string{long, long}},
+			0,
+			"{'key': ['" + long + "',\n         '" + long + "']}",
+		},
+	}
+	for _, test := range tests {
+		if res := Pformat(test.value, test.depth); res != test.expected {
+			t.Fatalf("expected:\n%s\ngot:\n%s", test.expected, res)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package debug
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type formatter struct {
+	width    int
+	maxDepth int
+}
+
+type representable interface {
+	Repr() string
+}
+
+// format formats v starting at the column indent, level is how deep v is
+// nested.
+func (f *formatter) format(v any, indent int, level int) string {
+	oneLine := f.repr(v, level)
+	if indent+len(oneLine) <= f.width || f.elided(level) {
+		return oneLine
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Map:
+		keys := sortedKeys(value)
+		lines := make([]string, 0, len(keys))
+		for _, k := range keys {
+			key := f.repr(k.Interface(), level+1) + ": "
+			lines = append(lines, key+f.format(value.MapIndex(k).Interface(), indent+1+len(key), level+1))
+		}
+		return "{" + strings.Join(lines, ",\n"+strings.Repeat(" ", indent+1)) + "}"
+	case reflect.Slice, reflect.Array:
+		lines := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			lines = append(lines, f.format(value.Index(i).Interface(), indent+1, level+1))
+		}
+		return "[" + strings.Join(lines, ",\n"+strings.Repeat(" ", indent+1)) + "]"
+	default:
+		return oneLine
+	}
+}
+
+func (f *formatter) elided(level int) bool {
+	return f.maxDepth > 0 && level >= f.maxDepth
+}
+
+// repr formats v on a single line, like Python's `repr`.
+func (f *formatter) repr(v any, level int) string {
+	switch v := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case string:
+		return quote(v)
+	case representable:
+		return v.Repr()
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Len() == 0 {
+			return "{}"
+		}
+		if f.elided(level) {
+			return "{...}"
+		}
+		keys := sortedKeys(value)
+		items := make([]string, 0, len(keys))
+		for _, k := range keys {
+			items = append(items, f.repr(k.Interface(), level+1)+": "+f.repr(value.MapIndex(k).Interface(), level+1))
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() || value.Len() == 0 {
+			return "[]"
+		}
+		if f.elided(level) {
+			return "[...]"
+		}
+		items := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, f.repr(value.Index(i).Interface(), level+1))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Func:
+		return fmt.Sprintf("<function %s>", value.Type())
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sortedKeys returns the keys of a map sorted by their representation.
+func sortedKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	return keys
+}
+
+// quote quotes a string like Python's `repr`.
+func quote(s string) string {
+	q := byte('\'')
+	if strings.ContainsRune(s, '\'') && !strings.ContainsRune(s, '"') {
+		q = '"'
+	}
+	var b strings.Builder
+	b.WriteByte(q)
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == rune(q):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case !unicode.IsPrint(r):
+			if r < 0x100 {
+				_, _ = fmt.Fprintf(&b, `\x%02x`, r)
+			} else {
+				_, _ = fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(q)
+	return b.String()
+}
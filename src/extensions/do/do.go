@@ -0,0 +1,31 @@
+// Package do provides the extension adding the `{% do %}` tag, evaluating
+// an expression for its side effects: `{% do items.append(item) %}`.
+package do
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/nodes"
+)
+
+// Extension adds `{% do %}`, it's parsed to an ExprStmt node.
+type Extension struct{}
+
+var _ extensions.IExtension = Extension{}
+
+func New(*environment.Environment) extensions.IExtension {
+	return Extension{}
+}
+
+func (Extension) Tags() []string {
+	return []string{"do"}
+}
+
+func (Extension) Parse(p extensions.IParser) ([]nodes.Node, error) {
+	lineno := p.Stream().Next().Lineno
+	expr, err := p.ParseTuple(false, true, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return []nodes.Node{&nodes.ExprStmt{Node: expr, StmtCommon: nodes.StmtCommon{Lineno: lineno}}}, nil
+}
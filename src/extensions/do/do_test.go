@@ -0,0 +1,73 @@
+package do
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/parser"
+	"golang.org/x/exp/maps"
+	"testing"
+)
+
+func parse(t *testing.T, source string) (*nodes.Template, error) {
+	t.Helper()
+	opts := environment.DefaultEnvOpts()
+	opts.Extensions = map[string]func(*environment.Environment) extensions.IExtension{"do": New}
+	env, err := environment.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := lexer.GetLexer(env.EnvLexerInformation).Tokenize(source, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parser.NewParser(stream, maps.Values(env.Extensions), nil, nil, nil).Parse()
+}
+
+func TestDo(t *testing.T) {
+	template, err := parse(t, "{% for x in xs %}\n{% do items.append(x) %}{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, ok := template.Body[0].(*nodes.For).Body[1].(*nodes.ExprStmt)
+	if !ok {
+		t.Fatalf("expected an expression statement, got %#v", template.Body[0].(*nodes.For).Body)
+	}
+	if stmt.Lineno != 2 {
+		t.Fatal("unexpected line number", stmt.Lineno)
+	}
+	call, ok := stmt.Node.(*nodes.Call)
+	if !ok {
+		t.Fatalf("expected a call, got %#v", stmt.Node)
+	}
+	if attr, ok := call.Node.(*nodes.Getattr); !ok || attr.Attr != "append" {
+		t.Fatalf("expected a call of append, got %#v", call.Node)
+	}
+
+	template, err = parse(t, `{% do 1 if x else 2 %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := template.Body[0].(*nodes.ExprStmt).Node.(*nodes.CondExpr); !ok {
+		t.Fatalf("expected a conditional expression, got %#v", template.Body[0])
+	}
+
+	template, err = parse(t, `{% do a, b %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tuple, ok := template.Body[0].(*nodes.ExprStmt).Node.(*nodes.Tuple); !ok || len(tuple.Items) != 2 {
+		t.Fatalf("expected a tuple, got %#v", template.Body[0])
+	}
+
+	invalid := []string{
+		`{% do %}`,
+		`{% do x y %}`,
+	}
+	for _, source := range invalid {
+		if _, err := parse(t, source); err == nil {
+			t.Fatal("expected an error for", source)
+		}
+	}
+}
@@ -1,12 +1,144 @@
 package extensions
 
-import "github.com/gojinja/gojinja/src/nodes"
+import (
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"reflect"
+	"sort"
+)
 
+// IParser is the part of the parser available to extensions.
 type IParser interface {
 	Parse() (*nodes.Template, error)
+	// Stream returns the token stream being parsed.
+	Stream() *lexer.TokenStream
+	// ParseExpression parses an expression, conditional expressions are
+	// parsed only if withCondexpr is set.
+	ParseExpression(withCondexpr bool) (nodes.Expr, error)
+	// ParseTuple parses expressions separated by commas, into a tuple if
+	// there's more than one. Simplified tuples only contain names and
+	// literals, extraEndRules are the tokens ending the tuple besides the
+	// end of the tag, and explicitParentheses allows empty tuples.
+	ParseTuple(simplified bool, withCondexpr bool, extraEndRules []string, explicitParentheses bool) (nodes.Expr, error)
+	// ParseStatements parses the body of a block tag up to one of the end
+	// tokens (like "name:endtrans"), the end token is consumed if dropNeedle
+	// is set.
+	ParseStatements(endTokens []string, dropNeedle bool) ([]nodes.Node, error)
+	// FreeIdentifier returns a new name that can't collide with the names of
+	// the template, for the given line or the current one if lineno is nil.
+	FreeIdentifier(lineno *int) *nodes.InternalName
+	// Fail returns an error created by exc (a syntax error if it's nil) for
+	// the given line, or for the current token if lineno is nil.
+	Fail(msg string, lineno *int, exc func(msg string, lineno int, name *string, filename *string) error) error
+	// InLoop tells if the statement being parsed is in the body of a for
+	// loop, and not in a macro, a call block or a block defined inside it.
+	InLoop() bool
 }
 
+// IExtension adds custom tags to the template language. Parse is called with
+// the stream positioned on the name of one of the tags, it must consume
+// everything up to the `block_end` token of the tag.
+//
+// Extensions can implement Preprocessor, StreamFilter and Prioritized as
+// well, the environment package checks for the filters, tests and globals
+// they provide.
 type IExtension interface {
 	Tags() []string
 	Parse(p IParser) ([]nodes.Node, error)
 }
+
+// Preprocessor is implemented by extensions changing the source of the
+// templates before they are tokenized.
+type Preprocessor interface {
+	Preprocess(source string, name *string, filename *string) string
+}
+
+// StreamFilter is implemented by extensions changing the tokens of the
+// templates before they are parsed. Filters can wrap the tokens they read
+// from stream in a new stream with lexer.NewTokenStream.
+type StreamFilter interface {
+	FilterStream(stream *lexer.TokenStream) (*lexer.TokenStream, error)
+}
+
+// DefaultPriority is the priority of the extensions not implementing
+// Prioritized.
+const DefaultPriority = 100
+
+// Prioritized is implemented by extensions that must run before (lower
+// priority) or after (higher priority) the other ones.
+type Prioritized interface {
+	Priority() int
+}
+
+// Priority returns the priority of ext.
+func Priority(ext IExtension) int {
+	if p, ok := ext.(Prioritized); ok {
+		return p.Priority()
+	}
+	return DefaultPriority
+}
+
+// SortByPriority sorts the extensions by priority, keeping the order of the
+// extensions with the same priority. An extension overrides the tags of the
+// extensions before it.
+func SortByPriority(exts []IExtension) {
+	sort.SliceStable(exts, func(i, j int) bool {
+		return Priority(exts[i]) < Priority(exts[j])
+	})
+}
+
+// Preprocess runs the preprocessors of exts on source, in order.
+func Preprocess(exts []IExtension, source string, name *string, filename *string) string {
+	for _, ext := range exts {
+		if p, ok := ext.(Preprocessor); ok {
+			source = p.Preprocess(source, name, filename)
+		}
+	}
+	return source
+}
+
+// FilterStream passes stream through the stream filters of exts, in order.
+func FilterStream(exts []IExtension, stream *lexer.TokenStream) (*lexer.TokenStream, error) {
+	for _, ext := range exts {
+		if f, ok := ext.(StreamFilter); ok {
+			var err error
+			if stream, err = f.FilterStream(stream); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stream, nil
+}
+
+// Identifier returns the name identifying the type of ext, its package path
+// and its type name, which ExtensionAttribute nodes refer to.
+func Identifier(ext IExtension) string {
+	t := reflect.TypeOf(ext)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// Attr returns a node evaluating to the attribute name of ext when the
+// template is rendered, usually a method.
+func Attr(ext IExtension, name string, lineno int) *nodes.ExtensionAttribute {
+	return &nodes.ExtensionAttribute{
+		Identifier: Identifier(ext),
+		Name:       name,
+		ExprCommon: nodes.ExprCommon{Lineno: lineno},
+	}
+}
+
+// CallMethod returns a node calling the method name of ext when the
+// template is rendered, so extensions can call back into themselves.
+func CallMethod(ext IExtension, name string, args []nodes.Expr, kwargs []nodes.Keyword, dynArgs *nodes.Expr, dynKwargs *nodes.Expr, lineno int) *nodes.Call {
+	return &nodes.Call{
+		Node:       Attr(ext, name, lineno),
+		Args:       args,
+		Kwargs:     kwargs,
+		DynArgs:    dynArgs,
+		DynKwargs:  dynKwargs,
+		ExprCommon: nodes.ExprCommon{Lineno: lineno},
+	}
+}
@@ -0,0 +1,137 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+type messageKey struct {
+	context string
+	id      string
+}
+
+// Catalog holds the translated messages of a locale, read from a `.po` or
+// a `.mo` file. Messages without a translation are returned untranslated.
+type Catalog struct {
+	// Headers are the fields of the catalog header, like `Language` or `Plural-Forms`.
+	Headers  map[string]string
+	messages map[messageKey][]string
+	nplurals int
+	plural   pluralExpr
+}
+
+var _ Translations = &Catalog{}
+
+func newCatalog() *Catalog {
+	return &Catalog{
+		Headers:  make(map[string]string),
+		messages: make(map[messageKey][]string),
+		nplurals: 2,
+		plural:   germanicPlural,
+	}
+}
+
+// setHeader parses the translation of the empty msgid, the catalog header.
+func (c *Catalog) setHeader(header string) error {
+	for _, line := range strings.Split(header, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		c.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if pluralForms, ok := c.Headers["Plural-Forms"]; ok {
+		nplurals, plural, err := parsePluralForms(pluralForms)
+		if err != nil {
+			return err
+		}
+		c.nplurals, c.plural = nplurals, plural
+	}
+	return nil
+}
+
+// add adds a message, ignoring it if it isn't translated.
+func (c *Catalog) add(context string, id string, translations []string) {
+	for _, t := range translations {
+		if t == "" {
+			return
+		}
+	}
+	if len(translations) > 0 {
+		c.messages[messageKey{context, id}] = translations
+	}
+}
+
+// Len returns the number of translated messages.
+func (c *Catalog) Len() int {
+	return len(c.messages)
+}
+
+// lookup returns the translation of a message, selecting the plural form
+// for n if the message has a plural.
+func (c *Catalog) lookup(context string, id string, plural bool, n int) (string, bool) {
+	translations, ok := c.messages[messageKey{context, id}]
+	if !ok {
+		return "", false
+	}
+	if !plural {
+		return translations[0], true
+	}
+	idx := c.plural(int64(n))
+	if idx < 0 || idx >= int64(len(translations)) || idx >= int64(c.nplurals) {
+		return "", false
+	}
+	return translations[idx], true
+}
+
+func (c *Catalog) Gettext(message string) string {
+	return Chain{c}.Gettext(message)
+}
+
+func (c *Catalog) Ngettext(singular string, plural string, n int) string {
+	return Chain{c}.Ngettext(singular, plural, n)
+}
+
+func (c *Catalog) Pgettext(context string, message string) string {
+	return Chain{c}.Pgettext(context, message)
+}
+
+func (c *Catalog) Npgettext(context string, singular string, plural string, n int) string {
+	return Chain{c}.Npgettext(context, singular, plural, n)
+}
+
+// Chain translates with the first catalog having a translation of the
+// message, it implements locale fallbacks like `pt_BR` -> `pt`.
+type Chain []*Catalog
+
+var _ Translations = Chain{}
+
+func (ch Chain) Gettext(message string) string {
+	return ch.Pgettext("", message)
+}
+
+func (ch Chain) Ngettext(singular string, plural string, n int) string {
+	return ch.Npgettext("", singular, plural, n)
+}
+
+func (ch Chain) Pgettext(context string, message string) string {
+	for _, c := range ch {
+		if t, ok := c.lookup(context, message, false, 0); ok {
+			return t
+		}
+	}
+	return message
+}
+
+func (ch Chain) Npgettext(context string, singular string, plural string, n int) string {
+	for _, c := range ch {
+		if t, ok := c.lookup(context, singular, true, n); ok {
+			return t
+		}
+	}
+	return NullTranslations{}.Ngettext(singular, plural, n)
+}
+
+func (c *Catalog) String() string {
+	return fmt.Sprintf("<Catalog %s: %d messages>", c.Headers["Language"], len(c.messages))
+}
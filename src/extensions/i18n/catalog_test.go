@@ -0,0 +1,272 @@
+package i18n
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const polishPO = `# Polish translations.
+msgid ""
+msgstr ""
+"Language: pl\n"
+"Plural-Forms: nplurals=3; plural=(n==1 ? 0 : n%10>=2 && n%10<=4 && "
+"(n%100<10 || n%100>=20) ? 1 : 2);\n"
+
+#. Translators: the greeting of the home page
+#: templates/index.html:3
+msgid "Hello %(user)s!"
+msgstr "Cześć %(user)s!"
+
+msgctxt "menu"
+msgid "Open"
+msgstr "Otwórz"
+
+msgid "%(num)s apple"
+msgid_plural "%(num)s apples"
+msgstr[0] "%(num)s jabłko"
+msgstr[1] "%(num)s jabłka"
+msgstr[2] "%(num)s jabłek"
+
+#, fuzzy
+msgid "Goodbye"
+msgstr "Do widzenia"
+
+msgid "Untranslated"
+msgstr ""
+
+msgid "Multi"
+"line"
+msgstr "Wiele"
+" linii\n"
+#~ msgid "Obsolete"
+#~ msgstr "Przestarzałe"
+`
+
+func TestParsePO(t *testing.T) {
+	c, err := ParsePO(strings.NewReader(polishPO))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Headers["Language"] != "pl" {
+		t.Fatal("unexpected headers", c.Headers)
+	}
+	if c.Len() != 4 {
+		t.Fatal("expected 4 translated messages, got", c.Len())
+	}
+
+	cases := []struct {
+		res, expected string
+	}{
+		{c.Gettext("Hello %(user)s!"), "Cześć %(user)s!"},
+		{c.Gettext("Open"), "Open"},
+		{c.Pgettext("menu", "Open"), "Otwórz"},
+		{c.Gettext("Goodbye"), "Goodbye"},
+		{c.Gettext("Untranslated"), "Untranslated"},
+		{c.Gettext("Multiline"), "Wiele linii\n"},
+		{c.Gettext("Obsolete"), "Obsolete"},
+		{c.Ngettext("%(num)s apple", "%(num)s apples", 1), "%(num)s jabłko"},
+		{c.Ngettext("%(num)s apple", "%(num)s apples", 3), "%(num)s jabłka"},
+		{c.Ngettext("%(num)s apple", "%(num)s apples", 5), "%(num)s jabłek"},
+		{c.Ngettext("%(num)s apple", "%(num)s apples", 22), "%(num)s jabłka"},
+		{c.Ngettext("%(num)s apple", "%(num)s apples", 12), "%(num)s jabłek"},
+		{c.Ngettext("%(num)s pear", "%(num)s pears", 1), "%(num)s pear"},
+		{c.Ngettext("%(num)s pear", "%(num)s pears", 2), "%(num)s pears"},
+	}
+	for _, c := range cases {
+		if c.res != c.expected {
+			t.Fatal("expected", c.expected, "got", c.res)
+		}
+	}
+}
+
+func TestParsePOErrors(t *testing.T) {
+	for _, source := range []string{
+		`msgid "a"` + "\n\n",
+		`msgid "a`,
+		`msgid "a"` + "\nmsgtxt \"b\"",
+		`"a"`,
+		"msgid \"\"\nmsgstr \"Plural-Forms: nplurals=2; plural=n +;\\n\"",
+	} {
+		if _, err := ParsePO(strings.NewReader(source)); err == nil {
+			t.Fatal("expected an error for", source)
+		}
+	}
+}
+
+func TestPluralForms(t *testing.T) {
+	cases := []struct {
+		header  string
+		results map[int64]int64
+	}{
+		{"nplurals=2; plural=(n != 1);", map[int64]int64{0: 1, 1: 0, 2: 1}},
+		{"nplurals=1; plural=0;", map[int64]int64{1: 0, 5: 0}},
+		{"nplurals=2; plural=n>1;", map[int64]int64{0: 0, 1: 0, 2: 1}},
+		{
+			"nplurals=6; plural=n==0 ? 0 : n==1 ? 1 : n==2 ? 2 : n%100>=3 && n%100<=10 ? 3 : n%100>=11 ? 4 : 5;",
+			map[int64]int64{0: 0, 1: 1, 2: 2, 5: 3, 11: 4, 100: 5, 102: 5},
+		},
+		{"nplurals=2; plural=!(n == 1);", map[int64]int64{1: 0, 3: 1}},
+		{"nplurals=2; plural=n / 0 + n % 0;", map[int64]int64{7: 0}},
+		{"nplurals=2; plural=(n - 1) * 2 + 1 < 3;", map[int64]int64{1: 1, 2: 0}},
+	}
+	for _, c := range cases {
+		_, plural, err := parsePluralForms(c.header)
+		if err != nil {
+			t.Fatal(c.header, err)
+		}
+		for n, expected := range c.results {
+			if res := plural(n); res != expected {
+				t.Fatal(c.header, "for", n, "expected", expected, "got", res)
+			}
+		}
+	}
+
+	for _, header := range []string{
+		"nplurals=2;",
+		"plural=n != 1;",
+		"nplurals=x; plural=0;",
+		"nplurals=2; plural=(n != 1;",
+		"nplurals=2; plural=n != 1 ? 0;",
+		"nplurals=2; plural=__import__('os');",
+		"nplurals=2; plural=" + strings.Repeat("(", 2000) + "n" + strings.Repeat(")", 2000) + ";",
+	} {
+		if _, _, err := parsePluralForms(header); err == nil {
+			t.Fatal("expected an error for", header)
+		}
+	}
+}
+
+// writeMO writes a `.mo` file with the given messages, like msgfmt.
+func writeMO(messages map[string]string, order binary.ByteOrder) []byte {
+	keys := make([]string, 0, len(messages))
+	for k := range messages {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	const headerSize = 28
+	n := uint32(len(keys))
+	originals := uint32(headerSize)
+	translations := originals + 8*n
+	offset := translations + 8*n
+
+	var tables, strs bytes.Buffer
+	var transTable bytes.Buffer
+	put := func(buf *bytes.Buffer, s string) {
+		_ = binary.Write(buf, order, uint32(len(s)))
+		_ = binary.Write(buf, order, offset+uint32(strs.Len()))
+		strs.WriteString(s)
+		strs.WriteByte(0)
+	}
+	for _, k := range keys {
+		put(&tables, k)
+	}
+	for _, k := range keys {
+		put(&transTable, messages[k])
+	}
+
+	var out bytes.Buffer
+	for _, v := range []uint32{0x950412de, 0, n, originals, translations, 0, 0} {
+		_ = binary.Write(&out, order, v)
+	}
+	out.Write(tables.Bytes())
+	out.Write(transTable.Bytes())
+	out.Write(strs.Bytes())
+	return out.Bytes()
+}
+
+var frenchMessages = map[string]string{
+	"":                                "Language: fr\nPlural-Forms: nplurals=2; plural=(n > 1);\n",
+	"Hello":                           "Bonjour",
+	"menu\x04Open":                    "Ouvrir",
+	"%(num)s apple\x00%(num)s apples": "%(num)s pomme\x00%(num)s pommes",
+}
+
+func TestParseMO(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		c, err := ParseMO(writeMO(frenchMessages, order))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Headers["Language"] != "fr" {
+			t.Fatal("unexpected headers", c.Headers)
+		}
+		if c.Gettext("Hello") != "Bonjour" || c.Pgettext("menu", "Open") != "Ouvrir" {
+			t.Fatal("unexpected translations")
+		}
+		if c.Ngettext("%(num)s apple", "%(num)s apples", 0) != "%(num)s pomme" ||
+			c.Npgettext("", "%(num)s apple", "%(num)s apples", 2) != "%(num)s pommes" {
+			t.Fatal("unexpected plural translations")
+		}
+	}
+
+	data := writeMO(frenchMessages, binary.LittleEndian)
+	for _, invalid := range [][]byte{nil, []byte("not a mo file at all"), data[:len(data)-20]} {
+		if _, err := ParseMO(invalid); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+}
+
+func TestLocaleChain(t *testing.T) {
+	cases := map[string]string{
+		"pt_BR":       "pt_BR pt",
+		"pt-BR.UTF-8": "pt_BR pt",
+		"sr_RS@latin": "sr_RS sr",
+		"de":          "de",
+		"":            "",
+	}
+	for locale, expected := range cases {
+		if chain := strings.Join(LocaleChain(locale), " "); chain != expected {
+			t.Fatal("expected", expected, "for", locale, "got", chain)
+		}
+	}
+}
+
+func TestLoader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pt_BR/LC_MESSAGES/messages.po": {Data: []byte("msgid \"Hello\"\nmsgstr \"Oi\"\n")},
+		"pt/LC_MESSAGES/messages.po":    {Data: []byte("msgid \"Hello\"\nmsgstr \"Olá\"\n\nmsgid \"Bye\"\nmsgstr \"Tchau\"\n")},
+		"fr/LC_MESSAGES/messages.mo":    {Data: writeMO(frenchMessages, binary.LittleEndian)},
+		"en/LC_MESSAGES/messages.po":    {Data: []byte("msgid \"Thanks\"\nmsgstr \"Thank you\"\n")},
+		"xx/LC_MESSAGES/messages.po":    {Data: []byte("msgid \"Hello\"\n")},
+	}
+	loader := NewLoader(fsys, "messages")
+	loader.DefaultLocale = "en"
+
+	cases := []struct {
+		locale, message, expected string
+	}{
+		{"pt_BR", "Hello", "Oi"},
+		{"pt_BR", "Bye", "Tchau"},
+		{"pt_BR", "Thanks", "Thank you"},
+		{"pt_PT", "Hello", "Olá"},
+		{"fr_CA", "Hello", "Bonjour"},
+		{"de", "Hello", "Hello"},
+		{"de", "Thanks", "Thank you"},
+	}
+	for _, c := range cases {
+		translations, err := loader.Translations(c.locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res := translations.Gettext(c.message); res != c.expected {
+			t.Fatal("expected", c.expected, "for", c.message, "in", c.locale, "got", res)
+		}
+	}
+
+	if _, err := loader.Translations("xx"); err == nil || !strings.Contains(err.Error(), "xx/LC_MESSAGES/messages.po") {
+		t.Fatal("expected an error naming the broken catalog, got", err)
+	}
+
+	// the catalogs plug into the gettext globals
+	translations, _ := loader.Translations("pt_BR")
+	res, err := Globals(translations)["gettext"].(gettextFunc).Call([]any{"Bye"}, nil)
+	if err != nil || res != "Tchau" {
+		t.Fatal("unexpected translation", res, err)
+	}
+}
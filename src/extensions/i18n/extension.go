@@ -0,0 +1,321 @@
+// Package i18n provides the internationalization extension: the
+// `{% trans %}` tag and the gettext globals translating strings with a
+// Translations implementation.
+package i18n
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"regexp"
+	"strings"
+)
+
+// Extension adds the `{% trans %}` tag. Translation blocks are compiled to
+// calls of the `gettext`, `ngettext`, `pgettext` and `npgettext` globals
+// with the variables of the block as keyword arguments (the "newstyle"
+// gettext of Jinja), see Globals for the functions to render them with.
+type Extension struct {
+	env *environment.Environment
+}
+
+var _ extensions.IExtension = &Extension{}
+
+// New creates the extension, it's meant to be used in `EnvOpts.Extensions`:
+//
+//	opts.Extensions = map[string]func(*environment.Environment) extensions.IExtension{"i18n": i18n.New}
+func New(env *environment.Environment) extensions.IExtension {
+	return &Extension{env: env}
+}
+
+// Install makes the environment translate with t, for environments serving
+// a single locale. Environments serving many locales should pass the
+// result of Globals to each render instead.
+func (e *Extension) Install(t Translations) {
+	for k, v := range Globals(t) {
+		e.env.Globals[k] = v
+	}
+}
+
+// Uninstall removes the translation functions from the environment.
+func (e *Extension) Uninstall() {
+	for k := range Globals(nil) {
+		delete(e.env.Globals, k)
+	}
+}
+
+func (e *Extension) Tags() []string {
+	return []string{"trans"}
+}
+
+// variable is a variable of a trans block, they are kept in the order they
+// were declared.
+type variable struct {
+	name  string
+	value nodes.Expr
+}
+
+type variables []variable
+
+func (vs variables) get(name string) (nodes.Expr, bool) {
+	for _, v := range vs {
+		if v.name == name {
+			return v.value, true
+		}
+	}
+	return nil, false
+}
+
+func (vs variables) set(name string, value nodes.Expr) variables {
+	for i, v := range vs {
+		if v.name == name {
+			vs[i].value = value
+			return vs
+		}
+	}
+	return append(vs, variable{name, value})
+}
+
+func name(n string, ctx string) *nodes.Name {
+	return &nodes.Name{Name: n, Ctx: ctx}
+}
+
+// Parse parses a translatable section:
+//
+//	{% trans [context] [trimmed|notrimmed] [name[=expr], ...] %}...[{% pluralize [name] %}...]{% endtrans %}
+func (e *Extension) Parse(p extensions.IParser) ([]nodes.Node, error) {
+	stream := p.Stream()
+	lineno := stream.Next().Lineno
+
+	var context *string
+	if token := stream.NextIf(lexer.TokenString); token != nil {
+		c := token.Value.(string)
+		context = &c
+	}
+
+	var pluralExpr nodes.Expr
+	var pluralExprAssignment *nodes.Assign
+	var vars variables
+	var trimmed *bool
+	numCalledNum := false
+
+	for stream.Current().Type != lexer.TokenBlockEnd {
+		if len(vars) > 0 {
+			if _, err := stream.Expect(lexer.TokenComma); err != nil {
+				return nil, err
+			}
+		}
+		// skip colon for python compatibility
+		if stream.SkipIf(lexer.TokenColon) {
+			break
+		}
+		token, err := stream.Expect(lexer.TokenName)
+		if err != nil {
+			return nil, err
+		}
+		varName := token.Value.(string)
+		if _, ok := vars.get(varName); ok {
+			return nil, p.Fail(fmt.Sprintf("translatable variable '%s' defined twice.", varName), &token.Lineno, errors.TemplateAssertionError)
+		}
+
+		var value nodes.Expr
+		if stream.Current().Type == lexer.TokenAssign {
+			stream.Next()
+			if value, err = p.ParseExpression(true); err != nil {
+				return nil, err
+			}
+		} else if trimmed == nil && (varName == "trimmed" || varName == "notrimmed") {
+			t := varName == "trimmed"
+			trimmed = &t
+			continue
+		} else {
+			value = name(varName, "load")
+		}
+		vars = vars.set(varName, value)
+
+		if pluralExpr == nil {
+			if call, ok := value.(*nodes.Call); ok {
+				// the count is evaluated once, before the translation
+				pluralExpr = name("_trans", "load")
+				vars = vars.set(varName, pluralExpr)
+				pluralExprAssignment = &nodes.Assign{
+					Target:     name("_trans", "store"),
+					Node:       call,
+					StmtCommon: nodes.StmtCommon{Lineno: lineno},
+				}
+			} else {
+				pluralExpr = value
+			}
+			numCalledNum = varName == "num"
+		}
+	}
+	if _, err := stream.Expect(lexer.TokenBlockEnd); err != nil {
+		return nil, err
+	}
+
+	referenced, singular, err := e.parseBlock(p, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(referenced) > 0 && pluralExpr == nil {
+		pluralExpr = name(referenced[0], "load")
+		numCalledNum = referenced[0] == "num"
+	}
+
+	var plural string
+	havePlural := false
+	if stream.Current().Test("name:pluralize") {
+		havePlural = true
+		stream.Next()
+		if stream.Current().Type != lexer.TokenBlockEnd {
+			token, err := stream.Expect(lexer.TokenName)
+			if err != nil {
+				return nil, err
+			}
+			varName := token.Value.(string)
+			value, ok := vars.get(varName)
+			if !ok {
+				return nil, p.Fail(fmt.Sprintf("unknown variable '%s' for pluralization", varName), &token.Lineno, errors.TemplateAssertionError)
+			}
+			pluralExpr = value
+			numCalledNum = varName == "num"
+		}
+		if _, err := stream.Expect(lexer.TokenBlockEnd); err != nil {
+			return nil, err
+		}
+		var pluralNames []string
+		pluralNames, plural, err = e.parseBlock(p, false)
+		if err != nil {
+			return nil, err
+		}
+		referenced = append(referenced, pluralNames...)
+	}
+	// skip the `endtrans` name, the parser expects the block end
+	stream.Next()
+
+	// register free names as simple name expressions
+	for _, n := range referenced {
+		if _, ok := vars.get(n); !ok {
+			vars = vars.set(n, name(n, "load"))
+		}
+	}
+
+	if !havePlural {
+		pluralExpr = nil
+	} else if pluralExpr == nil {
+		return nil, p.Fail("pluralize without variables", &lineno, nil)
+	}
+
+	if trimmed == nil {
+		t, _ := e.env.Policies["ext.i18n.trimmed"].(bool)
+		trimmed = &t
+	}
+	if *trimmed {
+		singular = trimWhitespace(singular)
+		plural = trimWhitespace(plural)
+	}
+
+	node := makeNode(singular, plural, context, vars, pluralExpr, numCalledNum && havePlural, lineno)
+	if pluralExprAssignment != nil {
+		return []nodes.Node{pluralExprAssignment, node}, nil
+	}
+	return []nodes.Node{node}, nil
+}
+
+var whitespaceRe = regexp.MustCompile(`\s*\n\s*`)
+
+func trimWhitespace(s string) string {
+	return whitespaceRe.ReplaceAllString(strings.TrimSpace(s), " ")
+}
+
+// parseBlock parses the body of a translatable section up to the
+// `pluralize` or `endtrans` tag, leaving the stream on the name of the tag.
+// It returns the names of the referenced variables and the message, in
+// which the variables are replaced by `%(name)s` placeholders.
+func (e *Extension) parseBlock(p extensions.IParser, allowPluralize bool) ([]string, string, error) {
+	stream := p.Stream()
+	var referenced []string
+	var buf strings.Builder
+
+	for {
+		current := stream.Current()
+		switch {
+		case current.Type == lexer.TokenData:
+			buf.WriteString(strings.ReplaceAll(current.Value.(string), "%", "%%"))
+			stream.Next()
+		case current.Type == lexer.TokenVariableBegin:
+			stream.Next()
+			token, err := stream.Expect(lexer.TokenName)
+			if err != nil {
+				return nil, "", err
+			}
+			varName := token.Value.(string)
+			referenced = append(referenced, varName)
+			buf.WriteString("%(" + varName + ")s")
+			if _, err := stream.Expect(lexer.TokenVariableEnd); err != nil {
+				return nil, "", err
+			}
+		case current.Type == lexer.TokenBlockBegin:
+			stream.Next()
+			var blockName any
+			if stream.Current().Type == lexer.TokenName {
+				blockName = stream.Current().Value
+			}
+			switch blockName {
+			case "endtrans":
+				return referenced, buf.String(), nil
+			case "pluralize":
+				if allowPluralize {
+					return referenced, buf.String(), nil
+				}
+				return nil, "", p.Fail("a translatable section can have only one pluralize section", nil, nil)
+			case "trans":
+				return nil, "", p.Fail("trans blocks can't be nested; did you mean `endtrans`?", nil, nil)
+			}
+			return nil, "", p.Fail(fmt.Sprintf("control structures in translatable sections are not allowed; saw `%v`", blockName), nil, nil)
+		case stream.Eos():
+			return nil, "", p.Fail("unclosed translation block", nil, nil)
+		default:
+			return nil, "", p.Fail("internal parser error", nil, nil)
+		}
+	}
+}
+
+// makeNode creates the output node calling the gettext function matching
+// the section.
+func makeNode(singular string, plural string, context *string, vars variables, pluralExpr nodes.Expr, numCalledNum bool, lineno int) nodes.Node {
+	funcName := "gettext"
+	args := []nodes.Expr{&nodes.Const{Value: singular, LiteralCommon: nodes.LiteralCommon{Lineno: lineno}}}
+	if context != nil {
+		args = append([]nodes.Expr{&nodes.Const{Value: *context, LiteralCommon: nodes.LiteralCommon{Lineno: lineno}}}, args...)
+		funcName = "p" + funcName
+	}
+	if pluralExpr != nil {
+		funcName = "n" + funcName
+		args = append(args, &nodes.Const{Value: plural, LiteralCommon: nodes.LiteralCommon{Lineno: lineno}}, pluralExpr)
+	}
+
+	call := &nodes.Call{
+		Node:       &nodes.Name{Name: funcName, Ctx: "load", ExprCommon: nodes.ExprCommon{Lineno: lineno}},
+		Args:       args,
+		ExprCommon: nodes.ExprCommon{Lineno: lineno},
+	}
+	for _, v := range vars {
+		// the function adds `num` itself, no need to pass it twice
+		if numCalledNum && v.name == "num" {
+			continue
+		}
+		call.Kwargs = append(call.Kwargs, nodes.Keyword{
+			Key:          v.name,
+			Value:        v.value,
+			HelperCommon: nodes.HelperCommon{Lineno: lineno},
+		})
+	}
+	return &nodes.Output{
+		Nodes:      []nodes.Expr{call},
+		StmtCommon: nodes.StmtCommon{Lineno: lineno},
+	}
+}
@@ -0,0 +1,160 @@
+package i18n
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/parser"
+	"golang.org/x/exp/maps"
+	"strings"
+	"testing"
+)
+
+func newEnv(t *testing.T) *environment.Environment {
+	opts := environment.DefaultEnvOpts()
+	opts.Extensions = map[string]func(*environment.Environment) extensions.IExtension{"i18n": New}
+	env, err := environment.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func parse(t *testing.T, env *environment.Environment, source string) (*nodes.Template, error) {
+	t.Helper()
+	stream, err := lexer.GetLexer(env.EnvLexerInformation).Tokenize(source, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parser.NewParser(stream, maps.Values(env.Extensions), nil, nil, nil).Parse()
+}
+
+// describeCall describes the gettext call of a trans block like
+// `ngettext("%(num)s apple", "%(num)s apples", count) user=user`.
+func describeCall(t *testing.T, node nodes.Node) string {
+	t.Helper()
+	output, ok := node.(*nodes.Output)
+	if !ok || len(output.Nodes) != 1 {
+		t.Fatalf("expected an output node, got %#v", node)
+	}
+	call := output.Nodes[0].(*nodes.Call)
+	var args []string
+	for _, arg := range call.Args {
+		args = append(args, describeExpr(arg))
+	}
+	desc := call.Node.(*nodes.Name).Name + "(" + strings.Join(args, ", ") + ")"
+	for _, kw := range call.Kwargs {
+		desc += " " + kw.Key + "=" + describeExpr(kw.Value)
+	}
+	return desc
+}
+
+func describeExpr(expr nodes.Expr) string {
+	switch e := expr.(type) {
+	case *nodes.Const:
+		return `"` + e.Value.(string) + `"`
+	case *nodes.Name:
+		return e.Name
+	case *nodes.Call:
+		return e.Node.(*nodes.Name).Name + "()"
+	default:
+		return "?"
+	}
+}
+
+func TestTrans(t *testing.T) {
+	cases := []struct {
+		source string
+		call   string
+	}{
+		{`{% trans %}Hello{% endtrans %}`, `gettext("Hello")`},
+		{`{% trans %}Hello {{ user }}!{% endtrans %}`, `gettext("Hello %(user)s!") user=user`},
+		{`{% trans %}100% sure{% endtrans %}`, `gettext("100%% sure")`},
+		{`{% trans name=user.name %}Hi {{ name }}{% endtrans %}`, `gettext("Hi %(name)s") name=?`},
+		{
+			`{% trans count=items|length %}{{ count }} item{% pluralize %}{{ count }} items{% endtrans %}`,
+			`ngettext("%(count)s item", "%(count)s items", ?) count=?`,
+		},
+		{
+			`{% trans %}{{ num }} apple{% pluralize %}{{ num }} apples{% endtrans %}`,
+			`ngettext("%(num)s apple", "%(num)s apples", num)`,
+		},
+		{
+			`{% trans user, count %}{{ user }} has {{ count }} item{% pluralize count %}{{ user }} has {{ count }} items{% endtrans %}`,
+			`ngettext("%(user)s has %(count)s item", "%(user)s has %(count)s items", count) user=user count=count`,
+		},
+		{`{% trans "menu" %}Open{% endtrans %}`, `pgettext("menu", "Open")`},
+		{
+			`{% trans "fruit" %}{{ num }} apple{% pluralize %}{{ num }} apples{% endtrans %}`,
+			`npgettext("fruit", "%(num)s apple", "%(num)s apples", num)`,
+		},
+		{"{% trans trimmed %}\n  Hello\n    world\n{% endtrans %}", `gettext("Hello world")`},
+		{"{% trans notrimmed %} a\n b {% endtrans %}", "gettext(\" a\n b \")"},
+	}
+
+	env := newEnv(t)
+	for _, c := range cases {
+		template, err := parse(t, env, c.source)
+		if err != nil {
+			t.Fatal(c.source, err)
+		}
+		if len(template.Body) != 1 {
+			t.Fatal("expected a single node for", c.source, "got", template.Body)
+		}
+		if desc := describeCall(t, template.Body[0]); desc != c.call {
+			t.Fatal("expected", c.call, "got", desc)
+		}
+	}
+}
+
+func TestTransCountCall(t *testing.T) {
+	template, err := parse(t, newEnv(t), `{% trans n=items.count() %}one{% pluralize %}many{% endtrans %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(template.Body) != 2 {
+		t.Fatal("expected the count to be assigned before the output, got", template.Body)
+	}
+	if assign, ok := template.Body[0].(*nodes.Assign); !ok || assign.Target.(*nodes.Name).Name != "_trans" {
+		t.Fatalf("expected an assignment to _trans, got %#v", template.Body[0])
+	}
+	if desc := describeCall(t, template.Body[1]); desc != `ngettext("one", "many", _trans) n=_trans` {
+		t.Fatal("unexpected call", desc)
+	}
+}
+
+func TestTrimmedPolicy(t *testing.T) {
+	env := newEnv(t)
+	env.Policies["ext.i18n.trimmed"] = true
+	template, err := parse(t, env, "{% trans %}\n  Hello\n{% endtrans %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc := describeCall(t, template.Body[0]); desc != `gettext("Hello")` {
+		t.Fatal("the policy should trim the message, got", desc)
+	}
+}
+
+func TestTransErrors(t *testing.T) {
+	cases := []struct {
+		source string
+		err    string
+	}{
+		{`{% trans %}{% if x %}{% endif %}{% endtrans %}`, "control structures in translatable sections are not allowed; saw `if`"},
+		{`{% trans %}{% trans %}{% endtrans %}`, "trans blocks can't be nested"},
+		{`{% trans %}a{% pluralize %}b{% endtrans %}`, "pluralize without variables"},
+		{`{% trans x %}{{ x }}{% pluralize %}{% pluralize %}{% endtrans %}`, "only one pluralize section"},
+		{`{% trans x, x %}{% endtrans %}`, "translatable variable 'x' defined twice"},
+		{`{% trans x %}{% pluralize y %}{% endtrans %}`, "unknown variable 'y' for pluralization"},
+		{`{% trans %}{{ x.y }}{% endtrans %}`, "expected token 'end of print statement'"},
+		{`{% trans %}hello`, "unclosed translation block"},
+	}
+	env := newEnv(t)
+	for _, c := range cases {
+		_, err := parse(t, env, c.source)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatal("expected", c.err, "for", c.source, "got", err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package i18n
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"sort"
+	"strings"
+)
+
+// Keyword tells which arguments of a gettext function are the parts of the
+// message, by their position. Context and Plural are -1 if the function
+// doesn't take them.
+type Keyword struct {
+	Context int
+	ID      int
+	Plural  int
+}
+
+// DefaultKeywords are the translation functions extracted by default, they
+// match the functions of Globals. `trans` blocks are compiled to calls of
+// these functions, so they are extracted as well.
+var DefaultKeywords = map[string]Keyword{
+	"_":         {Context: -1, ID: 0, Plural: -1},
+	"gettext":   {Context: -1, ID: 0, Plural: -1},
+	"ngettext":  {Context: -1, ID: 0, Plural: 1},
+	"pgettext":  {Context: 0, ID: 1, Plural: -1},
+	"npgettext": {Context: 0, ID: 1, Plural: 2},
+}
+
+// DefaultCommentTags are the prefixes of the template comments extracted as
+// comments for the translators.
+var DefaultCommentTags = []string{"Translators:"}
+
+// Location is where a message was found.
+type Location struct {
+	Filename string
+	Lineno   int
+}
+
+// Message is a translatable message extracted from templates.
+type Message struct {
+	Context *string
+	ID      string
+	Plural  *string
+	// Locations are where the message is used, in the order they were found.
+	Locations []Location
+	// Comments are the comments for the translators preceding the message.
+	Comments []string
+}
+
+// ExtractOptions configure Extract, the zero value uses DefaultKeywords and
+// DefaultCommentTags.
+type ExtractOptions struct {
+	Keywords    map[string]Keyword
+	CommentTags []string
+}
+
+// Extract returns the translatable messages of a template, in the order of
+// their lines: the constant strings passed to the gettext functions (trans
+// blocks included), with the comments starting with one of the comment tags
+// on the line of the message or just before it. Calls whose message isn't a
+// constant string are skipped. The template is parsed with the extensions of
+// env, which needs the i18n extension for templates with trans blocks.
+func Extract(env *environment.Environment, source string, filename string, opts ExtractOptions) ([]Message, error) {
+	keywords := opts.Keywords
+	if keywords == nil {
+		keywords = DefaultKeywords
+	}
+	commentTags := opts.CommentTags
+	if commentTags == nil {
+		commentTags = DefaultCommentTags
+	}
+
+	tokens, err := env.Lex(env.Preprocess(source, nil, &filename), nil, &filename)
+	if err != nil {
+		return nil, err
+	}
+	template, err := env.Parse(source, nil, &filename)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := nodes.FindAll[*nodes.Call](template)
+	sort.SliceStable(calls, func(i, j int) bool {
+		return calls[i].Lineno < calls[j].Lineno
+	})
+
+	finder := &commentFinder{tokens: tokens, tags: commentTags}
+	var messages []Message
+	for _, call := range calls {
+		name, ok := call.Node.(*nodes.Name)
+		if !ok {
+			continue
+		}
+		keyword, ok := keywords[name.Name]
+		if !ok {
+			continue
+		}
+		id, ok := constArg(call, keyword.ID)
+		if !ok {
+			continue
+		}
+		msg := Message{ID: *id, Locations: []Location{{filename, call.Lineno}}}
+		if keyword.Context >= 0 {
+			if msg.Context, ok = constArg(call, keyword.Context); !ok {
+				continue
+			}
+		}
+		if keyword.Plural >= 0 {
+			if msg.Plural, ok = constArg(call, keyword.Plural); !ok {
+				continue
+			}
+		}
+		msg.Comments = finder.find(call.Lineno)
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// constArg returns the argument at idx if it's a constant string.
+func constArg(call *nodes.Call, idx int) (*string, bool) {
+	if idx >= len(call.Args) {
+		return nil, false
+	}
+	c, ok := call.Args[idx].(*nodes.Const)
+	if !ok {
+		return nil, false
+	}
+	s, ok := c.Value.(string)
+	return &s, ok
+}
+
+// commentFinder finds the translator comments of messages, it must be
+// called with increasing line numbers.
+type commentFinder struct {
+	tokens     []lexer.Token
+	tags       []string
+	offset     int
+	lastLineno int
+}
+
+// find returns the last translator comment between the previous message
+// and the end of the given line.
+func (f *commentFinder) find(lineno int) []string {
+	if len(f.tags) == 0 || f.lastLineno > lineno {
+		return nil
+	}
+	f.lastLineno = lineno
+	end := len(f.tokens)
+	for idx := f.offset; idx < len(f.tokens); idx++ {
+		if f.tokens[idx].Lineno > lineno {
+			end = idx
+			break
+		}
+	}
+	defer func() { f.offset = end }()
+
+	for idx := end - 1; idx >= f.offset; idx-- {
+		token := f.tokens[idx]
+		if token.Type != lexer.TokenComment && token.Type != lexer.TokenLinecomment {
+			continue
+		}
+		fields := strings.Fields(token.Value.(string))
+		if len(fields) < 2 {
+			continue
+		}
+		for _, tag := range f.tags {
+			if fields[0] == tag {
+				comment := strings.TrimSpace(token.Value.(string))
+				comment = strings.TrimSpace(comment[len(tag):])
+				return []string{comment}
+			}
+		}
+	}
+	return nil
+}
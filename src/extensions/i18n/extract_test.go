@@ -0,0 +1,122 @@
+package i18n
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const extractSource = `{# Translators: shown on the home page #}
+<h1>{{ _("Welcome") }}</h1>
+{# a regular comment #}
+<p>{{ gettext("Hello %(user)s!", user=user) }}</p>
+{{ ngettext("%(num)s apple", "%(num)s apples", count) }}
+{{ pgettext("menu", "Open") }} {{ gettext(variable) }} {{ other("Ignored") }}
+{# Translators: the number of items
+   in the basket #}
+{% trans count=items|length %}{{ count }} item{% pluralize %}{{ count }} items{% endtrans %}
+{% if x %}{% trans "verb" %}Open{% endtrans %}{% endif %}
+{{ _("Welcome") }}
+`
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestExtract(t *testing.T) {
+	messages, err := Extract(newEnv(t), extractSource, "index.html", ExtractOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc := func(lineno int) []Location {
+		return []Location{{"index.html", lineno}}
+	}
+	expected := []Message{
+		{ID: "Welcome", Locations: loc(2), Comments: []string{"shown on the home page"}},
+		{ID: "Hello %(user)s!", Locations: loc(4)},
+		{ID: "%(num)s apple", Plural: strPtr("%(num)s apples"), Locations: loc(5)},
+		{Context: strPtr("menu"), ID: "Open", Locations: loc(6)},
+		{ID: "%(count)s item", Plural: strPtr("%(count)s items"), Locations: loc(9), Comments: []string{"the number of items\n   in the basket"}},
+		{Context: strPtr("verb"), ID: "Open", Locations: loc(10)},
+		{ID: "Welcome", Locations: loc(11)},
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, messages)
+	}
+}
+
+func TestWritePOT(t *testing.T) {
+	messages, err := Extract(newEnv(t), extractSource, "index.html", ExtractOptions{CommentTags: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages = append(messages, Message{ID: "Two\nlines \"quoted\"", Locations: []Location{{"other.html", 3}}})
+
+	var buf bytes.Buffer
+	if err = WritePOT(&buf, MergeMessages(messages), POTOptions{Project: "shop", Version: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# Translations template for shop.
+#
+#, fuzzy
+msgid ""
+msgstr ""
+"Project-Id-Version: shop 1.0\n"
+"Report-Msgid-Bugs-To: \n"
+"MIME-Version: 1.0\n"
+"Content-Type: text/plain; charset=utf-8\n"
+"Content-Transfer-Encoding: 8bit\n"
+"Generated-By: gojinja\n"
+
+#: index.html:2 index.html:11
+msgid "Welcome"
+msgstr ""
+
+#: index.html:4
+#, python-format
+msgid "Hello %(user)s!"
+msgstr ""
+
+#: index.html:5
+#, python-format
+msgid "%(num)s apple"
+msgid_plural "%(num)s apples"
+msgstr[0] ""
+msgstr[1] ""
+
+#: index.html:6
+msgctxt "menu"
+msgid "Open"
+msgstr ""
+
+#: index.html:9
+#, python-format
+msgid "%(count)s item"
+msgid_plural "%(count)s items"
+msgstr[0] ""
+msgstr[1] ""
+
+#: index.html:10
+msgctxt "verb"
+msgid "Open"
+msgstr ""
+
+#: other.html:3
+msgid ""
+"Two\n"
+"lines \"quoted\""
+msgstr ""
+`
+	if buf.String() != expected {
+		t.Fatal("unexpected catalog:\n" + buf.String())
+	}
+
+	// the catalog is a valid po file
+	c, err := ParsePO(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Headers["Project-Id-Version"] != "shop 1.0" {
+		t.Fatal("unexpected headers", c.Headers)
+	}
+}
@@ -0,0 +1,127 @@
+package i18n
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Loader loads the catalogs of a gettext domain from the usual directory
+// layout, `<locale>/LC_MESSAGES/<domain>.mo` (or `.po`), and caches them.
+type Loader struct {
+	fsys   fs.FS
+	domain string
+	// DefaultLocale is the last locale of every fallback chain, if it's set.
+	DefaultLocale string
+
+	mu       sync.Mutex
+	catalogs map[string]*Catalog
+}
+
+// NewLoader creates a loader reading the catalogs of domain from fsys.
+func NewLoader(fsys fs.FS, domain string) *Loader {
+	return &Loader{fsys: fsys, domain: domain, catalogs: make(map[string]*Catalog)}
+}
+
+// NewDirLoader creates a loader reading the catalogs of domain from the
+// directory dir.
+func NewDirLoader(dir string, domain string) *Loader {
+	return NewLoader(os.DirFS(dir), domain)
+}
+
+// LocaleChain returns the locales to look for translations in for locale,
+// from the most to the least specific: `pt-BR.UTF-8` gives `pt_BR` and `pt`.
+func LocaleChain(locale string) []string {
+	locale = strings.ReplaceAll(locale, "-", "_")
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	var chain []string
+	for locale != "" {
+		chain = append(chain, locale)
+		i := strings.LastIndex(locale, "_")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return chain
+}
+
+// Translations returns the translations for locale. Messages are looked up
+// in the catalogs of the LocaleChain of the locale, then in the catalogs
+// of the DefaultLocale. Missing catalogs are skipped, if none is found the
+// messages aren't translated. The result plugs into the i18n extension
+// with Globals or Extension.Install.
+func (l *Loader) Translations(locale string) (Translations, error) {
+	locales := LocaleChain(locale)
+	if l.DefaultLocale != "" {
+		locales = append(locales, LocaleChain(l.DefaultLocale)...)
+	}
+
+	var chain Chain
+	seen := make(map[string]bool)
+	for _, loc := range locales {
+		if seen[loc] {
+			continue
+		}
+		seen[loc] = true
+		c, err := l.catalog(loc)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			chain = append(chain, c)
+		}
+	}
+	return chain, nil
+}
+
+// catalog returns the catalog of locale, nil if there's none.
+func (l *Loader) catalog(locale string) (*Catalog, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.catalogs[locale]; ok {
+		return c, nil
+	}
+
+	c, err := l.load(locale)
+	if err != nil {
+		return nil, err
+	}
+	l.catalogs[locale] = c
+	return c, nil
+}
+
+func (l *Loader) load(locale string) (*Catalog, error) {
+	base := path.Join(locale, "LC_MESSAGES", l.domain)
+	data, err := fs.ReadFile(l.fsys, base+".mo")
+	if err == nil {
+		c, err := ParseMO(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s.mo: %w", base, err)
+		}
+		return c, nil
+	}
+	if !stderrors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	data, err = fs.ReadFile(l.fsys, base+".po")
+	if err == nil {
+		c, err := ParsePO(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s.po: %w", base, err)
+		}
+		return c, nil
+	}
+	if !stderrors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return nil, nil
+}
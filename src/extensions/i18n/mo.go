@@ -0,0 +1,79 @@
+package i18n
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	moMagicLE = 0x950412de
+	moMagicBE = 0xde120495
+)
+
+// ParseMO reads a catalog in the binary `.mo` format produced by msgfmt.
+func ParseMO(data []byte) (*Catalog, error) {
+	if len(data) < 20 {
+		return nil, fmt.Errorf("mo file is too short")
+	}
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(data) {
+	case moMagicLE:
+		order = binary.LittleEndian
+	case moMagicBE:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid mo file magic number")
+	}
+	if major := order.Uint32(data[4:]) >> 16; major > 1 {
+		return nil, fmt.Errorf("unsupported mo file revision %d", major)
+	}
+	count := order.Uint32(data[8:])
+	originals := order.Uint32(data[12:])
+	translations := order.Uint32(data[16:])
+
+	// readString reads the string described by the table entry at offset.
+	readString := func(offset uint32) (string, error) {
+		if uint64(offset)+8 > uint64(len(data)) {
+			return "", fmt.Errorf("mo file is truncated")
+		}
+		length, start := order.Uint32(data[offset:]), order.Uint32(data[offset+4:])
+		if uint64(start)+uint64(length) > uint64(len(data)) {
+			return "", fmt.Errorf("mo file is truncated")
+		}
+		return string(data[start : start+length]), nil
+	}
+
+	c := newCatalog()
+	var entries [][2]string
+	for i := uint32(0); i < count; i++ {
+		original, err := readString(originals + 8*i)
+		if err != nil {
+			return nil, err
+		}
+		translation, err := readString(translations + 8*i)
+		if err != nil {
+			return nil, err
+		}
+		// the header comes first, it has to be set before the messages
+		if original == "" {
+			if err = c.setHeader(translation); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entries = append(entries, [2]string{original, translation})
+	}
+
+	for _, e := range entries {
+		context := ""
+		original := e[0]
+		if ctx, id, ok := strings.Cut(original, "\x04"); ok {
+			context, original = ctx, id
+		}
+		// plural messages are stored as `singular\x00plural`
+		id, _, _ := strings.Cut(original, "\x00")
+		c.add(context, id, strings.Split(e[1], "\x00"))
+	}
+	return c, nil
+}
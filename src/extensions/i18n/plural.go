@@ -0,0 +1,285 @@
+package i18n
+
+import (
+	"fmt"
+	"golang.org/x/exp/slices"
+	"strconv"
+	"strings"
+)
+
+// maxPluralExpression is the length of the longest `plural` expression
+// accepted, catalogs come from translators and are not trusted to be sane.
+const maxPluralExpression = 1024
+
+// pluralExpr is a compiled `plural` expression of a Plural-Forms header.
+type pluralExpr func(n int64) int64
+
+// germanicPlural is the plural rule used by catalogs without a
+// Plural-Forms header: singular for 1, plural otherwise.
+func germanicPlural(n int64) int64 {
+	if n == 1 {
+		return 0
+	}
+	return 1
+}
+
+// parsePluralForms parses a Plural-Forms header like
+// `nplurals=2; plural=(n != 1);`.
+func parsePluralForms(header string) (int, pluralExpr, error) {
+	nplurals := -1
+	var plural pluralExpr
+	for _, part := range strings.Split(header, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			if strings.TrimSpace(part) != "" {
+				return 0, nil, fmt.Errorf("invalid Plural-Forms header %q", header)
+			}
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "nplurals":
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 1 {
+				return 0, nil, fmt.Errorf("invalid nplurals in Plural-Forms header %q", header)
+			}
+			nplurals = n
+		case "plural":
+			var err error
+			if plural, err = compilePlural(value); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+	if nplurals < 0 || plural == nil {
+		return 0, nil, fmt.Errorf("Plural-Forms header %q needs nplurals and plural", header)
+	}
+	return nplurals, plural, nil
+}
+
+// compilePlural compiles a plural expression, the C subset used by gettext:
+// the variable `n`, integers, `?:`, `||`, `&&`, comparisons, arithmetic
+// operators, `!` and parentheses. The expression is never executed as code,
+// division by zero evaluates to 0.
+func compilePlural(source string) (pluralExpr, error) {
+	if len(source) > maxPluralExpression {
+		return nil, fmt.Errorf("plural expression is too long")
+	}
+	tokens, err := tokenizePlural(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &pluralParser{tokens: tokens}
+	expr, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in plural expression %q", p.tokens[p.pos], source)
+	}
+	return expr, nil
+}
+
+var pluralOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "!", "?", ":", "(", ")"}
+
+func tokenizePlural(source string) ([]string, error) {
+	var tokens []string
+	s := source
+outer:
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return tokens, nil
+		}
+		if s[0] >= '0' && s[0] <= '9' {
+			end := 1
+			for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+				end++
+			}
+			tokens = append(tokens, s[:end])
+			s = s[end:]
+			continue
+		}
+		if s[0] == 'n' {
+			tokens = append(tokens, "n")
+			s = s[1:]
+			continue
+		}
+		for _, op := range pluralOperators {
+			if strings.HasPrefix(s, op) {
+				tokens = append(tokens, op)
+				s = s[len(op):]
+				continue outer
+			}
+		}
+		return nil, fmt.Errorf("unexpected %q in plural expression %q", s[:1], source)
+	}
+}
+
+type pluralParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *pluralParser) current() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *pluralParser) expect(token string) error {
+	if p.current() != token {
+		return fmt.Errorf("expected %q in plural expression, got %q", token, p.current())
+	}
+	p.pos++
+	return nil
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *pluralParser) parseTernary() (pluralExpr, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.current() != "?" {
+		return cond, nil
+	}
+	p.pos++
+	then, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return func(n int64) int64 {
+		if cond(n) != 0 {
+			return then(n)
+		}
+		return otherwise(n)
+	}, nil
+}
+
+// pluralPrecedence lists the binary operators from the loosest to the
+// tightest binding.
+var pluralPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *pluralParser) parseBinary(level int) (pluralExpr, error) {
+	if level == len(pluralPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.current()
+		if !slices.Contains(pluralPrecedence[level], op) {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryPlural(op, left, right)
+	}
+}
+
+func binaryPlural(op string, a, b pluralExpr) pluralExpr {
+	switch op {
+	case "||":
+		return func(n int64) int64 { return boolToInt(a(n) != 0 || b(n) != 0) }
+	case "&&":
+		return func(n int64) int64 { return boolToInt(a(n) != 0 && b(n) != 0) }
+	case "==":
+		return func(n int64) int64 { return boolToInt(a(n) == b(n)) }
+	case "!=":
+		return func(n int64) int64 { return boolToInt(a(n) != b(n)) }
+	case "<":
+		return func(n int64) int64 { return boolToInt(a(n) < b(n)) }
+	case ">":
+		return func(n int64) int64 { return boolToInt(a(n) > b(n)) }
+	case "<=":
+		return func(n int64) int64 { return boolToInt(a(n) <= b(n)) }
+	case ">=":
+		return func(n int64) int64 { return boolToInt(a(n) >= b(n)) }
+	case "+":
+		return func(n int64) int64 { return a(n) + b(n) }
+	case "-":
+		return func(n int64) int64 { return a(n) - b(n) }
+	case "*":
+		return func(n int64) int64 { return a(n) * b(n) }
+	case "/":
+		return func(n int64) int64 {
+			if d := b(n); d != 0 {
+				return a(n) / d
+			}
+			return 0
+		}
+	default: // "%"
+		return func(n int64) int64 {
+			if d := b(n); d != 0 {
+				return a(n) % d
+			}
+			return 0
+		}
+	}
+}
+
+func (p *pluralParser) parseUnary() (pluralExpr, error) {
+	if p.current() == "!" {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(n int64) int64 { return boolToInt(operand(n) == 0) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *pluralParser) parsePrimary() (pluralExpr, error) {
+	token := p.current()
+	switch {
+	case token == "n":
+		p.pos++
+		return func(n int64) int64 { return n }, nil
+	case token == "(":
+		p.pos++
+		expr, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case token != "" && token[0] >= '0' && token[0] <= '9':
+		p.pos++
+		v, err := strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in plural expression", token)
+		}
+		return func(int64) int64 { return v }, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q in plural expression", token)
+	}
+}
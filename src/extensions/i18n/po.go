@@ -0,0 +1,167 @@
+package i18n
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// poEntry is an entry of a `.po` file being parsed.
+type poEntry struct {
+	context    *string
+	id         *string
+	idPlural   *string
+	strs       map[int]*string
+	fuzzy      bool
+	obsolete   bool
+	hasMsgstr  bool
+	lastField  *string
+	lastLineno int
+}
+
+// ParsePO reads a catalog in the `.po` format. Fuzzy and obsolete entries
+// are skipped, the Plural-Forms header of the catalog selects the plural
+// forms.
+func ParsePO(r io.Reader) (*Catalog, error) {
+	c := newCatalog()
+	entry := &poEntry{strs: make(map[int]*string)}
+
+	flush := func() error {
+		e := entry
+		entry = &poEntry{strs: make(map[int]*string)}
+		if e.id == nil {
+			return nil
+		}
+		if !e.hasMsgstr {
+			return fmt.Errorf("po line %d: msgid without msgstr", e.lastLineno)
+		}
+		context := ""
+		if e.context != nil {
+			context = *e.context
+		}
+		// the header is used even if it's fuzzy, like msgfmt does
+		if *e.id == "" && e.context == nil {
+			header := ""
+			if h, ok := e.strs[0]; ok {
+				header = *h
+			}
+			return c.setHeader(header)
+		}
+		if e.fuzzy || e.obsolete {
+			return nil
+		}
+		translations := make([]string, len(e.strs))
+		for i, s := range e.strs {
+			if i < 0 || i >= len(translations) {
+				return fmt.Errorf("po line %d: msgstr[%d] out of order", e.lastLineno, i)
+			}
+			translations[i] = *s
+		}
+		c.add(context, *e.id, translations)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		// obsolete entries are commented out, they are parsed to be skipped
+		obsolete := strings.HasPrefix(line, "#~")
+		if obsolete {
+			line = strings.TrimSpace(line[2:])
+		}
+
+		switch {
+		case line == "":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(line, "#"):
+			if entry.hasMsgstr {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			if strings.HasPrefix(line, "#,") {
+				for _, flag := range strings.Split(line[2:], ",") {
+					if strings.TrimSpace(flag) == "fuzzy" {
+						entry.fuzzy = true
+					}
+				}
+			}
+			continue
+		case strings.HasPrefix(line, `"`):
+			if entry.lastField == nil {
+				return nil, fmt.Errorf("po line %d: string without a keyword", lineno)
+			}
+			s, err := unquotePO(line, lineno)
+			if err != nil {
+				return nil, err
+			}
+			*entry.lastField += s
+			continue
+		}
+
+		keyword, rest, _ := strings.Cut(line, " ")
+		value, err := unquotePO(strings.TrimSpace(rest), lineno)
+		if err != nil {
+			return nil, err
+		}
+		if (keyword == "msgctxt" || keyword == "msgid") && entry.hasMsgstr {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		entry.obsolete = entry.obsolete || obsolete
+		entry.lastLineno = lineno
+
+		switch {
+		case keyword == "msgctxt":
+			entry.context = &value
+			entry.lastField = entry.context
+		case keyword == "msgid":
+			entry.id = &value
+			entry.lastField = entry.id
+		case keyword == "msgid_plural":
+			entry.idPlural = &value
+			entry.lastField = entry.idPlural
+		case keyword == "msgstr":
+			entry.hasMsgstr = true
+			entry.strs[0] = &value
+			entry.lastField = &value
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			idx, err := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+			if err != nil {
+				return nil, fmt.Errorf("po line %d: invalid keyword %s", lineno, keyword)
+			}
+			entry.hasMsgstr = true
+			entry.strs[idx] = &value
+			entry.lastField = &value
+		default:
+			return nil, fmt.Errorf("po line %d: unknown keyword %s", lineno, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func unquotePO(s string, lineno int) (string, error) {
+	if len(s) < 2 || !strings.HasPrefix(s, `"`) || !strings.HasSuffix(s, `"`) {
+		return "", fmt.Errorf("po line %d: expected a quoted string, got %s", lineno, s)
+	}
+	unquoted, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("po line %d: invalid string %s", lineno, s)
+	}
+	return unquoted, nil
+}
@@ -0,0 +1,136 @@
+package i18n
+
+import (
+	"bufio"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// MergeMessages merges the messages with the same context and id, in the
+// order they were first found, combining their locations and comments.
+func MergeMessages(messages []Message) []Message {
+	var merged []Message
+	index := make(map[messageKey]int)
+	for _, msg := range messages {
+		key := messageKey{id: msg.ID}
+		if msg.Context != nil {
+			// a message without context differs from one with an empty context
+			key.context = "\x04" + *msg.Context
+		}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			msg.Locations = append([]Location(nil), msg.Locations...)
+			msg.Comments = append([]string(nil), msg.Comments...)
+			merged = append(merged, msg)
+			continue
+		}
+		m := &merged[i]
+		if m.Plural == nil {
+			m.Plural = msg.Plural
+		}
+		for _, loc := range msg.Locations {
+			if !slices.Contains(m.Locations, loc) {
+				m.Locations = append(m.Locations, loc)
+			}
+		}
+		for _, comment := range msg.Comments {
+			if !slices.Contains(m.Comments, comment) {
+				m.Comments = append(m.Comments, comment)
+			}
+		}
+	}
+	return merged
+}
+
+// POTOptions are written to the header of a `.pot` file.
+type POTOptions struct {
+	Project string
+	Version string
+	// MsgidBugsAddress is the address to report errors in the messages to.
+	MsgidBugsAddress string
+}
+
+var pythonFormatRe = regexp.MustCompile(`%\([^)]*\)s`)
+
+// WritePOT writes the messages as a `.pot` template catalog. The output
+// only depends on the messages and the options (there's no creation date),
+// so extracted catalogs can be diffed.
+func WritePOT(w io.Writer, messages []Message, opts POTOptions) error {
+	project := opts.Project
+	if project == "" {
+		project = "PROJECT"
+	}
+	version := opts.Version
+	if version == "" {
+		version = "VERSION"
+	}
+
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(bw, "# Translations template for %s.\n#\n#, fuzzy\n", project)
+	writePOString(bw, "msgid", "")
+	writePOString(bw, "msgstr", fmt.Sprintf(`Project-Id-Version: %s %s
+Report-Msgid-Bugs-To: %s
+MIME-Version: 1.0
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: 8bit
+Generated-By: gojinja
+`, project, version, opts.MsgidBugsAddress))
+
+	for _, msg := range messages {
+		bw.WriteString("\n")
+		for _, comment := range msg.Comments {
+			for _, line := range strings.Split(comment, "\n") {
+				_, _ = fmt.Fprintf(bw, "#. %s\n", strings.TrimRight(line, " \t\r"))
+			}
+		}
+		if len(msg.Locations) > 0 {
+			locations := make([]string, 0, len(msg.Locations))
+			for _, loc := range msg.Locations {
+				locations = append(locations, fmt.Sprintf("%s:%d", loc.Filename, loc.Lineno))
+			}
+			_, _ = fmt.Fprintf(bw, "#: %s\n", strings.Join(locations, " "))
+		}
+		if pythonFormatRe.MatchString(msg.ID) || (msg.Plural != nil && pythonFormatRe.MatchString(*msg.Plural)) {
+			bw.WriteString("#, python-format\n")
+		}
+		if msg.Context != nil {
+			writePOString(bw, "msgctxt", *msg.Context)
+		}
+		writePOString(bw, "msgid", msg.ID)
+		if msg.Plural != nil {
+			writePOString(bw, "msgid_plural", *msg.Plural)
+			writePOString(bw, "msgstr[0]", "")
+			writePOString(bw, "msgstr[1]", "")
+		} else {
+			writePOString(bw, "msgstr", "")
+		}
+	}
+	return bw.Flush()
+}
+
+// writePOString writes a keyword and its quoted string, splitting the
+// strings with newlines into one line per line of the string.
+func writePOString(w *bufio.Writer, keyword string, s string) {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= 1 {
+		_, _ = fmt.Fprintf(w, "%s %s\n", keyword, quotePO(s))
+		return
+	}
+	_, _ = fmt.Fprintf(w, "%s \"\"\n", keyword)
+	for _, line := range lines {
+		_, _ = fmt.Fprintf(w, "%s\n", quotePO(line))
+	}
+}
+
+var poEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+
+func quotePO(s string) string {
+	return `"` + poEscaper.Replace(s) + `"`
+}
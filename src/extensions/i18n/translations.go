@@ -0,0 +1,215 @@
+package i18n
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/utils/numbers"
+	"strings"
+)
+
+// Translations translates the messages of templates, like Python's
+// `gettext.NullTranslations`. The plural functions get the count the
+// message is for.
+type Translations interface {
+	Gettext(message string) string
+	Ngettext(singular string, plural string, n int) string
+	Pgettext(context string, message string) string
+	Npgettext(context string, singular string, plural string, n int) string
+}
+
+// NullTranslations doesn't translate anything, it returns the messages of
+// the templates, using the plural form if n isn't 1.
+type NullTranslations struct{}
+
+var _ Translations = NullTranslations{}
+
+func (NullTranslations) Gettext(message string) string {
+	return message
+}
+
+func (NullTranslations) Ngettext(singular string, plural string, n int) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+func (t NullTranslations) Pgettext(_ string, message string) string {
+	return t.Gettext(message)
+}
+
+func (t NullTranslations) Npgettext(_ string, singular string, plural string, n int) string {
+	return t.Ngettext(singular, plural, n)
+}
+
+// Globals returns the translation functions translating with t: `gettext`
+// and its alias `_`, `ngettext`, `pgettext` and `npgettext`. They take the
+// variables of the message as keyword arguments, and replace the `%(name)s`
+// placeholders of the translated message with them. The plural functions
+// make the count available as `num`.
+//
+// An Environment serving many locales passes them with the globals of each
+// render, so every render can use its own translations.
+func Globals(t Translations) map[string]any {
+	gettext := gettextFunc{t}
+	return map[string]any{
+		"gettext":   gettext,
+		"_":         gettext,
+		"ngettext":  ngettextFunc{t},
+		"pgettext":  pgettextFunc{t},
+		"npgettext": npgettextFunc{t},
+	}
+}
+
+type gettextFunc struct {
+	t Translations
+}
+
+func (f gettextFunc) Call(args []any, kwargs map[string]any) (any, error) {
+	strs, err := stringArgs("gettext", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return format(f.t.Gettext(strs[0]), kwargs)
+}
+
+type ngettextFunc struct {
+	t Translations
+}
+
+func (f ngettextFunc) Call(args []any, kwargs map[string]any) (any, error) {
+	strs, err := stringArgs("ngettext", args, 3, 2)
+	if err != nil {
+		return nil, err
+	}
+	n, err := count("ngettext", args[2])
+	if err != nil {
+		return nil, err
+	}
+	return format(f.t.Ngettext(strs[0], strs[1], n), withNum(kwargs, args[2]))
+}
+
+type pgettextFunc struct {
+	t Translations
+}
+
+func (f pgettextFunc) Call(args []any, kwargs map[string]any) (any, error) {
+	strs, err := stringArgs("pgettext", args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	return format(f.t.Pgettext(strs[0], strs[1]), kwargs)
+}
+
+type npgettextFunc struct {
+	t Translations
+}
+
+func (f npgettextFunc) Call(args []any, kwargs map[string]any) (any, error) {
+	strs, err := stringArgs("npgettext", args, 4, 3)
+	if err != nil {
+		return nil, err
+	}
+	n, err := count("npgettext", args[3])
+	if err != nil {
+		return nil, err
+	}
+	return format(f.t.Npgettext(strs[0], strs[1], strs[2], n), withNum(kwargs, args[3]))
+}
+
+// stringArgs checks that fn got want arguments, the first n of them being
+// strings, and returns those.
+func stringArgs(fn string, args []any, want int, n int) ([]string, error) {
+	if len(args) != want {
+		return nil, fmt.Errorf("%s() takes %d positional arguments but %d were given", fn, want, len(args))
+	}
+	strs := make([]string, 0, n)
+	for _, arg := range args[:n] {
+		s, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s() expected string arguments, got %T", fn, arg)
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+func count(fn string, v any) (int, error) {
+	n, ok := numbers.ToInt(v)
+	if !ok {
+		if f, isFloat := numbers.ToFloat(v); isFloat {
+			return int(f), nil
+		}
+		return 0, fmt.Errorf("%s() count must be a number, got %T", fn, v)
+	}
+	return int(n), nil
+}
+
+func withNum(kwargs map[string]any, num any) map[string]any {
+	ret := make(map[string]any, len(kwargs)+1)
+	ret["num"] = num
+	for k, v := range kwargs {
+		ret[k] = v
+	}
+	return ret
+}
+
+// format replaces the `%(name)s` placeholders of s with the variables and
+// `%%` with `%`, like Python's `s % variables`.
+func format(s string, variables map[string]any) (string, error) {
+	var builder strings.Builder
+	for {
+		i := strings.IndexByte(s, '%')
+		if i < 0 {
+			builder.WriteString(s)
+			return builder.String(), nil
+		}
+		builder.WriteString(s[:i])
+		s = s[i+1:]
+
+		if strings.HasPrefix(s, "%") {
+			builder.WriteByte('%')
+			s = s[1:]
+			continue
+		}
+		if !strings.HasPrefix(s, "(") {
+			return "", fmt.Errorf("unsupported format in translated message, only %%(name)s is allowed")
+		}
+		end := strings.Index(s, ")s")
+		if end < 0 {
+			return "", fmt.Errorf("unsupported format in translated message, only %%(name)s is allowed")
+		}
+		name := s[1:end]
+		value, ok := variables[name]
+		if !ok {
+			return "", fmt.Errorf("translated message references undefined variable '%s'", name)
+		}
+		valueStr, err := str(value)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(valueStr)
+		s = s[end+2:]
+	}
+}
+
+type stringer interface {
+	String_() (string, error)
+}
+
+// str converts a value to a string like Python's `str` does for the values
+// templates pass to messages.
+func str(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "None", nil
+	case bool:
+		if v {
+			return "True", nil
+		}
+		return "False", nil
+	case stringer:
+		return v.String_()
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,72 @@
+package i18n
+
+import (
+	"github.com/gojinja/gojinja/src/operator"
+	"testing"
+)
+
+type upperTranslations struct {
+	NullTranslations
+}
+
+func (upperTranslations) Pgettext(context string, message string) string {
+	return context + ": " + message
+}
+
+func TestGlobals(t *testing.T) {
+	globals := Globals(upperTranslations{})
+	cases := []struct {
+		fn     string
+		args   []any
+		kwargs map[string]any
+		res    string
+	}{
+		{"gettext", []any{"Hello"}, nil, "Hello"},
+		{"_", []any{"Hello %(user)s, 100%%"}, map[string]any{"user": "Ann"}, "Hello Ann, 100%"},
+		{"ngettext", []any{"%(num)s apple", "%(num)s apples", 1}, nil, "1 apple"},
+		{"ngettext", []any{"%(num)s apple", "%(num)s apples", 3}, nil, "3 apples"},
+		{"ngettext", []any{"%(num)s apple", "%(num)s apples", 3}, map[string]any{"num": "three"}, "three apples"},
+		{"pgettext", []any{"menu", "Open"}, nil, "menu: Open"},
+		{"npgettext", []any{"fruit", "%(num)s apple", "%(num)s apples", 2}, map[string]any{"ok": true}, "2 apples"},
+		{"gettext", []any{"%(v)s"}, map[string]any{"v": nil}, "None"},
+	}
+	for _, c := range cases {
+		res, err := operator.Call(globals[c.fn], c.args, c.kwargs)
+		if err != nil {
+			t.Fatal(c.fn, c.args, err)
+		}
+		if res != c.res {
+			t.Fatal("expected", c.res, "got", res)
+		}
+	}
+
+	errorCases := []struct {
+		fn     string
+		args   []any
+		kwargs map[string]any
+	}{
+		{"gettext", []any{"%(missing)s"}, nil},
+		{"gettext", []any{"%d"}, nil},
+		{"gettext", []any{1}, nil},
+		{"ngettext", []any{"a", "b"}, nil},
+		{"ngettext", []any{"a", "b", "c"}, nil},
+	}
+	for _, c := range errorCases {
+		if _, err := operator.Call(globals[c.fn], c.args, c.kwargs); err == nil {
+			t.Fatal("expected an error for", c.fn, c.args)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	env := newEnv(t)
+	ext := env.Extensions["i18n"].(*Extension)
+	ext.Install(NullTranslations{})
+	if _, ok := env.Globals["ngettext"]; !ok {
+		t.Fatal("the translation functions should be installed")
+	}
+	ext.Uninstall()
+	if _, ok := env.Globals["_"]; ok {
+		t.Fatal("the translation functions should be uninstalled")
+	}
+}
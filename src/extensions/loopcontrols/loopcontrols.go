@@ -0,0 +1,37 @@
+// Package loopcontrols provides the extension adding the `{% break %}` and
+// `{% continue %}` tags to for loops.
+package loopcontrols
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/nodes"
+)
+
+// Extension adds `{% break %}` and `{% continue %}`. They are only allowed
+// in the body of a for loop, not in its `else` block nor in a macro, a call
+// block or a block defined inside the loop.
+type Extension struct{}
+
+var _ extensions.IExtension = Extension{}
+
+func New(*environment.Environment) extensions.IExtension {
+	return Extension{}
+}
+
+func (Extension) Tags() []string {
+	return []string{"break", "continue"}
+}
+
+func (Extension) Parse(p extensions.IParser) ([]nodes.Node, error) {
+	token := p.Stream().Next()
+	if !p.InLoop() {
+		return nil, p.Fail(fmt.Sprintf("'%s' can only be used inside of a for loop", token.Value), &token.Lineno, nil)
+	}
+	common := nodes.StmtCommon{Lineno: token.Lineno}
+	if token.Value == "break" {
+		return []nodes.Node{&nodes.Break{StmtCommon: common}}, nil
+	}
+	return []nodes.Node{&nodes.Continue{StmtCommon: common}}, nil
+}
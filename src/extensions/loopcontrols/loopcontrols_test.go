@@ -0,0 +1,72 @@
+package loopcontrols
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/parser"
+	"golang.org/x/exp/maps"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, source string) (*nodes.Template, error) {
+	t.Helper()
+	opts := environment.DefaultEnvOpts()
+	opts.Extensions = map[string]func(*environment.Environment) extensions.IExtension{"loopcontrols": New}
+	env, err := environment.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := lexer.GetLexer(env.EnvLexerInformation).Tokenize(source, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parser.NewParser(stream, maps.Values(env.Extensions), nil, nil, nil).Parse()
+}
+
+func TestLoopControls(t *testing.T) {
+	template, err := parse(t, `{% for x in xs %}{% if x %}{% continue %}{% endif %}{% break %}{% endfor %}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := template.Body[0].(*nodes.For).Body
+	if _, ok := body[0].(*nodes.If).Body[0].(*nodes.Continue); !ok {
+		t.Fatalf("expected a continue node, got %#v", body[0])
+	}
+	brk, ok := body[1].(*nodes.Break)
+	if !ok {
+		t.Fatalf("expected a break node, got %#v", body[1])
+	}
+	if brk.Span.Start.Col != 52 || brk.Span.End.Col != 63 {
+		t.Fatal("unexpected span", brk.Span)
+	}
+
+	valid := []string{
+		`{% for x in xs %}{% for y in x %}{% break %}{% endfor %}{% continue %}{% endfor %}`,
+		`{% for x in xs %}{% for y in x %}{% else %}{% break %}{% endfor %}{% endfor %}`,
+		`{% macro m() %}{% for x in xs %}{% break %}{% endfor %}{% endmacro %}`,
+		`{% for x in xs %}{% with a = 1 %}{% filter upper %}{% break %}{% endfilter %}{% endwith %}{% endfor %}`,
+	}
+	for _, source := range valid {
+		if _, err := parse(t, source); err != nil {
+			t.Fatal(source, err)
+		}
+	}
+
+	invalid := []string{
+		`{% break %}`,
+		`{% for x in xs %}{% else %}{% continue %}{% endfor %}`,
+		`{% for x in xs %}{% macro m() %}{% break %}{% endmacro %}{% endfor %}`,
+		`{% for x in xs %}{% call m() %}{% continue %}{% endcall %}{% endfor %}`,
+		`{% for x in xs %}{% block b %}{% break %}{% endblock %}{% endfor %}`,
+		`{% for x in xs %}{% endfor %}{% break %}`,
+	}
+	for _, source := range invalid {
+		_, err := parse(t, source)
+		if err == nil || !strings.Contains(err.Error(), "can only be used inside of a for loop") {
+			t.Fatal("expected an error for", source, "got", err)
+		}
+	}
+}
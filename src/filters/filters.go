@@ -1,7 +1,15 @@
 package filters
 
+import "github.com/gojinja/gojinja/src/utils/set"
+
 type Filter func(args []any, kwargs map[string]any) any
 
 var Default = map[string]Filter{
 	// TODO fill
 }
+
+// Pure are the filters of Default whose result only depends on their
+// arguments, the optimizer calls them at compile time with constant
+// arguments. It's empty as long as Default is, until then only the filters
+// added to an environment's PureFilters are folded.
+var Pure = set.FrozenFromElems[string]()
@@ -0,0 +1,446 @@
+// Package formatter formats the source of templates and prints abstract
+// syntax trees back to template source.
+package formatter
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/utils/set"
+	"reflect"
+	"strings"
+)
+
+// Options configure the formatter and the printer, the zero value uses
+// double quotes and keeps the indentation.
+type Options struct {
+	// Quote is the quote of the string literals, '"' or '\''.
+	Quote rune
+	// Indent is the indentation of a level of nested block tags, it's only
+	// written where the lexer strips the whitespace before the tags anyway:
+	// before the tags starting a line with `-` (`{%-`) or in environments
+	// with LStripBlocks, and before line statements. Comments are indented
+	// like block tags. The indentation is left alone if Indent is empty.
+	Indent string
+}
+
+// closingTags are the tags ending the body of the statements, by statement.
+var closingTags = map[string]string{
+	"for":        "endfor",
+	"if":         "endif",
+	"macro":      "endmacro",
+	"call":       "endcall",
+	"filter":     "endfilter",
+	"block":      "endblock",
+	"with":       "endwith",
+	"set":        "endset",
+	"autoescape": "endautoescape",
+}
+
+// intermediateTags are the tags separating the bodies of a statement, they
+// are indented like the statement.
+var intermediateTags = set.FrozenFromElems("elif", "else", "pluralize")
+
+// tagNodes are the types of the nodes of the builtin tags, the other tags
+// (like the ones of the extensions) are formatted token by token.
+var tagNodes = map[string][]reflect.Type{
+	"for":        {reflect.TypeOf(&nodes.For{})},
+	"if":         {reflect.TypeOf(&nodes.If{})},
+	"macro":      {reflect.TypeOf(&nodes.Macro{})},
+	"call":       {reflect.TypeOf(&nodes.CallBlock{})},
+	"filter":     {reflect.TypeOf(&nodes.FilterBlock{})},
+	"block":      {reflect.TypeOf(&nodes.Block{})},
+	"with":       {reflect.TypeOf(&nodes.With{})},
+	"set":        {reflect.TypeOf(&nodes.Assign{}), reflect.TypeOf(&nodes.AssignBlock{})},
+	"autoescape": {reflect.TypeOf(&nodes.Scope{})},
+	"extends":    {reflect.TypeOf(&nodes.Extends{})},
+	"include":    {reflect.TypeOf(&nodes.Include{})},
+	"import":     {reflect.TypeOf(&nodes.Import{})},
+	"from":       {reflect.TypeOf(&nodes.FromImport{})},
+	"print":      {reflect.TypeOf(&nodes.Output{})},
+	"do":         {reflect.TypeOf(&nodes.ExprStmt{})},
+}
+
+// Format returns the canonical form of the source of a template: the
+// expressions of the tags are printed from their syntax tree with single
+// spaces around the operators and the quote of the options, and the block
+// tags are indented by their depth where it doesn't change the output (see
+// Options.Indent). The template data, the comments, the raw blocks, the
+// line statements and the whitespace control markers are kept byte for
+// byte. The tags of extensions are kept, with their whitespace collapsed.
+//
+// Formatting never changes the output of a template: the formatted source
+// is parsed and an error is returned if its syntax tree isn't the one of
+// the source.
+func Format(env *environment.Environment, source string, opts Options) (string, error) {
+	expected, err := env.Parse(source, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	if env.Preprocess(source, nil, nil) != source {
+		return "", fmt.Errorf("can't format templates changed by the preprocessors of the extensions")
+	}
+	tokens, err := env.Lex(source, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	info, err := lexer.ReadHeader(env.EnvLexerInformation, source)
+	if err != nil {
+		return "", err
+	}
+	if _, err = newPrinter(info, opts); err != nil {
+		return "", err
+	}
+
+	f := &formatter{env: env, info: info, opts: opts, source: source, tokens: tokens}
+	if info != env.EnvLexerInformation {
+		// the header is lexed as a comment
+		f.header = source[:tokens[2].Span.End.Offset]
+	}
+	if err = f.format(); err != nil {
+		return "", err
+	}
+	formatted := f.builder.String()
+
+	actual, err := env.Parse(formatted, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("the formatted template is invalid: %w", err)
+	}
+	if !SameTree(expected, actual) {
+		return "", fmt.Errorf("formatting changed the template")
+	}
+	return formatted, nil
+}
+
+type formatter struct {
+	env *environment.Environment
+	// info is the lexer information of the template, the one of env unless
+	// the template has a header directive, which is kept in header to
+	// parse the tags.
+	info    *lexer.EnvLexerInformation
+	header  string
+	opts    Options
+	source  string
+	tokens  []lexer.Token
+	builder strings.Builder
+	// pos is the offset of the source written so far.
+	pos   int
+	depth int
+}
+
+func (f *formatter) format() error {
+	endTags := set.New[string]()
+	for idx, token := range f.tokens {
+		if token.Type == lexer.TokenBlockBegin || token.Type == lexer.TokenLinestatementBegin {
+			if name, ok := f.tagName(idx); ok && strings.HasPrefix(name, "end") {
+				endTags.Add(name)
+			}
+		}
+	}
+
+	for idx := 0; idx < len(f.tokens); idx++ {
+		token := f.tokens[idx]
+		switch token.Type {
+		case lexer.TokenVariableBegin, lexer.TokenBlockBegin, lexer.TokenLinestatementBegin:
+			end := f.tagEnd(idx, token.Type)
+			if end < 0 {
+				return fmt.Errorf("unclosed tag at line %d", token.Lineno)
+			}
+			f.tag(idx, end, endTags)
+			idx = end
+		case lexer.TokenCommentBegin, lexer.TokenLinecommentBegin:
+			f.indent(token, f.depth)
+		}
+	}
+	f.builder.WriteString(f.source[f.pos:])
+	return nil
+}
+
+// tagEnd returns the index of the token ending the tag starting at idx.
+func (f *formatter) tagEnd(idx int, begin string) int {
+	end := map[string]string{
+		lexer.TokenVariableBegin:      lexer.TokenVariableEnd,
+		lexer.TokenBlockBegin:         lexer.TokenBlockEnd,
+		lexer.TokenLinestatementBegin: lexer.TokenLinestatementEnd,
+	}[begin]
+	for ; idx < len(f.tokens); idx++ {
+		if f.tokens[idx].Type == end {
+			return idx
+		}
+	}
+	return -1
+}
+
+// tagName returns the name of the block tag starting at idx.
+func (f *formatter) tagName(idx int) (string, bool) {
+	for idx++; idx < len(f.tokens) && f.tokens[idx].Type == lexer.TokenWhitespace; idx++ {
+	}
+	if idx == len(f.tokens) || f.tokens[idx].Type != lexer.TokenName {
+		return "", false
+	}
+	name, ok := f.tokens[idx].Value.(string)
+	return name, ok
+}
+
+// indent replaces the indentation before token if the lexer strips it.
+func (f *formatter) indent(token lexer.Token, depth int) {
+	if f.opts.Indent == "" {
+		return
+	}
+	if depth < 0 {
+		depth = 0
+	}
+	begin, _ := token.Value.(string)
+	start := token.Span.Start.Offset
+	if token.Type == lexer.TokenLinestatementBegin || token.Type == lexer.TokenLinecommentBegin {
+		// the whitespace before the prefixes is part of the tokens, the
+		// lexer drops it if they start the line
+		if start < f.pos || (start > 0 && f.source[start-1] != '\n') {
+			return
+		}
+		f.builder.WriteString(f.source[f.pos:start])
+		f.builder.WriteString(strings.Repeat(f.opts.Indent, depth))
+		f.builder.WriteString(strings.TrimLeft(begin, " \t"))
+		f.pos = token.Span.End.Offset
+		return
+	}
+	stripped := strings.HasSuffix(begin, "-") || (f.info.LStripBlocks && !strings.HasSuffix(begin, "+"))
+	if !stripped {
+		return
+	}
+	lineStart := strings.LastIndexByte(f.source[:start], '\n') + 1
+	if lineStart < f.pos || strings.Trim(f.source[lineStart:start], " \t") != "" {
+		return
+	}
+	f.builder.WriteString(f.source[f.pos:lineStart])
+	f.builder.WriteString(strings.Repeat(f.opts.Indent, depth))
+	f.pos = start
+}
+
+// tag formats the tag from the token at begin to the token at end.
+func (f *formatter) tag(begin int, end int, endTags set.Set[string]) {
+	var content []lexer.Token
+	for _, token := range f.tokens[begin+1 : end] {
+		if token.Type != lexer.TokenWhitespace {
+			content = append(content, token)
+		}
+	}
+	if len(content) == 0 {
+		return
+	}
+	start, stop := content[0].Span.Start.Offset, content[len(content)-1].Span.End.Offset
+	text := f.source[start:stop]
+
+	var formatted string
+	if f.tokens[begin].Type == lexer.TokenVariableBegin {
+		formatted = f.output(text)
+	} else {
+		name, _ := content[0].Value.(string)
+		var opens bool
+		formatted, opens = f.statement(name, text, endTags)
+		switch {
+		case strings.HasPrefix(name, "end"):
+			f.depth--
+			f.indent(f.tokens[begin], f.depth)
+		case intermediateTags.Has(name):
+			f.indent(f.tokens[begin], f.depth-1)
+		default:
+			f.indent(f.tokens[begin], f.depth)
+		}
+		if opens {
+			f.depth++
+		}
+		if f.depth < 0 {
+			f.depth = 0
+		}
+	}
+	f.builder.WriteString(f.source[f.pos:f.tokens[begin].Span.End.Offset])
+	f.builder.WriteString(" ")
+	f.builder.WriteString(formatted)
+	endToken := f.source[f.tokens[end].Span.Start.Offset:f.tokens[end].Span.End.Offset]
+	if f.tokens[end].Type == lexer.TokenLinestatementEnd {
+		// the lexer drops the whitespace ending line statements
+		f.builder.WriteString(strings.TrimLeft(endToken, " \t"))
+	} else {
+		f.builder.WriteString(" ")
+		f.builder.WriteString(endToken)
+	}
+	f.pos = f.tokens[end].Span.End.Offset
+}
+
+// output formats the content of a variable tag.
+func (f *formatter) output(text string) string {
+	template, err := f.env.Parse(f.header+f.info.VariableStartString+" "+text+" "+f.info.VariableEndString, nil, nil)
+	if err != nil || len(template.Body) != 1 {
+		return collapse(text)
+	}
+	output, ok := template.Body[0].(*nodes.Output)
+	if !ok || len(output.Nodes) != 1 {
+		return collapse(text)
+	}
+	p, _ := newPrinter(f.info, f.opts)
+	p.tuple(output.Nodes[0], levelCond, false)
+	if p.err != nil {
+		return collapse(text)
+	}
+	return p.builder.String()
+}
+
+// statement formats the content of a block tag, it tells if the tag starts
+// a body.
+func (f *formatter) statement(name string, text string, endTags set.Set[string]) (string, bool) {
+	p, _ := newPrinter(f.info, f.opts)
+	if name == "elif" {
+		template, err := f.parseTags(p.env.BlockStartString+" if x "+p.env.BlockEndString, text, "endif")
+		if err != nil || len(template.Body) != 1 {
+			return collapse(text), false
+		}
+		if n, ok := template.Body[0].(*nodes.If); ok && len(n.Elif) == 1 {
+			if test, ok := n.Elif[0].Test.(nodes.Expr); ok {
+				p.write("elif ")
+				p.tuple(test, levelOr, false)
+				if p.err == nil {
+					return p.builder.String(), false
+				}
+			}
+		}
+		return collapse(text), false
+	}
+
+	types, ok := tagNodes[name]
+	if !ok {
+		// the tags of extensions with a body have end tags
+		return collapse(text), endTags.Has("end" + name)
+	}
+	template, err := f.parseTags("", text, "")
+	opens := false
+	if err != nil && closingTags[name] != "" {
+		template, err = f.parseTags("", text, closingTags[name])
+		opens = err == nil
+	}
+	if err != nil || len(template.Body) != 1 {
+		return collapse(text), opens
+	}
+	node := template.Body[0]
+	known := false
+	for _, t := range types {
+		known = known || reflect.TypeOf(node) == t
+	}
+	if !known || !p.header(node) || p.err != nil {
+		return collapse(text), opens
+	}
+	return p.builder.String(), opens
+}
+
+// parseTags parses a block tag with content, after the prefix and followed
+// by the end tag if it's not empty.
+func (f *formatter) parseTags(prefix string, content string, end string) (*nodes.Template, error) {
+	env := f.info
+	source := f.header + prefix + env.BlockStartString + " " + content + " " + env.BlockEndString
+	if end != "" {
+		source += env.BlockStartString + " " + end + " " + env.BlockEndString
+	}
+	return f.env.Parse(source, nil, nil)
+}
+
+// collapse replaces the whitespace between the tokens of a tag by single
+// spaces.
+func collapse(text string) string {
+	var builder strings.Builder
+	quote := byte(0)
+	space := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			builder.WriteByte(c)
+			if c == '\\' && i+1 < len(text) {
+				i++
+				builder.WriteByte(text[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			continue
+		case c == '"' || c == '\'':
+			quote = c
+		}
+		if space {
+			builder.WriteByte(' ')
+			space = false
+		}
+		builder.WriteByte(c)
+	}
+	return builder.String()
+}
+
+// SameTree tells if two syntax trees are the same, except for the positions
+// of the nodes. Nil and empty lists are the same.
+func SameTree(a nodes.Node, b nodes.Node) bool {
+	return sameValue(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func sameValue(a reflect.Value, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return sameValue(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if name := a.Type().Field(i).Name; name == "Lineno" || name == "Span" {
+				continue
+			}
+			if !sameValue(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !sameValue(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			value := b.MapIndex(iter.Key())
+			if !value.IsValid() || !sameValue(iter.Value(), value) {
+				return false
+			}
+		}
+		return true
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+	}
+	// functions and channels
+	return a.Pointer() == b.Pointer()
+}
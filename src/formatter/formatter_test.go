@@ -0,0 +1,281 @@
+package formatter
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/extensions"
+	"github.com/gojinja/gojinja/src/extensions/i18n"
+	"github.com/gojinja/gojinja/src/extensions/loopcontrols"
+	"github.com/gojinja/gojinja/src/nodes"
+	"testing"
+)
+
+func newEnv(t *testing.T, configure func(opts *environment.EnvOpts)) *environment.Environment {
+	opts := environment.DefaultEnvOpts()
+	opts.Extensions = map[string]func(*environment.Environment) extensions.IExtension{
+		"i18n":         i18n.New,
+		"loopcontrols": loopcontrols.New,
+	}
+	if configure != nil {
+		configure(opts)
+	}
+	env, err := environment.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func parse(t *testing.T, env *environment.Environment, source string) *nodes.Template {
+	template, err := env.Parse(source, nil, nil)
+	if err != nil {
+		t.Fatal(source, err)
+	}
+	return template
+}
+
+// templates cover the syntax of the templates, for the printer and the
+// formatter.
+var templates = []string{
+	`{{ a + b * c - d / e // f % g ** h }}`,
+	`{{ (a + b) * (c - d) ** (e ** f) }}{{ a - (b - c) }}{{ -a ** 2 }}{{ -(a ** 2) }}{{ - -a }}`,
+	`{{ a if b else c if d else e }}{{ (a if b else c) if d }}{{ a or b and not c }}{{ (a or b) and c }}`,
+	`{{ not (a and b) }}{{ not a == b }}{{ (not a) == b }}{{ a < b <= c > d >= e == f != g }}`,
+	`{{ a in b }}{{ a not in b }}{{ (a in b) in c }}{{ a ~ b ~ (c ~ d) }}{{ a + b ~ c * d }}`,
+	`{{ a|upper }}{{ a|replace("x", y=1)|default(*b, **c) }}{{ -a|abs }}{{ (-a)|abs }}{{ -(a|abs) }}`,
+	`{{ a is defined }}{{ a is not divisibleby(3) }}{{ not a is defined }}{{ (a is defined) if b }}`,
+	`{{ (a is defined) in b }}{{ a is defined and b is undefined or c is none }}{{ a|f is t }}{{ (a is t)|f }}`,
+	`{{ a.b.c }}{{ a[0] }}{{ a.0 }}{{ a[1:2] }}{{ a[::2] }}{{ a[:] }}{{ a[1:] }}{{ a[b, c:d] }}`,
+	`{{ f() }}{{ f(a, b, c=d, *e, **g) }}{{ f(*a) }}{{ (a + b).c }}{{ (a|f)() }}{{ (1).real }}`,
+	`{{ [] }}{{ [1, "a", 2.5, 1e+21, true, false, none] }}{{ {} }}{{ {"a": 1, b: [c]} }}`,
+	`{{ () }}{{ (a,) }}{{ a, b }}{{ (a, b), c }}{{ a, }}`,
+	`{{ "it's" }}{{ 'say "hi"' }}{{ "tab\tnew\nline\\ \x01 ​ é" }}{{ "a" "b" }}`,
+	`{% for a, b in c if a recursive %}{{ a }}{% else %}x{% endfor %}{% for a in b, c %}{% endfor %}`,
+	`{% for (a, b) in c if d is defined recursive %}{% endfor %}{% for a in (b if c else d) %}{% endfor %}`,
+	`{% if a %}a{% elif b, c %}b{% elif d is defined %}d{% else %}e{% endif %}{% if (a if b else c) %}{% endif %}`,
+	`{% macro m(a, b=1, c=d|e) %}{{ a }}{{ caller() }}{% endmacro %}{% call(x, y=2) m(1) %}{{ x }}{% endcall %}`,
+	`{% filter upper|replace("a", "b") %}x{% endfilter %}{% set a = b %}{% set a = c, d %}{% set ns.a = 1 %}`,
+	`{% set a, b = c, d %}{% set (a, b), c = d %}{% set a, %}x{% endset %}`,
+	`{% set a %}x{% endset %}{% set a | upper %}x{% endset %}{% with a = 1, b = c %}{{ a }}{% endwith %}`,
+	`{% block b %}x{% endblock %}{% block c scoped required %}{% endblock %}{% extends "layout" ~ a %}`,
+	`{% include "a" %}{% include ["a", b] ignore missing without context %}{% include (a is defined) with context %}`,
+	`{% import "a" as b %}{% import (c is d) as e with context %}{% from "a" import b, c as d with context %}`,
+	`{% autoescape a and b %}{{ x }}{% endautoescape %}{% print a, b %}`,
+	"a\nb {% raw %}{{ x }}{% endraw %}  ",
+}
+
+func TestPrint(t *testing.T) {
+	env := newEnv(t, nil)
+	for _, source := range templates {
+		template := parse(t, env, source)
+		printed, err := Print(template, env.EnvLexerInformation, Options{})
+		if err != nil {
+			t.Fatal(source, err)
+		}
+		if !SameTree(template, parse(t, env, printed)) {
+			t.Fatalf("%s: printed as %s", source, printed)
+		}
+	}
+
+	for _, configure := range []func(opts *environment.EnvOpts){
+		func(opts *environment.EnvOpts) { opts.TrimBlocks = true },
+		func(opts *environment.EnvOpts) { opts.LStripBlocks = true },
+		func(opts *environment.EnvOpts) { opts.KeepTrailingNewline = true },
+	} {
+		env = newEnv(t, configure)
+		source := "  {% if a %}\n  x\n{% endif %}\n  {% for b in c %}{{ b }}\n{% endfor %}\n"
+		template := parse(t, env, source)
+		printed, err := Print(template, env.EnvLexerInformation, Options{Quote: '\''})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !SameTree(template, parse(t, env, printed)) {
+			t.Fatalf("%q printed as %q", source, printed)
+		}
+	}
+}
+
+func TestPrintExpr(t *testing.T) {
+	cases := map[string]string{
+		`{{a+b  *c}}`:                 `a + b * c`,
+		`{{ ((a)) }}`:                 `a`,
+		`{{ 'a' ~ "b'" }}`:            `"a" ~ "b'"`,
+		`{{ x|f( 1 , k = 2 ) }}`:      `x|f(1, k=2)`,
+		`{{ not x is   defined }}`:    `x is not defined`,
+		`{{ a is divisibleby 3 }}`:    `a is divisibleby(3)`,
+		`{{ (a is b) if c }}`:         `(a is b) if c`,
+		`{{ 1.0 }}{{ 10.0 }}`:         `1.0`,
+		`{{ [1,2,] }}`:                `[1, 2]`,
+		`{{ a[ 1 : ] }}`:              `a[1:]`,
+		`{{ f(*args,**kwargs) }}`:     `f(*args, **kwargs)`,
+		`{{ {'a':1} }}`:               `{"a": 1}`,
+		`{{ a.b(c)[d] }}`:             `a.b(c)[d]`,
+		`{{ (a, b) if c else d, e }}`: `(a, b) if c else d, e`,
+	}
+	env := newEnv(t, nil)
+	for source, expected := range cases {
+		expr := parse(t, env, source).Body[0].(*nodes.Output).Nodes[0]
+		res, err := Expr(expr, Options{})
+		if err != nil {
+			t.Fatal(source, err)
+		}
+		if res != expected {
+			t.Fatalf("%s: expected %s, got %s", source, expected, res)
+		}
+	}
+
+	if res := Quote("it's \"x\"", '\''); res != `'it\'s "x"'` {
+		t.Fatal("unexpected quoted string", res)
+	}
+	if _, err := Expr(&nodes.InternalName{Name: "x"}, Options{}); err == nil {
+		t.Fatal("internal names have no syntax")
+	}
+	if _, err := Expr(&nodes.Name{Name: "x"}, Options{Quote: '`'}); err == nil {
+		t.Fatal("expected an error for the quote")
+	}
+}
+
+var formatCases = map[string]string{
+	`{{x}}`:                                                          `{{ x }}`,
+	"{{-   a+b   -}}":                                                "{{- a + b -}}",
+	"a  {%- if x==1 -%}  b  {%+ endif %}":                            "a  {%- if x == 1 -%}  b  {%+ endif %}",
+	"{%  set  x=[1,2]  %}":                                           `{% set x = [1, 2] %}`,
+	"{% for  x  in  y  %}{{ x }}{%endfor%}":                          `{% for x in y %}{{ x }}{% endfor %}`,
+	"{# {{x}} #}{% raw %}{{x}}{% endraw %}":                          "{# {{x}} #}{% raw %}{{x}}{% endraw %}",
+	"{{ 'a' }}\n{{\n  b\n}}":                                         "{{ \"a\" }}\n{{ b }}",
+	"{% if a %}{% elif  b  %}{% else %}{% endif  %}":                 `{% if a %}{% elif b %}{% else %}{% endif %}`,
+	"{% block  b  %}{% endblock  b %}":                               `{% block b %}{% endblock b %}`,
+	"{% trans  count=n %}{{ count }} x{% pluralize %}{% endtrans %}": `{% trans count=n %}{{ count }} x{% pluralize %}{% endtrans %}`,
+	"{% for x in y %}{%   break   %}{% endfor %}":                    `{% for x in y %}{% break %}{% endfor %}`,
+	"{% set x %}a{% endset %}{% set   y=x %}":                        `{% set x %}a{% endset %}{% set y = x %}`,
+	`{% autoescape   true %}{% endautoescape %}`:                     `{% autoescape true %}{% endautoescape %}`,
+}
+
+func TestFormat(t *testing.T) {
+	env := newEnv(t, nil)
+	for source, expected := range formatCases {
+		res, err := Format(env, source, Options{})
+		if err != nil {
+			t.Fatal(source, err)
+		}
+		if res != expected {
+			t.Fatalf("%q: expected %q, got %q", source, expected, res)
+		}
+	}
+
+	if res, err := Format(env, `{{ "a" ~ 'b' }}`, Options{Quote: '\''}); err != nil || res != `{{ 'a' ~ 'b' }}` {
+		t.Fatal("unexpected quotes", res, err)
+	}
+	if _, err := Format(env, `{% if %}`, Options{}); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+}
+
+func TestFormatIndent(t *testing.T) {
+	source := `{% for a in b %}
+{% if a %}
+        {# comment #}
+    {{ a }}
+{% else %}
+  x {% if c %}y{% endif %}
+{% endif %}
+{%+ set d = 1 %}
+{% endfor %}
+`
+	expected := `{% for a in b %}
+  {% if a %}
+    {# comment #}
+    {{ a }}
+  {% else %}
+  x {% if c %}y{% endif %}
+  {% endif %}
+{%+ set d = 1 %}
+{% endfor %}
+`
+	env := newEnv(t, func(opts *environment.EnvOpts) { opts.LStripBlocks = true })
+	res, err := Format(env, source, Options{Indent: "  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, res)
+	}
+
+	// without LStripBlocks, only the tags with `-` are indented
+	env = newEnv(t, nil)
+	res, err = Format(env, "{% if a %}\n{%- if b %}\n {%- endif %}\n  {% endif %}", Options{Indent: "\t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{% if a %}\n\t{%- if b %}\n\t{%- endif %}\n  {% endif %}"; res != expected {
+		t.Fatalf("expected %q, got %q", expected, res)
+	}
+}
+
+// TestFormatKeepsTemplates checks that formatting is idempotent and that
+// the syntax tree, the template data included, doesn't change.
+func TestFormatKeepsTemplates(t *testing.T) {
+	for _, configure := range []func(opts *environment.EnvOpts){
+		nil,
+		func(opts *environment.EnvOpts) {
+			opts.TrimBlocks = true
+			opts.LStripBlocks = true
+		},
+	} {
+		env := newEnv(t, configure)
+		sources := append([]string{"  {% if a -%}\n  {{ b }}  \n   {%- endif %}\n{# c #}  \n"}, templates...)
+		for source := range formatCases {
+			sources = append(sources, source)
+		}
+		for _, source := range sources {
+			for _, opts := range []Options{{}, {Quote: '\'', Indent: "    "}} {
+				formatted, err := Format(env, source, opts)
+				if err != nil {
+					t.Fatal(source, err)
+				}
+				if !SameTree(parse(t, env, source), parse(t, env, formatted)) {
+					t.Fatalf("%q: the template changed: %q", source, formatted)
+				}
+				again, err := Format(env, formatted, opts)
+				if err != nil {
+					t.Fatal(formatted, err)
+				}
+				if again != formatted {
+					t.Fatalf("%q: formatted as %q, then %q", source, formatted, again)
+				}
+			}
+		}
+	}
+}
+
+func TestFormatLineStatements(t *testing.T) {
+	env := newEnv(t, func(opts *environment.EnvOpts) {
+		statementPrefix, commentPrefix := "#", "##"
+		opts.LineStatementPrefix = &statementPrefix
+		opts.LineCommentPrefix = &commentPrefix
+	})
+	source := "# for  x in y:  \n{% if x %}\n      #   set  z=x|upper\n{%- endif %}\n    ## comment\n{{x}} ## trailing\n# endfor"
+	expected := "# for x in y\n{% if x %}\n    # set z = x|upper\n  {%- endif %}\n  ## comment\n{{ x }} ## trailing\n# endfor"
+	res, err := Format(env, source, Options{Indent: "  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != expected {
+		t.Fatalf("expected %q, got %q", expected, res)
+	}
+	if again, err := Format(env, res, Options{Indent: "  "}); err != nil || again != res {
+		t.Fatalf("expected %q to be formatted, got %q", res, again)
+	}
+}
+
+func TestFormatHeader(t *testing.T) {
+	env := newEnv(t, nil)
+	source := "{# gojinja: block_start_string='<%' block_end_string='%>' lstrip_blocks=true #}\n<%if a%>\n<%set b=a|upper%>{{b}}{% x %}\n<%endif%>"
+	expected := "{# gojinja: block_start_string='<%' block_end_string='%>' lstrip_blocks=true #}\n<% if a %>\n  <% set b = a|upper %>{{ b }}{% x %}\n<% endif %>"
+	res, err := Format(env, source, Options{Indent: "  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != expected {
+		t.Fatalf("expected %q, got %q", expected, res)
+	}
+}
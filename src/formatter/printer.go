@@ -0,0 +1,827 @@
+package formatter
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"golang.org/x/exp/slices"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The precedence levels of the expressions, from the loosest to the
+// tightest, following the parser.
+const (
+	levelCond = iota + 1
+	levelOr
+	levelAnd
+	levelNot
+	levelCompare
+	levelMath1
+	levelConcat
+	levelMath2
+	levelPow
+	// levelUnary is the level of the signs, the filters and the tests.
+	levelUnary
+	// levelPostfix is the level of the primaries, the calls and the
+	// subscripts.
+	levelPostfix
+)
+
+var binaryOps = map[string]struct {
+	symbol string
+	level  int
+}{
+	"or":                {"or", levelOr},
+	"and":               {"and", levelAnd},
+	lexer.TokenAdd:      {"+", levelMath1},
+	lexer.TokenSub:      {"-", levelMath1},
+	lexer.TokenMul:      {"*", levelMath2},
+	lexer.TokenDiv:      {"/", levelMath2},
+	lexer.TokenFloordiv: {"//", levelMath2},
+	lexer.TokenMod:      {"%", levelMath2},
+	lexer.TokenPow:      {"**", levelPow},
+}
+
+var compareOps = map[string]string{
+	lexer.TokenEq:   "==",
+	lexer.TokenNe:   "!=",
+	lexer.TokenLt:   "<",
+	lexer.TokenLteq: "<=",
+	lexer.TokenGt:   ">",
+	lexer.TokenGteq: ">=",
+	"in":            "in",
+	"notin":         "not in",
+}
+
+var unaryOps = map[string]string{
+	lexer.TokenAdd: "+",
+	lexer.TokenSub: "-",
+}
+
+// printer writes nodes as template source.
+type printer struct {
+	builder strings.Builder
+	quote   rune
+	env     *lexer.EnvLexerInformation
+	err     error
+}
+
+func newPrinter(env *lexer.EnvLexerInformation, opts Options) (*printer, error) {
+	quote := opts.Quote
+	if quote == 0 {
+		quote = '"'
+	}
+	if quote != '"' && quote != '\'' {
+		return nil, fmt.Errorf("unexpected quote %q", quote)
+	}
+	return &printer{quote: quote, env: env}, nil
+}
+
+func (p *printer) write(s ...string) {
+	for _, str := range s {
+		p.builder.WriteString(str)
+	}
+}
+
+func (p *printer) failf(format string, args ...any) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+// Expr returns the source of an expression.
+func Expr(expr nodes.Expr, opts Options) (string, error) {
+	p, err := newPrinter(nil, opts)
+	if err != nil {
+		return "", err
+	}
+	p.tuple(expr, levelCond, false)
+	return p.builder.String(), p.err
+}
+
+// Print returns the source of a node, statements and templates included,
+// for an environment with the given lexer settings. Rendering the printed
+// source gives the same result as the node, but the comments and the
+// whitespace control of the original source are lost. The nodes without
+// template syntax, like the ones of extensions, can't be printed.
+func Print(node nodes.Node, env *lexer.EnvLexerInformation, opts Options) (string, error) {
+	p, err := newPrinter(env, opts)
+	if err != nil {
+		return "", err
+	}
+	switch n := node.(type) {
+	case nodes.Expr:
+		p.tuple(n, levelCond, false)
+	case *nodes.Keyword:
+		p.write(n.Key, "=")
+		p.expr(n.Value, levelCond, false)
+	case *nodes.Pair:
+		p.expr(n.Key, levelCond, false)
+		p.write(": ")
+		p.expr(n.Value, levelCond, false)
+	case *nodes.Operand:
+		if expr, ok := n.Expr.(nodes.Expr); ok {
+			p.write(compareOps[n.Op], " ")
+			p.expr(expr, levelMath1, false)
+		} else {
+			p.failf("unexpected operand %T", n.Expr)
+		}
+	default:
+		p.stmt(node)
+	}
+	if p.err != nil {
+		return "", p.err
+	}
+	source := p.builder.String()
+	if !env.KeepTrailingNewline && strings.HasSuffix(source, "\n") {
+		// the lexer removes a trailing newline
+		source += "\n"
+	}
+	return source, nil
+}
+
+// level returns the precedence level of an expression.
+func level(expr nodes.Expr) int {
+	switch e := expr.(type) {
+	case *nodes.CondExpr:
+		return levelCond
+	case *nodes.BinExpr:
+		if op, ok := binaryOps[e.Op]; ok {
+			return op.level
+		}
+	case *nodes.UnaryExpr:
+		if e.Op == "not" {
+			if _, ok := e.Node.(*nodes.Test); ok {
+				return levelUnary
+			}
+			return levelNot
+		}
+		return levelUnary
+	case *nodes.Compare:
+		return levelCompare
+	case *nodes.Concat:
+		return levelConcat
+	case *nodes.Filter, *nodes.Test:
+		return levelUnary
+	case *nodes.Const:
+		switch v := e.Value.(type) {
+		case int64:
+			if v < 0 {
+				return levelUnary
+			}
+		case float64:
+			if v < 0 || math.Signbit(v) {
+				return levelUnary
+			}
+		}
+	}
+	return levelPostfix
+}
+
+// tuple writes an expression where a tuple doesn't need parentheses, like
+// the expressions of outputs or the targets of loops.
+func (p *printer) tuple(expr nodes.Expr, min int, keyword bool) {
+	if tuple, ok := expr.(*nodes.Tuple); ok && len(tuple.Items) > 0 {
+		if len(tuple.Items) == 1 {
+			p.expr(tuple.Items[0], min, false)
+			p.write(",")
+			return
+		}
+		p.items(tuple.Items, min, keyword)
+		return
+	}
+	p.expr(expr, min, keyword)
+}
+
+// items writes a list of expressions, keyword tells if a keyword follows
+// the last one.
+func (p *printer) items(items []nodes.Expr, min int, keyword bool) {
+	for i, item := range items {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expr(item, min, keyword && i == len(items)-1)
+	}
+}
+
+// expr writes an expression, in parentheses if its level is lower than
+// min. keyword tells if a keyword like `if` or `in` follows, a test without
+// arguments would take it as its argument.
+func (p *printer) expr(expr nodes.Expr, min int, keyword bool) {
+	if expr == nil {
+		p.failf("missing expression")
+		return
+	}
+	if level(expr) < min {
+		p.write("(")
+		p.expr(expr, levelCond, false)
+		p.write(")")
+		return
+	}
+
+	switch e := expr.(type) {
+	case *nodes.CondExpr:
+		p.expr(e.Expr1, levelOr, true)
+		p.write(" if ")
+		if e.Expr2 == nil {
+			p.expr(e.Test, levelOr, keyword)
+			return
+		}
+		p.expr(e.Test, levelOr, false)
+		p.write(" else ")
+		p.expr(*e.Expr2, levelCond, keyword)
+	case *nodes.BinExpr:
+		op, ok := binaryOps[e.Op]
+		if !ok {
+			p.failf("unknown binary operator %q", e.Op)
+			return
+		}
+		p.expr(e.Left, op.level, false)
+		p.write(" ", op.symbol, " ")
+		p.expr(e.Right, op.level+1, keyword)
+	case *nodes.UnaryExpr:
+		if test, ok := e.Node.(*nodes.Test); ok && e.Op == "not" {
+			p.test(test, true, keyword)
+		} else if e.Op == "not" {
+			p.write("not ")
+			p.expr(e.Node, levelNot, keyword)
+		} else if symbol, ok := unaryOps[e.Op]; ok {
+			p.write(symbol)
+			p.expr(e.Node, levelPostfix, keyword)
+		} else {
+			p.failf("unknown unary operator %q", e.Op)
+		}
+	case *nodes.Compare:
+		for i, operand := range e.Ops {
+			if i == 0 {
+				p.expr(e.Expr, levelMath1, operand.Op == "in" || operand.Op == "notin")
+			}
+			p.write(" ", compareOps[operand.Op], " ")
+			operandExpr, ok := operand.Expr.(nodes.Expr)
+			if !ok {
+				p.failf("unexpected operand %T", operand.Expr)
+				return
+			}
+			next := keyword
+			if i+1 < len(e.Ops) {
+				next = e.Ops[i+1].Op == "in" || e.Ops[i+1].Op == "notin"
+			}
+			p.expr(operandExpr, levelMath1, next)
+		}
+	case *nodes.Concat:
+		for i, n := range e.Nodes {
+			if i > 0 {
+				p.write(" ~ ")
+			}
+			p.expr(n, levelMath2, keyword && i == len(e.Nodes)-1)
+		}
+	case *nodes.Filter:
+		if e.Node != nil {
+			p.expr(*e.Node, levelUnary, false)
+			p.write("|")
+		}
+		p.write(e.Name)
+		if len(e.Args) > 0 || len(e.Kwargs) > 0 || e.DynArgs != nil || e.DynKwargs != nil {
+			p.args(e.Args, e.Kwargs, e.DynArgs, e.DynKwargs)
+		}
+	case *nodes.Test:
+		p.test(e, false, keyword)
+	case *nodes.Getattr:
+		if c, ok := e.Node.(*nodes.Const); ok && !isString(c.Value) {
+			// `1.a` would be read as a float
+			p.write("(")
+			p.expr(e.Node, levelCond, false)
+			p.write(")")
+		} else {
+			p.expr(e.Node, levelPostfix, false)
+		}
+		p.write(".", e.Attr)
+	case *nodes.Getitem:
+		p.expr(e.Node, levelPostfix, false)
+		p.write("[")
+		if tuple, ok := e.Arg.(*nodes.Tuple); ok && len(tuple.Items) > 1 {
+			for i, item := range tuple.Items {
+				if i > 0 {
+					p.write(", ")
+				}
+				p.subscript(item)
+			}
+		} else {
+			p.subscript(e.Arg)
+		}
+		p.write("]")
+	case *nodes.Call:
+		p.expr(e.Node, levelPostfix, false)
+		p.args(e.Args, e.Kwargs, e.DynArgs, e.DynKwargs)
+	case *nodes.Name:
+		p.write(e.Name)
+	case *nodes.NSRef:
+		p.write(e.Name, ".", e.Attr)
+	case *nodes.Const:
+		p.value(e.Value)
+	case *nodes.Tuple:
+		p.write("(")
+		if len(e.Items) > 0 {
+			p.tuple(e, levelCond, false)
+		}
+		p.write(")")
+	case *nodes.List:
+		p.write("[")
+		p.items(e.Items, levelCond, false)
+		p.write("]")
+	case *nodes.Dict:
+		p.write("{")
+		for i, pair := range e.Items {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(pair.Key, levelCond, false)
+			p.write(": ")
+			p.expr(pair.Value, levelCond, false)
+		}
+		p.write("}")
+	default:
+		p.failf("%T has no template syntax", expr)
+	}
+}
+
+func isString(v any) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+// test writes a test, tests without arguments are put in parentheses
+// before keywords.
+func (p *printer) test(test *nodes.Test, negated bool, keyword bool) {
+	hasArgs := len(test.Args) > 0 || len(test.Kwargs) > 0 || test.DynArgs != nil || test.DynKwargs != nil
+	if keyword && !hasArgs {
+		p.write("(")
+		defer p.write(")")
+	}
+	if test.Node == nil {
+		p.failf("missing tested expression")
+		return
+	}
+	// a test can't be tested without parentheses
+	p.expr(*test.Node, levelUnary, true)
+	p.write(" is ")
+	if negated {
+		p.write("not ")
+	}
+	p.write(test.Name)
+	if hasArgs {
+		p.args(test.Args, test.Kwargs, test.DynArgs, test.DynKwargs)
+	}
+}
+
+func (p *printer) subscript(arg nodes.Expr) {
+	slice, ok := arg.(*nodes.Slice)
+	if !ok {
+		p.expr(arg, levelCond, false)
+		return
+	}
+	for i, part := range []*nodes.Expr{slice.Start, slice.Stop, slice.Step} {
+		if i == 2 && part == nil {
+			break
+		}
+		if i > 0 {
+			p.write(":")
+		}
+		if part != nil {
+			p.expr(*part, levelCond, false)
+		}
+	}
+}
+
+func (p *printer) args(args []nodes.Expr, kwargs []nodes.Keyword, dynArgs *nodes.Expr, dynKwargs *nodes.Expr) {
+	p.write("(")
+	p.items(args, levelCond, false)
+	sep := len(args) > 0
+	for _, kwarg := range kwargs {
+		if sep {
+			p.write(", ")
+		}
+		p.write(kwarg.Key, "=")
+		p.expr(kwarg.Value, levelCond, false)
+		sep = true
+	}
+	for _, dyn := range []struct {
+		prefix string
+		expr   *nodes.Expr
+	}{{"*", dynArgs}, {"**", dynKwargs}} {
+		if dyn.expr == nil {
+			continue
+		}
+		if sep {
+			p.write(", ")
+		}
+		p.write(dyn.prefix)
+		p.expr(*dyn.expr, levelCond, false)
+		sep = true
+	}
+	p.write(")")
+}
+
+// value writes a constant, the lists and dicts of constants computed by the
+// optimizer included.
+func (p *printer) value(v any) {
+	switch v := v.(type) {
+	case nil:
+		p.write("none")
+	case bool:
+		p.write(strconv.FormatBool(v))
+	case int64:
+		p.write(strconv.FormatInt(v, 10))
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			p.failf("%v has no template syntax", v)
+			return
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		p.write(s)
+	case string:
+		p.write(Quote(v, p.quote))
+	case []any:
+		p.write("[")
+		for i, item := range v {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.value(item)
+		}
+		p.write("]")
+	case map[any]any:
+		keys := make([]string, 0, len(v))
+		values := make(map[string]any, len(v))
+		for key, value := range v {
+			keyPrinter := &printer{quote: p.quote}
+			keyPrinter.value(key)
+			if keyPrinter.err != nil {
+				p.failf("%v", keyPrinter.err)
+				return
+			}
+			keys = append(keys, keyPrinter.builder.String())
+			values[keys[len(keys)-1]] = value
+		}
+		slices.Sort(keys)
+		p.write("{")
+		for i, key := range keys {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(key, ": ")
+			p.value(values[key])
+		}
+		p.write("}")
+	default:
+		p.failf("the constant %#v has no template syntax", v)
+	}
+}
+
+// Quote returns a string literal for s with the given quote, the special
+// characters are escaped like the lexer reads them.
+func Quote(s string, quote rune) string {
+	var builder strings.Builder
+	builder.WriteRune(quote)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			// invalid UTF-8 is read as is
+			builder.WriteByte(s[i])
+		case r == '\\' || r == quote:
+			builder.WriteRune('\\')
+			builder.WriteRune(r)
+		case r == '\n':
+			builder.WriteString(`\n`)
+		case r == '\r':
+			builder.WriteString(`\r`)
+		case r == '\t':
+			builder.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			_, _ = fmt.Fprintf(&builder, `\x%02x`, r)
+		case unicode.IsPrint(r):
+			builder.WriteRune(r)
+		case r <= 0xffff:
+			_, _ = fmt.Fprintf(&builder, `\u%04x`, r)
+		default:
+			_, _ = fmt.Fprintf(&builder, `\U%08x`, r)
+		}
+		i += size
+	}
+	builder.WriteRune(quote)
+	return builder.String()
+}
+
+// header returns the content of the tag starting a statement, like
+// `for x in y`. It's false for the nodes that aren't statements.
+func (p *printer) header(node nodes.Node) bool {
+	switch n := node.(type) {
+	case *nodes.For:
+		p.write("for ")
+		target, ok := n.Target.(nodes.Expr)
+		iter, ok2 := n.Iter.(nodes.Expr)
+		if !ok || !ok2 {
+			p.failf("unexpected loop %T in %T", n.Target, n.Iter)
+			return true
+		}
+		p.tuple(target, levelPostfix, true)
+		p.write(" in ")
+		p.tuple(iter, levelOr, n.Test != nil || n.Recursive)
+		if n.Test != nil {
+			test, ok := (*n.Test).(nodes.Expr)
+			if !ok {
+				p.failf("unexpected loop test %T", *n.Test)
+				return true
+			}
+			p.write(" if ")
+			p.expr(test, levelCond, n.Recursive)
+		}
+		if n.Recursive {
+			p.write(" recursive")
+		}
+	case *nodes.If:
+		test, ok := n.Test.(nodes.Expr)
+		if !ok {
+			p.failf("unexpected test %T", n.Test)
+			return true
+		}
+		p.write("if ")
+		p.tuple(test, levelOr, false)
+	case *nodes.Macro:
+		p.write("macro ", n.Name)
+		p.signature(n.MacroCall)
+	case *nodes.CallBlock:
+		p.write("call")
+		if len(n.Args) > 0 {
+			p.signature(n.MacroCall)
+		}
+		p.write(" ")
+		p.expr(&n.Call, levelCond, false)
+	case *nodes.FilterBlock:
+		p.write("filter ")
+		p.expr(n.Filter, levelCond, false)
+	case *nodes.With:
+		p.write("with")
+		for i, target := range n.Targets {
+			if i > 0 {
+				p.write(",")
+			}
+			p.write(" ")
+			p.expr(target, levelPostfix, false)
+			p.write(" = ")
+			if i < len(n.Values) {
+				p.expr(n.Values[i], levelCond, false)
+			}
+		}
+	case *nodes.Block:
+		p.write("block ", n.Name)
+		if n.Scoped {
+			p.write(" scoped")
+		}
+		if n.Required {
+			p.write(" required")
+		}
+	case *nodes.Extends:
+		p.write("extends ")
+		p.expr(n.Template, levelCond, false)
+	case *nodes.Include:
+		p.write("include ")
+		p.expr(n.Template, levelCond, n.IgnoreMissing || !n.WithContext)
+		if n.IgnoreMissing {
+			p.write(" ignore missing")
+		}
+		if !n.WithContext {
+			p.write(" without context")
+		}
+	case *nodes.Import:
+		p.write("import ")
+		p.expr(n.Template, levelCond, true)
+		p.write(" as ", n.Target)
+		if n.WithContext {
+			p.write(" with context")
+		}
+	case *nodes.FromImport:
+		p.write("from ")
+		p.expr(n.Template, levelCond, true)
+		p.write(" import ")
+		for i, name := range n.Names {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(strings.Join(name, " as "))
+		}
+		if n.WithContext {
+			p.write(" with context")
+		}
+	case *nodes.Assign:
+		value, ok := n.Node.(nodes.Expr)
+		if !ok {
+			p.failf("unexpected assigned %T", n.Node)
+			return true
+		}
+		p.write("set ")
+		p.expr(n.Target, levelPostfix, false)
+		p.write(" = ")
+		p.tuple(value, levelCond, false)
+	case *nodes.AssignBlock:
+		p.write("set ")
+		p.expr(n.Target, levelPostfix, false)
+		if n.Filter != nil {
+			p.write(" | ")
+			p.expr(n.Filter, levelCond, false)
+		}
+	case *nodes.Output:
+		p.write("print ")
+		p.items(n.Nodes, levelCond, false)
+	case *nodes.ExprStmt:
+		p.write("do ")
+		p.tuple(n.Node, levelCond, false)
+	case *nodes.Break:
+		p.write("break")
+	case *nodes.Continue:
+		p.write("continue")
+	case *nodes.Scope:
+		if len(n.Body) != 1 {
+			return false
+		}
+		return p.header(n.Body[0])
+	case *nodes.ScopedEvalContextModifier:
+		if len(n.Options) != 1 || n.Options[0].Key != "autoescape" {
+			p.failf("only autoescape blocks can be printed")
+			return true
+		}
+		p.write("autoescape ")
+		p.expr(n.Options[0].Value, levelCond, false)
+	default:
+		return false
+	}
+	return true
+}
+
+func (p *printer) signature(call nodes.MacroCall) {
+	p.write("(")
+	defaults := len(call.Args) - len(call.Defaults)
+	for i, arg := range call.Args {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.write(arg.Name)
+		if i >= defaults {
+			p.write("=")
+			p.expr(call.Defaults[i-defaults], levelCond, false)
+		}
+	}
+	p.write(")")
+}
+
+// open writes the start of a block tag, the whitespace before it is kept.
+func (p *printer) open() {
+	p.write(p.env.BlockStartString)
+	if p.env.LStripBlocks {
+		p.write("+")
+	}
+	p.write(" ")
+}
+
+// close writes the end of a block tag, the data after it is kept.
+func (p *printer) close() {
+	p.write(" ", p.env.BlockEndString)
+	if p.env.TrimBlocks {
+		// the newline removed after the tag
+		p.write("\n")
+	}
+}
+
+// tag writes a block tag with the given content.
+func (p *printer) tag(content string) {
+	p.open()
+	p.write(content)
+	p.close()
+}
+
+func (p *printer) headerTag(node nodes.Node) {
+	p.open()
+	if !p.header(node) {
+		p.failf("%T has no template syntax", node)
+	}
+	p.close()
+}
+
+func (p *printer) body(body []nodes.Node) {
+	for _, node := range body {
+		p.stmt(node)
+	}
+}
+
+// stmt writes a statement with its body.
+func (p *printer) stmt(node nodes.Node) {
+	if p.err != nil {
+		return
+	}
+	switch n := node.(type) {
+	case *nodes.Template:
+		p.body(n.Body)
+	case *nodes.Output:
+		for _, expr := range n.Nodes {
+			if data, ok := expr.(*nodes.TemplateData); ok {
+				p.data(data.Data)
+				continue
+			}
+			p.write(p.env.VariableStartString, " ")
+			p.tuple(expr, levelCond, false)
+			p.write(" ", p.env.VariableEndString)
+		}
+	case *nodes.If:
+		p.headerTag(n)
+		p.body(n.Body)
+		for _, elif := range n.Elif {
+			test, ok := elif.Test.(nodes.Expr)
+			if !ok {
+				p.failf("unexpected test %T", elif.Test)
+				return
+			}
+			p.open()
+			p.write("elif ")
+			p.tuple(test, levelOr, false)
+			p.close()
+			p.body(elif.Body)
+		}
+		if len(n.Else) > 0 {
+			p.tag("else")
+			p.body(n.Else)
+		}
+		p.tag("endif")
+	case *nodes.For:
+		p.headerTag(n)
+		p.body(n.Body)
+		if len(n.Else) > 0 {
+			p.tag("else")
+			p.body(n.Else)
+		}
+		p.tag("endfor")
+	case *nodes.Macro:
+		p.bodyStmt(n, n.Body, "endmacro")
+	case *nodes.CallBlock:
+		p.bodyStmt(n, n.Body, "endcall")
+	case *nodes.FilterBlock:
+		p.bodyStmt(n, n.Body, "endfilter")
+	case *nodes.With:
+		p.bodyStmt(n, n.Body, "endwith")
+	case *nodes.Block:
+		p.bodyStmt(n, n.Body, "endblock")
+	case *nodes.AssignBlock:
+		p.bodyStmt(n, n.Body, "endset")
+	case *nodes.ScopedEvalContextModifier:
+		p.bodyStmt(n, n.Body, "endautoescape")
+	case *nodes.Scope:
+		if len(n.Body) != 1 {
+			p.failf("only autoescape scopes can be printed")
+			return
+		}
+		if _, ok := n.Body[0].(*nodes.ScopedEvalContextModifier); !ok {
+			p.failf("only autoescape scopes can be printed")
+			return
+		}
+		p.stmt(n.Body[0])
+	case *nodes.Extends, *nodes.Include, *nodes.Import, *nodes.FromImport, *nodes.Assign, *nodes.ExprStmt, *nodes.Break, *nodes.Continue:
+		p.headerTag(n)
+	default:
+		p.failf("%T has no template syntax", node)
+	}
+}
+
+func (p *printer) bodyStmt(node nodes.Node, body []nodes.Node, end string) {
+	p.headerTag(node)
+	p.body(body)
+	p.tag(end)
+}
+
+// data writes template data, in a raw block if it contains delimiters.
+func (p *printer) data(data string) {
+	raw := false
+	for _, delimiter := range []string{p.env.BlockStartString, p.env.VariableStartString, p.env.CommentStartString} {
+		raw = raw || strings.Contains(data, delimiter)
+	}
+	for _, prefix := range []*string{p.env.LineStatementPrefix, p.env.LineCommentPrefix} {
+		raw = raw || (prefix != nil && strings.Contains(data, *prefix))
+	}
+	if !raw {
+		p.write(data)
+		return
+	}
+	if strings.Contains(data, "endraw") {
+		p.failf("can't print the template data %q", data)
+		return
+	}
+	p.tag("raw")
+	p.write(data)
+	p.tag("endraw")
+}
@@ -1,6 +1,11 @@
 package lexer
 
-import "github.com/gojinja/gojinja/src/defaults"
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/defaults"
+	"golang.org/x/exp/slices"
+	"strings"
+)
 
 type EnvLexerInformation struct {
 	BlockStartString    string
@@ -33,3 +38,57 @@ func DefaultEnvLexerInformation() *EnvLexerInformation {
 		KeepTrailingNewline: defaults.KeepTrailingNewline,
 	}
 }
+
+// delimiter is a delimiter of the lexer information, with the name of its
+// field for the errors.
+type delimiter struct {
+	name  string
+	value string
+}
+
+// Validate checks that the lexer can tell the delimiters apart: they can't
+// be empty, the start strings and the line prefixes must be different, and
+// the end strings must be equal, like `}` in LaTeX templates, or not start
+// with one another, so a tag can't end with the end of another kind of tag.
+func (env *EnvLexerInformation) Validate() error {
+	starts := []delimiter{
+		{"BlockStartString", env.BlockStartString},
+		{"VariableStartString", env.VariableStartString},
+		{"CommentStartString", env.CommentStartString},
+	}
+	if env.LineStatementPrefix != nil {
+		starts = append(starts, delimiter{"LineStatementPrefix", *env.LineStatementPrefix})
+	}
+	if env.LineCommentPrefix != nil {
+		starts = append(starts, delimiter{"LineCommentPrefix", *env.LineCommentPrefix})
+	}
+	ends := []delimiter{
+		{"BlockEndString", env.BlockEndString},
+		{"VariableEndString", env.VariableEndString},
+		{"CommentEndString", env.CommentEndString},
+	}
+
+	for _, d := range append(append([]delimiter(nil), starts...), ends...) {
+		if d.value == "" {
+			return fmt.Errorf("'%s' can't be empty", d.name)
+		}
+	}
+	for i, a := range starts {
+		for _, b := range starts[i+1:] {
+			if a.value == b.value {
+				return fmt.Errorf("'%s' and '%s' must be different", a.name, b.name)
+			}
+		}
+	}
+	for i, a := range ends {
+		for _, b := range ends[i+1:] {
+			if a.value != b.value && (strings.HasPrefix(a.value, b.value) || strings.HasPrefix(b.value, a.value)) {
+				return fmt.Errorf("'%s' %q and '%s' %q must be equal or not start with one another", a.name, a.value, b.name, b.value)
+			}
+		}
+	}
+	if !slices.Contains([]string{"\n", "\r\n", "\r"}, env.NewlineSequence) {
+		return fmt.Errorf("'NewlineSequence' must be one of '\\n', '\\r\\n', or '\\r'")
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// headerPrefix starts the content of the header directive.
+const headerPrefix = "gojinja:"
+
+// headerStrings are the string settings of the header directive.
+var headerStrings = map[string]func(env *EnvLexerInformation) *string{
+	"block_start_string":    func(env *EnvLexerInformation) *string { return &env.BlockStartString },
+	"block_end_string":      func(env *EnvLexerInformation) *string { return &env.BlockEndString },
+	"variable_start_string": func(env *EnvLexerInformation) *string { return &env.VariableStartString },
+	"variable_end_string":   func(env *EnvLexerInformation) *string { return &env.VariableEndString },
+	"comment_start_string":  func(env *EnvLexerInformation) *string { return &env.CommentStartString },
+	"comment_end_string":    func(env *EnvLexerInformation) *string { return &env.CommentEndString },
+}
+
+// headerPrefixes are the settings of the header directive that can be none.
+var headerPrefixes = map[string]func(env *EnvLexerInformation) **string{
+	"line_statement_prefix": func(env *EnvLexerInformation) **string { return &env.LineStatementPrefix },
+	"line_comment_prefix":   func(env *EnvLexerInformation) **string { return &env.LineCommentPrefix },
+}
+
+// headerBools are the boolean settings of the header directive.
+var headerBools = map[string]func(env *EnvLexerInformation) *bool{
+	"trim_blocks":           func(env *EnvLexerInformation) *bool { return &env.TrimBlocks },
+	"lstrip_blocks":         func(env *EnvLexerInformation) *bool { return &env.LStripBlocks },
+	"keep_trailing_newline": func(env *EnvLexerInformation) *bool { return &env.KeepTrailingNewline },
+}
+
+// header is the header directive at the start of a template.
+type header struct {
+	env *EnvLexerInformation
+	// contentStart and contentEnd delimit the content of the comment, end
+	// is the end of the header, after the newline ending its line.
+	contentStart, contentEnd, end int
+}
+
+// headerError is an error in the header directive, at pos in the source.
+type headerError struct {
+	pos int
+	msg string
+}
+
+func (e *headerError) Error() string {
+	return e.msg
+}
+
+// ReadHeader returns the lexer information of a template: env, with the
+// settings of the header directive if the template starts with one. The
+// directive is a comment written with the delimiters of env:
+//
+//	{# gojinja: variable_start_string="<<" variable_end_string=">>" #}
+//
+// The settings are the lexer settings of Jinja's environments, except
+// newline_sequence. Their values are string literals, `true`, `false`, or
+// `none` for the line prefixes. The header takes its line, the newline
+// after it isn't part of the template data.
+func ReadHeader(env *EnvLexerInformation, source string) (*EnvLexerInformation, error) {
+	h, err := readHeader(env, source)
+	if err != nil {
+		return nil, err
+	}
+	if h == nil {
+		return env, nil
+	}
+	return h.env, nil
+}
+
+// readHeader parses the header directive at the start of source, it returns
+// nil if there's none.
+func readHeader(env *EnvLexerInformation, source string) (*header, error) {
+	if env.CommentStartString == "" || !strings.HasPrefix(source, env.CommentStartString) {
+		return nil, nil
+	}
+	contentStart := len(env.CommentStartString)
+	pos := skipHeaderSpace(source, contentStart)
+	if !strings.HasPrefix(source[pos:], headerPrefix) {
+		return nil, nil
+	}
+	pos += len(headerPrefix)
+
+	info := *env
+	for {
+		pos = skipHeaderSpace(source, pos)
+		if strings.HasPrefix(source[pos:], env.CommentEndString) {
+			break
+		}
+		if pos == len(source) {
+			return nil, &headerError{pos, "missing end of the header"}
+		}
+		keyStart := pos
+		for pos < len(source) && (source[pos] == '_' || (source[pos] >= 'a' && source[pos] <= 'z')) {
+			pos++
+		}
+		key := source[keyStart:pos]
+		if key == "" {
+			return nil, &headerError{pos, fmt.Sprintf("unexpected char %q in the header", source[pos])}
+		}
+		pos = skipHeaderSpace(source, pos)
+		if pos == len(source) || source[pos] != '=' {
+			return nil, &headerError{pos, fmt.Sprintf("expected '=' after '%s' in the header", key)}
+		}
+		valueStart := skipHeaderSpace(source, pos+1)
+		value, end, err := headerValue(source, valueStart)
+		if err != nil {
+			return nil, &headerError{valueStart, err.Error()}
+		}
+		if err = setHeaderSetting(&info, key, value); err != nil {
+			return nil, &headerError{keyStart, err.Error()}
+		}
+		pos = end
+	}
+
+	h := &header{env: &info, contentStart: contentStart, contentEnd: pos}
+	h.end = pos + len(env.CommentEndString)
+	if strings.HasPrefix(source[h.end:], "\r\n") {
+		h.end += 2
+	} else if h.end < len(source) && (source[h.end] == '\n' || source[h.end] == '\r') {
+		h.end++
+	}
+	if err := info.Validate(); err != nil {
+		return nil, &headerError{contentStart, "invalid header: " + err.Error()}
+	}
+	return h, nil
+}
+
+func skipHeaderSpace(source string, pos int) int {
+	for pos < len(source) && isSpace(source[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// headerValue parses the value of a setting at pos, a string literal, a
+// boolean or none. It returns the value and its end.
+func headerValue(source string, pos int) (any, int, error) {
+	if pos < len(source) && (source[pos] == '"' || source[pos] == '\'') {
+		quote := source[pos]
+		for end := pos + 1; end < len(source); end++ {
+			switch source[end] {
+			case '\\':
+				end++
+			case quote:
+				value, err := unescapeString(source[pos+1 : end])
+				return value, end + 1, err
+			}
+		}
+		return nil, 0, fmt.Errorf("unterminated string in the header")
+	}
+	end := pos
+	for end < len(source) && ((source[end] >= 'a' && source[end] <= 'z') || (source[end] >= 'A' && source[end] <= 'Z')) {
+		end++
+	}
+	switch source[pos:end] {
+	case "true", "True":
+		return true, end, nil
+	case "false", "False":
+		return false, end, nil
+	case "none", "None":
+		return nil, end, nil
+	}
+	return nil, 0, fmt.Errorf("expected a string, a boolean or none in the header")
+}
+
+func setHeaderSetting(env *EnvLexerInformation, key string, value any) error {
+	if field, ok := headerStrings[key]; ok {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("'%s' must be a string", key)
+		}
+		*field(env) = s
+		return nil
+	}
+	if field, ok := headerPrefixes[key]; ok {
+		switch v := value.(type) {
+		case string:
+			*field(env) = &v
+		case nil:
+			*field(env) = nil
+		default:
+			return fmt.Errorf("'%s' must be a string or none", key)
+		}
+		return nil
+	}
+	if field, ok := headerBools[key]; ok {
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("'%s' must be a boolean", key)
+		}
+		*field(env) = b
+		return nil
+	}
+	return fmt.Errorf("unknown setting '%s' in the header", key)
+}
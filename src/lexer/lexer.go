@@ -4,12 +4,13 @@ import (
 	"fmt"
 	"github.com/gojinja/gojinja/src/errors"
 	"github.com/gojinja/gojinja/src/utils/identifier"
-	"github.com/gojinja/gojinja/src/utils/stack"
 	"github.com/hashicorp/golang-lru"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode"
+	"unicode/utf16"
 )
 
 var lexerCache *lru.Cache
@@ -23,30 +24,26 @@ func init() {
 	}
 }
 
-func toStr(s *string) string {
-	if s == nil {
-		return ""
-	}
-	return *s
+// cacheKey identifies the lexers of equal lexer information. The line
+// prefixes are pointers, they are compared by value.
+type cacheKey struct {
+	info                   EnvLexerInformation
+	lineStatementPrefix    string
+	lineCommentPrefix      string
+	hasLineStatementPrefix bool
+	hasLineCommentPrefix   bool
 }
 
-func toCacheKey(env *EnvLexerInformation) string {
-	els := []string{
-		env.BlockStartString,
-		env.BlockEndString,
-		env.VariableStartString,
-		env.VariableEndString,
-		env.CommentStartString,
-		env.CommentEndString,
-		toStr(env.LineStatementPrefix),
-		toStr(env.LineCommentPrefix),
-		strconv.FormatBool(env.TrimBlocks),
-		strconv.FormatBool(env.LStripBlocks),
-		env.NewlineSequence,
-		strconv.FormatBool(env.KeepTrailingNewline),
+func toCacheKey(env *EnvLexerInformation) cacheKey {
+	key := cacheKey{info: *env}
+	key.info.LineStatementPrefix, key.info.LineCommentPrefix = nil, nil
+	if env.LineStatementPrefix != nil {
+		key.lineStatementPrefix, key.hasLineStatementPrefix = *env.LineStatementPrefix, true
 	}
-
-	return strings.Join(els, "^%&*$!*")
+	if env.LineCommentPrefix != nil {
+		key.lineCommentPrefix, key.hasLineCommentPrefix = *env.LineCommentPrefix, true
+	}
+	return key
 }
 
 func GetLexer(env *EnvLexerInformation) *Lexer {
@@ -59,112 +56,35 @@ func GetLexer(env *EnvLexerInformation) *Lexer {
 	return l
 }
 
-type rule struct {
-	pattern *regexp.Regexp
-	tokens  any
-	command *string
-}
-
 // Lexer is a struct that implements a lexer for a given environment. Automatically
 // created by the environment class, usually you don't have to do that.
 //
 // Note that the lexer is not automatically bound to an environment.
 // Multiple environments can share the same lexer.
 type Lexer struct {
+	env                 EnvLexerInformation
 	lStripBlocks        bool
 	newlineSequence     string
 	keepTrailingNewline bool
-	rules               map[string][]rule
+	// rootRules are the tags the scanner looks for in the template data, in
+	// the order they are tried at the same position.
+	rootRules []rootRule
+
+	rulesOnce sync.Once
+	rules     map[string][]rule
 }
 
 func New(env *EnvLexerInformation) *Lexer {
-	tagRules := []rule{
-		{whitespaceRe, TokenWhitespace, nil},
-		{floatRe, TokenFloat, nil},
-		{integerRe, TokenInteger, nil},
-		{identifier.NameRe, TokenName, nil},
-		{stringRe, TokenString, nil},
-		{operatorRe, TokenOperator, nil},
-	}
-
-	rootTagRules := compileRules(env)
-	blockStartRe := regexp.QuoteMeta(env.BlockStartString)
-	blockEndRe := regexp.QuoteMeta(env.BlockEndString)
-	commentEndRe := regexp.QuoteMeta(env.CommentEndString)
-	variableEndRe := regexp.QuoteMeta(env.VariableEndString)
-
-	blockSuffixRe := ""
-	if env.TrimBlocks {
-		blockSuffixRe = "\\n?"
-	}
-
-	rootRawRe := fmt.Sprintf(`(?P<raw_begin>%s(\-|\+|)\s*raw\s*(?:\-%s\s*|%s))`, blockStartRe, blockEndRe, blockEndRe)
-	rootPartsReArr := make([]string, 0, len(rootTagRules)+1)
-	rootPartsReArr = append(rootPartsReArr, rootRawRe)
-	for _, r := range rootTagRules {
-		rootPartsReArr = append(rootPartsReArr, fmt.Sprintf(`(?P<%s>%s(\-|\+|))`, r.name, r.pattern))
-	}
-	rootPartsRe := strings.Join(rootPartsReArr, "|")
-	popCmd := "#pop"
-	byGrpCmd := "#bygroup"
-
 	return &Lexer{
+		env:                 *env,
 		lStripBlocks:        env.LStripBlocks,
 		newlineSequence:     env.NewlineSequence,
 		keepTrailingNewline: env.KeepTrailingNewline,
-		rules: map[string][]rule{
-			"root": {
-				{
-					c(fmt.Sprintf(`^(.*?)(?:%s)`, rootPartsRe)),
-					OptionalLStrip{data: []string{TokenData, byGrpCmd}},
-					&byGrpCmd,
-				}, // directives
-				{c("^.+"), TokenData, nil}, // data
-			},
-			TokenCommentBegin: {
-				{
-					c(fmt.Sprintf(`^(.*?)((?:\+%s|\-%s\s*|%s%s))`, commentEndRe, commentEndRe, commentEndRe, blockSuffixRe)),
-					[]string{TokenComment, TokenCommentEnd},
-					&popCmd,
-				},
-				{c(`^(.)`), Failure{"Missing end of comment tag"}, nil},
-			},
-			TokenBlockBegin: append([]rule{
-				{
-					c(fmt.Sprintf(`^(?:\+%s|\-%s\s*|%s%s)`, blockEndRe, blockEndRe, blockEndRe, blockSuffixRe)),
-					TokenBlockEnd,
-					&popCmd,
-				},
-			}, tagRules...),
-			TokenVariableBegin: append([]rule{
-				{
-					c(fmt.Sprintf(`^\-%s\s*|^%s`, variableEndRe, variableEndRe)),
-					TokenVariableEnd,
-					&popCmd,
-				},
-			}, tagRules...),
-			TokenRawBegin: append([]rule{
-				{
-					c(fmt.Sprintf(`^(.*?)((?:%s(\-|\+|))\s*endraw\s*(?:\+%s|\-%s\s*|%s%s))`, blockStartRe, blockEndRe, blockEndRe, blockEndRe, blockSuffixRe)),
-					OptionalLStrip{data: []string{TokenData, TokenRawEnd}},
-					&popCmd,
-				},
-			}, tagRules...),
-			TokenLinestatementBegin: append([]rule{
-				{c(`^\s*(\n|$)`), TokenLinestatementEnd, &popCmd},
-			}, tagRules...),
-			TokenLinecommentBegin: {
-				{
-					c(`^(.*?)()(?:\n|$)`),
-					[]string{TokenLinecomment, TokenLinecommentEnd},
-					&popCmd,
-				},
-			},
-		},
+		rootRules:           compileRootRules(env),
 	}
 }
 
-func (l Lexer) normalizeNewlines(value string) string {
+func (l *Lexer) normalizeNewlines(value string) string {
 	return newlineRe.ReplaceAllString(value, l.newlineSequence)
 }
 
@@ -185,10 +105,40 @@ type tokenRaw struct {
 	lineno   int
 	token    string
 	valueStr string
+	span     Span
+}
+
+// sourceMap converts offsets in the normalized source, where every newline
+// is "\n", into positions in the source the lexer was given.
+type sourceMap struct {
+	lineStarts     []int
+	originalStarts []int
+}
+
+func (m sourceMap) position(offset int) Position {
+	line := sort.SearchInts(m.lineStarts, offset+1) - 1
+	col := offset - m.lineStarts[line]
+	return Position{Offset: m.originalStarts[line] + col, Lineno: line + 1, Col: col}
 }
 
-// OptionalLStrip is used for marking a point in the state that can have lstrip applied.
-type OptionalLStrip struct{ data []string }
+func (m sourceMap) span(start, end int) Span {
+	return Span{m.position(start), m.position(end)}
+}
+
+// Lex tokenizes the text like Tokeniter, without wrapping the tokens: the
+// values are the source strings and the ignored tokens, like comments, are
+// kept. It's meant for tools working on the template source.
+func (l *Lexer) Lex(source string, name *string, filename *string) ([]Token, error) {
+	stream, err := l.Tokeniter(source, name, filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Token, 0, len(stream))
+	for _, raw := range stream {
+		ret = append(ret, Token{raw.lineno, raw.token, raw.valueStr, raw.span})
+	}
+	return ret, nil
+}
 
 // Wrap is called with the stream as returned by `tokenize` and wraps
 // every token in a `Token` and converts the value.
@@ -214,10 +164,14 @@ func (l *Lexer) Wrap(stream []tokenRaw, name *string, filename *string) ([]Token
 			token = raw.valueStr
 		case TokenName:
 			if !identifier.IsIdentifier(raw.valueStr) {
-				return nil, errors.TemplateSyntaxError("Invalid character in identifier", raw.lineno, name, filename)
+				return nil, errors.TemplateSyntaxErrorAt("Invalid character in identifier", raw.lineno, raw.span.Start.Col+1, name, filename)
 			}
 		case TokenString:
-			value = unescapeString(l.normalizeNewlines(raw.valueStr[1 : len(raw.valueStr)-1]))
+			v, err := unescapeString(l.normalizeNewlines(raw.valueStr[1 : len(raw.valueStr)-1]))
+			if err != nil {
+				return nil, errors.TemplateSyntaxErrorAt(err.Error(), raw.lineno, raw.span.Start.Col+1, name, filename)
+			}
+			value = v
 		case TokenInteger:
 			v, err := strconv.ParseInt(strings.Replace(raw.valueStr, "_", "", -1), 0, 64)
 			if err != nil {
@@ -234,214 +188,82 @@ func (l *Lexer) Wrap(stream []tokenRaw, name *string, filename *string) ([]Token
 		case TokenOperator:
 			token = operators[raw.valueStr]
 		}
-		ret = append(ret, Token{raw.lineno, token, value})
+		ret = append(ret, Token{raw.lineno, token, value, raw.span})
 	}
 	return ret, nil
 }
 
 // Tokeniter tokenizes the text and returns the tokens.
 // Use this method if you just want to tokenize a template.
-func (l *Lexer) Tokeniter(source string, name *string, filename *string, state *string) (ret []tokenRaw, err error) {
-	lines := newlineRe.Split(source, -1)
-	if !l.keepTrailingNewline && lines[len(lines)-1] == "" {
-		lines = lines[:len(lines)-1]
-	}
-
-	source = strings.Join(lines, "\n")
-	pos := 0
-	lineno := 1
-	st := stack.New[string]()
-	st.Push("root")
-
-	if state != nil && *state != "root" {
-		if *state != "variable" && *state != "block" {
-			return nil, fmt.Errorf("invalid state")
+// The text is tokenized by a scanner, see tokeniterRegexp for the regular
+// expressions it's equivalent to. A template starting with a header
+// directive is tokenized with the settings of the header, see ReadHeader.
+func (l *Lexer) Tokeniter(source string, name *string, filename *string, state *string) ([]tokenRaw, error) {
+	if state == nil || *state == "root" {
+		h, err := readHeader(&l.env, source)
+		if err != nil {
+			hErr := err.(*headerError)
+			return nil, Failure{hErr.msg}.Error(1+CountNewlines(source[:hErr.pos]), filename)
+		}
+		if h != nil {
+			return GetLexer(h.env).tokeniterHeader(&l.env, source, name, filename)
 		}
-		st.Push(*state + "_begin")
 	}
-	stateTokens := l.rules[*st.Peek()]
-	sourceLength := len(source)
-	balancingStack := stack.New[string]()
-	newlinesStripped := 0
-	lineStarting := true
-
-	broke := true
-	for broke {
-		broke = false
-		// tokenizer loop
-		for _, sToks := range stateTokens {
-			// if no match we try again with the next rule
-			groups := sToks.pattern.FindStringSubmatch(source[pos:])
-			if len(groups) == 0 {
-				continue
-			}
-			grp := groups[0]
-			groups = groups[1:] // Remove first element as it's not in python counterpart.
-
-			// we only match blocks and variables if braces / parentheses
-			// are balanced. continue parsing with the lower rule which
-			// is the operator rule. do this only if the end tags look
-			// like operators
-			if balancingStack.Peek() != nil &&
-				(sToks.tokens == TokenVariableEnd ||
-					sToks.tokens == TokenBlockEnd ||
-					sToks.tokens == TokenLinestatementEnd) {
-				continue
-			}
-
-			// tuples support more options
-			if _, ok := sToks.tokens.(OptionalLStrip); ok {
-				// Rule supports lstrip. Match will look like
-				// text, block type, whitespace control, type, control, ...
-				text := groups[0]
-				// Skipping the text and first type, every other group is the
-				// whitespace control for each type. One of the groups will be
-				// -, +, or empty string instead of None.
-				stripSign := ""
-				for i := 2; i < len(groups); i += 2 {
-					if groups[i] != "" {
-						stripSign = groups[i]
-						break
-					}
-				}
-				if stripSign == "-" {
-					// Strip all whitespace between the text and the tag.
-					stripped := strings.TrimRightFunc(text, unicode.IsSpace)
-					newlinesStripped = strings.Count(text[len(stripped):], "\n")
-					groups = append([]string{stripped}, groups[1:]...)
-				} else if stripSign != "+" && l.lStripBlocks {
-					names := sToks.pattern.SubexpNames()[1:]
-					variableExpression := false
-					for i := 0; i < len(names); i++ {
-						if names[i] == TokenVariableBegin && groups[i] != "" {
-							variableExpression = true
-						}
-					}
-					if !variableExpression {
-						// The start of text between the last newline and the tag.
-						lPos := strings.LastIndex(text, "\n") + 1
-						if lPos > 0 || lineStarting {
-							// If there's only whitespace between the newline and the
-							// tag, strip it.
-							if fullmatch(whitespaceRe, text[lPos:]) {
-								groups = append([]string{text[:lPos]}, groups[1:]...)
-							}
-						}
-					}
-				}
-			}
-			if toks, ok := toToks(sToks.tokens); ok {
-				for idx, token := range toks {
-					if token == "#bygroup" {
-						// bygroup is a bit more complex, in that case we
-						// yield for the current token the first named
-						// group that matched
-						names := sToks.pattern.SubexpNames()[1:]
-						found := false
-						for i := 0; i < len(names); i++ {
-							if names[i] != "" && groups[i] != "" {
-								ret = append(ret, tokenRaw{lineno, names[i], groups[i]})
-								lineno += strings.Count(groups[i], "\n")
-								found = true
-								break
-							}
-						}
-						if !found {
-							return nil, fmt.Errorf("'%s' wanted to resolve the token dynamically but no group matched", sToks.pattern)
-						}
-					} else {
-						// normal group
-						data := groups[idx]
-						if data != "" || !ignoreIfEmpty.Has(token) {
-							ret = append(ret, tokenRaw{lineno, token, data})
-						}
-						lineno += strings.Count(data, "\n") + newlinesStripped
-						newlinesStripped = 0
-					}
-				}
-			} else if failure, ok := sToks.tokens.(Failure); ok {
-				return nil, failure.Error(lineno, filename)
-			} else if toks, ok := sToks.tokens.(string); ok {
-				// strings as token just are yielded as it.
-				data := grp
-				// update brace / parentheses balance
-				if toks == TokenOperator {
-					switch data {
-					case "{":
-						balancingStack.Push("}")
-					case "(":
-						balancingStack.Push(")")
-					case "[":
-						balancingStack.Push("]")
-					case "}", ")", "]":
-						exOp := balancingStack.Pop()
-						if exOp == nil {
-							return nil, errors.TemplateSyntaxError(fmt.Sprintf("unexpected '%s'", data), lineno, name, filename)
-						}
-						if *exOp != data {
-							return nil, errors.TemplateSyntaxError(fmt.Sprintf("unexpected '%s', expected '%s'", data, *exOp), lineno, name, filename)
-						}
-					}
-				}
-
-				// yield items
-				if data != "" || !ignoreIfEmpty.Has(toks) {
-					ret = append(ret, tokenRaw{lineno, toks, data})
-				}
-				lineno += strings.Count(data, "\n")
-			} else {
-				return nil, fmt.Errorf("unexpected type")
-			}
+	source, srcMap := l.normalize(source)
+	return newScanner(l, source, srcMap, name, filename).run(state)
+}
 
-			lineStarting = grp[len(grp)-1] == '\n'
-			// fetch new position into new variable so that we can check
-			// if there is a internal parsing error which would result
-			// in an infinite loop
-			idx := sToks.pattern.FindAllStringSubmatchIndex(source[pos:], -1)
-			pos2 := pos + idx[0][1]
-			// handle state changes
-			if sToks.command != nil {
-				// remove the uppermost state
-				if *sToks.command == "#pop" {
-					st.Pop()
-				} else if *sToks.command == "#bygroup" {
-					// resolve the new state by group checking
-					names := sToks.pattern.SubexpNames()[1:]
-					found := false
-					for i := 0; i < len(names); i++ {
-						if names[i] != "" && groups[i] != "" {
-							st.Push(names[i])
-							found = true
-							break
-						}
-					}
-					if !found {
-						return nil, fmt.Errorf("'%s' wanted to resolve the new state dynamically but no group matched", sToks.pattern)
-					}
-				} else {
-					st.Push(*sToks.command)
-				}
+// tokeniterHeader tokenizes a template starting with a header written with
+// the delimiters of env.
+func (l *Lexer) tokeniterHeader(env *EnvLexerInformation, source string, name *string, filename *string) ([]tokenRaw, error) {
+	source, srcMap := l.normalize(source)
+	h, err := readHeader(env, source)
+	if err != nil {
+		return nil, Failure{err.Error()}.Error(1, filename)
+	}
+	s := newScanner(l, source, srcMap, name, filename)
+	s.scanHeader(h)
+	return s.run(nil)
+}
 
-				stateTokens = l.rules[*st.Peek()]
-			} else if pos2 == pos {
-				// we are still at the same position and no stack change.
-				// this means a loop without break condition, avoid that and
-				// raise error
-				return nil, fmt.Errorf("'%s' yielded empty string without stack change", sToks.pattern)
+// normalize replaces the newlines of the source with "\n" and removes the
+// trailing one, unless it must be kept.
+func (l *Lexer) normalize(source string) (string, sourceMap) {
+	m := sourceMap{lineStarts: []int{0}, originalStarts: []int{0}}
+	var b strings.Builder
+	hasCR := strings.IndexByte(source, '\r') >= 0
+	if hasCR {
+		b.Grow(len(source))
+	}
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		if c != '\n' && c != '\r' {
+			if hasCR {
+				b.WriteByte(c)
 			}
-			// publish new function and start again
-			pos = pos2
-			broke = true
-			break
+			continue
 		}
+		if c == '\r' && i+1 < len(source) && source[i+1] == '\n' {
+			i++
+		}
+		if hasCR {
+			b.WriteByte('\n')
+			m.lineStarts = append(m.lineStarts, b.Len())
+		} else {
+			m.lineStarts = append(m.lineStarts, i+1)
+		}
+		m.originalStarts = append(m.originalStarts, i+1)
 	}
 
-	// if loop terminated without break we haven't found a single match
-	// either we are at the end of the file or we have a problem
-	if pos >= sourceLength {
-		return
+	normalized := source
+	if hasCR {
+		normalized = b.String()
+	}
+	if !l.keepTrailingNewline && strings.HasSuffix(normalized, "\n") {
+		normalized = normalized[:len(normalized)-1]
+		m.lineStarts = m.lineStarts[:len(m.lineStarts)-1]
 	}
-	return nil, errors.TemplateSyntaxError(fmt.Sprintf("unexpected char '%s' at %d", string(source[pos]), pos), lineno, name, filename)
+	return normalized, m
 }
 
 // Failure is used by the `Lexer` to specify known errors.
@@ -454,57 +276,100 @@ func (f Failure) Error(lineno int, filename *string) error {
 	return errors.TemplateSyntaxError(f.msg, lineno, filename, filename)
 }
 
-func toToks(tokens any) ([]string, bool) {
-	switch v := tokens.(type) {
-	case []string:
-		return v, true
-	case OptionalLStrip:
-		return v.data, true
-	default:
-		return nil, false
+// hexEscapes are the placeholders of the digits of the hexadecimal escapes.
+var hexEscapes = map[byte]string{'x': "hh", 'u': "XXXX", 'U': "XXXXXXXX"}
+
+// unescapeString decodes the escape sequences of a string literal like
+// Python does: `\\`, `\'`, `\"`, `\a`, `\b`, `\f`, `\n`, `\r`, `\t`, `\v`,
+// octal `\ooo`, `\xhh`, `\uXXXX` and `\UXXXXXXXX`. A backslash before a
+// newline joins the lines, other backslashes are kept as they are.
+func unescapeString(s string) (string, error) {
+	idx := strings.IndexByte(s, '\\')
+	if idx < 0 {
+		return s, nil
 	}
-}
-
-func fullmatch(re *regexp.Regexp, text string) bool {
-	l := len(text)
-	for _, m := range re.FindAllString(text, -1) {
-		if len(m) == l {
-			return true
-		}
-	}
-	return false
-}
-
-func unescapeString(s string) string {
-	backslashBefore := false
 	var builder strings.Builder
-	for _, c := range s {
-		if c == '\\' {
-			if backslashBefore {
-				builder.WriteString("\\\\")
-				backslashBefore = false
-			} else {
-				backslashBefore = true
-			}
-			continue
+	builder.Grow(len(s))
+	for idx >= 0 {
+		builder.WriteString(s[:idx])
+		s = s[idx+1:]
+		if s == "" {
+			return "", fmt.Errorf("\\ at end of string")
 		}
-
-		if c == '"' || c == '\'' {
-			backslashBefore = false
-		}
-
-		if backslashBefore {
-			builder.WriteRune('\\')
-			backslashBefore = false
+		c := s[0]
+		s = s[1:]
+		switch c {
+		case '\n':
+		case '\\', '\'', '"':
+			builder.WriteByte(c)
+		case 'a':
+			builder.WriteByte('\a')
+		case 'b':
+			builder.WriteByte('\b')
+		case 'f':
+			builder.WriteByte('\f')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'v':
+			builder.WriteByte('\v')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			code := rune(c - '0')
+			for i := 0; i < 2 && s != "" && s[0] >= '0' && s[0] <= '7'; i++ {
+				code = code*8 + rune(s[0]-'0')
+				s = s[1:]
+			}
+			builder.WriteRune(code)
+		case 'x', 'u', 'U':
+			digits := hexEscapes[c]
+			value, rest, err := unescapeHex(s, len(digits))
+			if err != nil {
+				return "", fmt.Errorf("truncated \\%c%s escape", c, digits)
+			}
+			// checked before the conversion, larger values make negative runes
+			if value > unicode.MaxRune {
+				return "", fmt.Errorf("illegal Unicode character \\%c%08x", c, value)
+			}
+			s = rest
+			code := rune(value)
+			if utf16.IsSurrogate(code) {
+				// Go strings can't hold lone surrogates, only pairs are accepted
+				high := code
+				code = unicode.ReplacementChar
+				if strings.HasPrefix(s, `\u`) {
+					if low, rest, err := unescapeHex(s[2:], 4); err == nil {
+						code, s = utf16.DecodeRune(high, rune(low)), rest
+					}
+				}
+				if code == unicode.ReplacementChar {
+					return "", fmt.Errorf("unpaired surrogate \\%c%0*x", c, len(digits), high)
+				}
+			}
+			builder.WriteRune(code)
+		case 'N':
+			return "", fmt.Errorf("\\N{...} escapes are not supported")
+		default:
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
 		}
-		builder.WriteRune(c)
-	}
-	if backslashBefore {
-		builder.WriteRune('\\')
+		idx = strings.IndexByte(s, '\\')
 	}
-	return builder.String()
+	builder.WriteString(s)
+	return builder.String(), nil
 }
 
-func c(x string) *regexp.Regexp {
-	return regexp.MustCompile("(?ms)" + x)
+// unescapeHex parses the size hexadecimal digits at the start of s and
+// returns the rest of s.
+func unescapeHex(s string, size int) (uint64, string, error) {
+	if len(s) < size {
+		return 0, "", strconv.ErrSyntax
+	}
+	code, err := strconv.ParseUint(s[:size], 16, 32)
+	if err != nil {
+		return 0, "", err
+	}
+	return code, s[size:], nil
 }
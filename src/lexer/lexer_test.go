@@ -1,18 +1,28 @@
 package lexer
 
 import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/errors"
 	"reflect"
+	"strings"
 	"testing"
 )
 
+// testToken is a Token without its span, spans are tested separately.
+type testToken struct {
+	Lineno int
+	Type   string
+	Value  any
+}
+
 type testLexer struct {
 	input string
-	res   []Token
+	res   []testToken
 }
 
 var cases = []testLexer{
 	{input: `{{ name }}`,
-		res: []Token{
+		res: []testToken{
 			{1, TokenVariableBegin, "{{"},
 			{1, TokenName, "name"},
 			{1, TokenVariableEnd, "}}"},
@@ -22,7 +32,7 @@ var cases = []testLexer{
 my name is {{ name }}
 {% endif %}
 {{ 5 + 1 }}`,
-		res: []Token{
+		res: []testToken{
 			{1, TokenBlockBegin, "{%"},
 			{1, TokenName, "if"},
 			{1, TokenName, "name"},
@@ -62,10 +72,11 @@ func runCase(c testLexer, t *testing.T) {
 	}
 	i := 0
 	for !s.Eos() {
-		tok := s.Next()
+		next := s.Next()
 		if i == len(c.res) {
-			t.Fatal("unexpected token", tok)
+			t.Fatal("unexpected token", next)
 		}
+		tok := testToken{next.Lineno, next.Type, next.Value}
 		if !reflect.DeepEqual(tok, c.res[i]) {
 			t.Fatal("expected", c.res[i], "got", tok)
 		}
@@ -76,6 +87,67 @@ func runCase(c testLexer, t *testing.T) {
 	}
 }
 
+func pos(offset, lineno, col int) Position {
+	return Position{Offset: offset, Lineno: lineno, Col: col}
+}
+
+func TestSpans(t *testing.T) {
+	info := DefaultEnvLexerInformation()
+	l := GetLexer(info)
+	s, err := l.Tokenize("a\r\n{{ foo }}\r\n{%- if x -%}\n  b{% endif %}", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Span{
+		{pos(0, 1, 0), pos(3, 2, 0)},    // data "a\n"
+		{pos(3, 2, 0), pos(5, 2, 2)},    // {{
+		{pos(6, 2, 3), pos(9, 2, 6)},    // foo
+		{pos(10, 2, 7), pos(12, 2, 9)},  // }}
+		{pos(14, 3, 0), pos(17, 3, 3)},  // {%-
+		{pos(18, 3, 4), pos(20, 3, 6)},  // if
+		{pos(21, 3, 7), pos(22, 3, 8)},  // x
+		{pos(23, 3, 9), pos(29, 4, 2)},  // -%} and the stripped whitespace
+		{pos(29, 4, 2), pos(30, 4, 3)},  // data "b"
+		{pos(30, 4, 3), pos(32, 4, 5)},  // {%
+		{pos(33, 4, 6), pos(38, 4, 11)}, // endif
+		{pos(39, 4, 12), pos(41, 4, 14)},
+	}
+	var spans []Span
+	for !s.Eos() {
+		spans = append(spans, s.Next().Span)
+	}
+	if len(spans) != len(expected) {
+		t.Fatal("expected", len(expected), "tokens, got", len(spans))
+	}
+	for i := range spans {
+		if spans[i] != expected[i] {
+			t.Fatalf("token %d: expected %#v, got %#v", i, expected[i], spans[i])
+		}
+	}
+	if eof := s.Current().Span; eof.Start != pos(41, 4, 14) || eof.Start != s.Previous().Span.End {
+		t.Fatal("unexpected eof span", eof)
+	}
+}
+
+func TestLex(t *testing.T) {
+	l := GetLexer(DefaultEnvLexerInformation())
+	tokens, err := l.Lex("{# note #}\n{{ 'a' }}", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, token := range tokens {
+		got = append(got, fmt.Sprintf("%d:%s:%v", token.Lineno, token.Type, token.Value))
+	}
+	expected := []string{
+		"1:comment_begin:{#", "1:comment: note ", "1:comment_end:#}", "1:data:\n",
+		"2:variable_begin:{{", "2:whitespace: ", "2:string:'a'", "2:whitespace: ", "2:variable_end:}}",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatal("expected", expected, "got", got)
+	}
+}
+
 func TestCountNewlines(t *testing.T) {
 	if CountNewlines("\nb\n\naaaaaa") != 3 {
 		t.Fatal("expected 3 newlines")
@@ -89,23 +161,246 @@ func TestCountNewlines(t *testing.T) {
 }
 
 type unescapeStringTest struct {
+	escaped   string
 	unescaped string
-	escape    string
 }
 
 var unescapeStringCases = []unescapeStringTest{
-	{"a\\\"b\\\"", "a\"b\""},
-	{"a\\'b\\'", "a'b'"},
-	{"a\\'b\\\"", "a'b\""},
-	{"a\\\\'b\\\"", "a\\\\'b\""},
-	{"a", "a"},
+	{`a`, "a"},
+	{`a\"b\"`, `a"b"`},
+	{`a\'b\'`, `a'b'`},
+	{`a\\'b\"`, `a\'b"`},
+	{`\\\\`, `\\`},
+	{`\a\b\f\n\r\t\v`, "\a\b\f\n\r\t\v"},
+	{`\0\7\101\1012\400`, "\x00\x07AA2Ā"},
+	{`\x41\x4a\x4A\xe9`, "AJJé"},
+	{`é€`, "é€"},
+	{`\U0001F600\U00000041`, "\U0001f600A"},
+	{`😀`, "\U0001f600"},
+	{"é\\\nb", "éb"},
+	{`\d\w\ `, `\d\w\ `},
 }
 
 func TestUnescapeString(t *testing.T) {
 	for _, c := range unescapeStringCases {
-		res := unescapeString(c.unescaped)
-		if res != unescapeString(c.escape) {
-			t.Fatal("got: ", c.unescaped, "expected: ", c.escape)
+		res, err := unescapeString(c.escaped)
+		if err != nil {
+			t.Fatal(c.escaped, err)
+		}
+		if res != c.unescaped {
+			t.Fatalf("%s: expected %q, got %q", c.escaped, c.unescaped, res)
+		}
+	}
+}
+
+func TestUnescapeStringErrors(t *testing.T) {
+	cases := map[string]string{
+		`\x4`:          `truncated \xhh escape`,
+		`\xg0`:         `truncated \xhh escape`,
+		`\u00e`:        `truncated \uXXXX escape`,
+		`\U0001F60`:    `truncated \UXXXXXXXX escape`,
+		`\U00110000`:   `illegal Unicode character \U00110000`,
+		`\UFFFFFFFF`:   `illegal Unicode character \Uffffffff`,
+		`\U80000000`:   `illegal Unicode character \U80000000`,
+		`\ud83d`:       `unpaired surrogate \ud83d`,
+		`\ude00\ud83d`: `unpaired surrogate \ude00`,
+		`\N{DASH}`:     `\N{...} escapes are not supported`,
+		`a\`:           `\ at end of string`,
+	}
+	for escaped, expected := range cases {
+		_, err := unescapeString(escaped)
+		if err == nil || err.Error() != expected {
+			t.Fatalf("%s: expected %q, got %v", escaped, expected, err)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	l := GetLexer(DefaultEnvLexerInformation())
+	s, err := l.Tokenize(`{{ "\x41\n" ~ 'é\'' }}`, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []any
+	for !s.Eos() {
+		if token := s.Next(); token.Type == TokenString {
+			values = append(values, token.Value)
+		}
+	}
+	if !reflect.DeepEqual(values, []any{"A\n", "é'"}) {
+		t.Fatal("unexpected strings", values)
+	}
+
+	_, err = l.Tokenize("{{ 'a' }}\n{{ 'b\\x4' }}", nil, nil, nil)
+	syntaxErr, ok := err.(*errors.SyntaxError)
+	if !ok || syntaxErr.Message != `truncated \xhh escape` || syntaxErr.Lineno != 2 || syntaxErr.Col != 4 {
+		t.Fatal("unexpected error", err)
+	}
+	_, err = l.Tokenize(`{{ "\UFFFFFFFF" }}`, nil, nil, nil)
+	if syntaxErr, ok = err.(*errors.SyntaxError); !ok || syntaxErr.Message != `illegal Unicode character \Uffffffff` {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+func latexEnv() *EnvLexerInformation {
+	env := DefaultEnvLexerInformation()
+	env.BlockStartString, env.BlockEndString = `\BLOCK{`, "}"
+	env.VariableStartString, env.VariableEndString = `\VAR{`, "}"
+	env.CommentStartString, env.CommentEndString = `\#{`, "}"
+	env.TrimBlocks = true
+	env.LStripBlocks = true
+	return env
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]struct {
+		configure func(env *EnvLexerInformation)
+		err       string
+	}{
+		"default": {func(env *EnvLexerInformation) {}, ""},
+		"latex": {func(env *EnvLexerInformation) {
+			*env = *latexEnv()
+			env.LineStatementPrefix = strPtr("%%")
+		}, ""},
+		"erb": {func(env *EnvLexerInformation) {
+			env.BlockStartString, env.BlockEndString = "<%", "%>"
+			env.VariableStartString, env.VariableEndString = "<%=", "%>"
+			env.CommentStartString, env.CommentEndString = "<%#", "%>"
+		}, ""},
+		"empty":        {func(env *EnvLexerInformation) { env.VariableEndString = "" }, "'VariableEndString' can't be empty"},
+		"empty prefix": {func(env *EnvLexerInformation) { env.LineCommentPrefix = strPtr("") }, "'LineCommentPrefix' can't be empty"},
+		"same starts":  {func(env *EnvLexerInformation) { env.CommentStartString = "{%" }, "'BlockStartString' and 'CommentStartString' must be different"},
+		"same prefixes": {func(env *EnvLexerInformation) {
+			env.LineStatementPrefix, env.LineCommentPrefix = strPtr("#"), strPtr("#")
+		}, "'LineStatementPrefix' and 'LineCommentPrefix' must be different"},
+		"prefix like a start": {func(env *EnvLexerInformation) { env.LineStatementPrefix = strPtr("{{") }, "'VariableStartString' and 'LineStatementPrefix' must be different"},
+		"ends starting with one another": {func(env *EnvLexerInformation) {
+			env.BlockEndString, env.VariableEndString = "}", "}}"
+		}, `'BlockEndString' "}" and 'VariableEndString' "}}" must be equal or not start with one another`},
+		"newline": {func(env *EnvLexerInformation) { env.NewlineSequence = "\n\r" }, "'NewlineSequence' must be one of"},
+	}
+	for name, c := range cases {
+		env := DefaultEnvLexerInformation()
+		c.configure(env)
+		err := env.Validate()
+		if (err == nil) != (c.err == "") || (err != nil && !strings.HasPrefix(err.Error(), c.err)) {
+			t.Fatalf("%s: expected error %q, got %v", name, c.err, err)
+		}
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	a, b := DefaultEnvLexerInformation(), DefaultEnvLexerInformation()
+	a.LineStatementPrefix, b.LineStatementPrefix = strPtr("#"), strPtr("#")
+	if GetLexer(a) != GetLexer(b) {
+		t.Fatal("expected the same lexer for equal prefixes")
+	}
+	b.LineStatementPrefix = strPtr("%")
+	if GetLexer(a) == GetLexer(b) {
+		t.Fatal("expected different lexers for different prefixes")
+	}
+
+	// the keys were the settings joined by a separator
+	a, b = DefaultEnvLexerInformation(), DefaultEnvLexerInformation()
+	a.BlockStartString, a.BlockEndString = "<^%&*$!*", "%>"
+	b.BlockStartString, b.BlockEndString = "<", "^%&*$!*%>"
+	if GetLexer(a) == GetLexer(b) {
+		t.Fatal("expected different lexers for different delimiters")
+	}
+	b = DefaultEnvLexerInformation()
+	a = DefaultEnvLexerInformation()
+	a.LineCommentPrefix = strPtr("")
+	if GetLexer(a) == GetLexer(b) {
+		t.Fatal("expected different lexers for an empty prefix and no prefix")
+	}
+}
+
+func tokenStrings(t *testing.T, env *EnvLexerInformation, source string) []string {
+	s, err := GetLexer(env).Tokenize(source, nil, nil, nil)
+	if err != nil {
+		t.Fatal(source, err)
+	}
+	var ret []string
+	for !s.Eos() {
+		token := s.Next()
+		ret = append(ret, fmt.Sprintf("%d:%s:%v", token.Lineno, token.Type, token.Value))
+	}
+	return ret
+}
+
+func TestLatexDelimiters(t *testing.T) {
+	source := `\documentclass{article}
+\#{ the items }
+  \BLOCK{ set sizes = {'small': 1} }
+\begin{itemize}
+  \BLOCK{ for item in items if item.size > sizes['small'] }
+  \item \VAR{ item.name|e }{}
+  \BLOCK{ endfor }
+\end{itemize}`
+	expected := []string{
+		`1:data:\documentclass{article}` + "\n",
+		"3:block_begin:\\BLOCK{", "3:name:set", "3:name:sizes", "3:assign:=", "3:lbrace:{", "3:string:small", "3:colon::",
+		"3:integer:1", "3:rbrace:}", "3:block_end:}\n", "4:data:\\begin{itemize}\n",
+		"5:block_begin:\\BLOCK{", "5:name:for", "5:name:item", "5:name:in", "5:name:items", "5:name:if", "5:name:item",
+		"5:dot:.", "5:name:size", "5:gt:>", "5:name:sizes", "5:lbracket:[", "5:string:small", "5:rbracket:]", "5:block_end:}\n",
+		"6:data:  \\item ", "6:variable_begin:\\VAR{", "6:name:item", "6:dot:.", "6:name:name", "6:pipe:|", "6:name:e",
+		"6:variable_end:}", "6:data:{}\n",
+		"7:block_begin:\\BLOCK{", "7:name:endfor", "7:block_end:}\n", "8:data:\\end{itemize}",
+	}
+	if got := tokenStrings(t, latexEnv(), source); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q\ngot      %q", expected, got)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	source := "{# gojinja: variable_start_string='<<' variable_end_string=\">>\"\n  comment_end_string=\"#}}\" line_statement_prefix=\"%\" trim_blocks=true #}\n" +
+		"<< x >>{{ y }}{% if z %}\n{# c #}}\n% endif"
+	expected := []string{
+		"3:variable_begin:<<", "3:name:x", "3:variable_end:>>", "3:data:{{ y }}",
+		"3:block_begin:{%", "3:name:if", "3:name:z", "3:block_end:%}\n",
+		"5:block_begin:%", "5:name:endif", "5:block_end:",
+	}
+	if got := tokenStrings(t, DefaultEnvLexerInformation(), source); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q\ngot      %q", expected, got)
+	}
+
+	tokens, err := GetLexer(DefaultEnvLexerInformation()).Lex("{#gojinja: trim_blocks=True#}\r\n{{ x }}", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := tokens[2]
+	if header.Type != TokenCommentEnd || header.Value != "#}\n" || header.Span.End != pos(31, 2, 0) {
+		t.Fatalf("unexpected end of the header %#v", header)
+	}
+
+	env, err := ReadHeader(DefaultEnvLexerInformation(), "{# gojinja: line_comment_prefix=none lstrip_blocks=false #}")
+	if err != nil || env.LineCommentPrefix != nil || env.LStripBlocks {
+		t.Fatal("unexpected header settings", env, err)
+	}
+	env = DefaultEnvLexerInformation()
+	if res, err := ReadHeader(env, "{# gojinja is great #}"); err != nil || res != env {
+		t.Fatal("comments without the prefix aren't headers", res, err)
+	}
+
+	errorCases := map[string]string{
+		"{# gojinja: newline_sequence='\\r' #}":               "unknown setting 'newline_sequence' in the header",
+		"{# gojinja: trim_blocks='yes' #}":                    "'trim_blocks' must be a boolean",
+		"{# gojinja: block_start_string=none #}":              "'block_start_string' must be a string",
+		"{# gojinja:\n block_start_string '<%' #}":            "expected '=' after 'block_start_string' in the header",
+		"{# gojinja: block_start_string='<% #}":               "unterminated string in the header",
+		"{# gojinja: trim_blocks=yes #}":                      "expected a string, a boolean or none in the header",
+		"{# gojinja: trim_blocks=true":                        "missing end of the header",
+		"{# gojinja: trim_blocks=true, lstrip_blocks=true #}": `unexpected char ',' in the header`,
+		"{# gojinja: variable_start_string='{%' #}":           "invalid header: 'BlockStartString' and 'VariableStartString' must be different",
+	}
+	for source, msg := range errorCases {
+		_, err := GetLexer(DefaultEnvLexerInformation()).Tokenize(source, nil, nil, nil)
+		sErr, ok := err.(*errors.SyntaxError)
+		if !ok || sErr.Message != msg {
+			t.Fatalf("%q: expected the error %q, got %v", source, msg, err)
+		}
+		if expected := 1 + strings.Count(source[:strings.Index(source, "block")+1], "\n"); strings.Contains(source, "\n") && sErr.Lineno != expected {
+			t.Fatalf("%q: expected the error on line %d, got %d", source, expected, sErr.Lineno)
 		}
 	}
 }
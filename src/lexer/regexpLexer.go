@@ -0,0 +1,364 @@
+package lexer
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/utils/identifier"
+	"github.com/gojinja/gojinja/src/utils/stack"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type rule struct {
+	pattern *regexp.Regexp
+	tokens  any
+	command *string
+}
+
+// OptionalLStrip is used for marking a point in the state that can have lstrip applied.
+type OptionalLStrip struct{ data []string }
+
+// regexpRules returns the rules of tokeniterRegexp, they are compiled on the
+// first call.
+func (l *Lexer) regexpRules() map[string][]rule {
+	l.rulesOnce.Do(func() {
+		l.rules = compileRegexpRules(&l.env)
+	})
+	return l.rules
+}
+
+func compileRegexpRules(env *EnvLexerInformation) map[string][]rule {
+	tagRules := []rule{
+		{whitespaceRe, TokenWhitespace, nil},
+		{floatRe, TokenFloat, nil},
+		{integerRe, TokenInteger, nil},
+		{identifier.NameRe, TokenName, nil},
+		{stringRe, TokenString, nil},
+		{operatorRe, TokenOperator, nil},
+	}
+
+	rootTagRules := compileRules(env)
+	blockStartRe := regexp.QuoteMeta(env.BlockStartString)
+	blockEndRe := regexp.QuoteMeta(env.BlockEndString)
+	commentEndRe := regexp.QuoteMeta(env.CommentEndString)
+	variableEndRe := regexp.QuoteMeta(env.VariableEndString)
+
+	blockSuffixRe := ""
+	if env.TrimBlocks {
+		blockSuffixRe = "\\n?"
+	}
+
+	rootRawRe := fmt.Sprintf(`(?P<raw_begin>%s(\-|\+|)\s*raw\s*(?:\-%s\s*|%s))`, blockStartRe, blockEndRe, blockEndRe)
+	rootPartsReArr := make([]string, 0, len(rootTagRules)+1)
+	rootPartsReArr = append(rootPartsReArr, rootRawRe)
+	for _, r := range rootTagRules {
+		rootPartsReArr = append(rootPartsReArr, fmt.Sprintf(`(?P<%s>%s(\-|\+|))`, r.name, r.pattern))
+	}
+	rootPartsRe := strings.Join(rootPartsReArr, "|")
+	popCmd := "#pop"
+	byGrpCmd := "#bygroup"
+
+	return map[string][]rule{
+		"root": {
+			{
+				c(fmt.Sprintf(`^(.*?)(?:%s)`, rootPartsRe)),
+				OptionalLStrip{data: []string{TokenData, byGrpCmd}},
+				&byGrpCmd,
+			}, // directives
+			{c("^.+"), TokenData, nil}, // data
+		},
+		TokenCommentBegin: {
+			{
+				c(fmt.Sprintf(`^(.*?)((?:\+%s|\-%s\s*|%s%s))`, commentEndRe, commentEndRe, commentEndRe, blockSuffixRe)),
+				[]string{TokenComment, TokenCommentEnd},
+				&popCmd,
+			},
+			{c(`^(.)`), Failure{"Missing end of comment tag"}, nil},
+		},
+		TokenBlockBegin: append([]rule{
+			{
+				c(fmt.Sprintf(`^(?:\+%s|\-%s\s*|%s%s)`, blockEndRe, blockEndRe, blockEndRe, blockSuffixRe)),
+				TokenBlockEnd,
+				&popCmd,
+			},
+		}, tagRules...),
+		TokenVariableBegin: append([]rule{
+			{
+				c(fmt.Sprintf(`^\-%s\s*|^%s`, variableEndRe, variableEndRe)),
+				TokenVariableEnd,
+				&popCmd,
+			},
+		}, tagRules...),
+		TokenRawBegin: {
+			{
+				c(fmt.Sprintf(`^(.*?)((?:%s(\-|\+|))\s*endraw\s*(?:\+%s|\-%s\s*|%s%s))`, blockStartRe, blockEndRe, blockEndRe, blockEndRe, blockSuffixRe)),
+				OptionalLStrip{data: []string{TokenData, TokenRawEnd}},
+				&popCmd,
+			},
+			{c(`^(.)`), Failure{"Missing end of raw directive"}, nil},
+		},
+		TokenLinestatementBegin: append([]rule{
+			{c(`^\s*(\n|$)`), TokenLinestatementEnd, &popCmd},
+		}, tagRules...),
+		TokenLinecommentBegin: {
+			{
+				c(`^(.*?)()(?:\n|$)`),
+				[]string{TokenLinecomment, TokenLinecommentEnd},
+				&popCmd,
+			},
+		},
+	}
+}
+
+// tokeniterRegexp is Tokeniter implemented with the regular expressions of
+// Jinja, the way the lexer used to work. It's kept as the reference the
+// scanner is tested against.
+func (l *Lexer) tokeniterRegexp(source string, name *string, filename *string, state *string) (ret []tokenRaw, err error) {
+	source, srcMap := l.normalize(source)
+	rules := l.regexpRules()
+	pos := 0
+	lineno := 1
+	st := stack.New[string]()
+	st.Push("root")
+
+	if state != nil && *state != "root" {
+		if *state != "variable" && *state != "block" {
+			return nil, fmt.Errorf("invalid state")
+		}
+		st.Push(*state + "_begin")
+	}
+	stateTokens := rules[*st.Peek()]
+	sourceLength := len(source)
+	balancingStack := stack.New[string]()
+	newlinesStripped := 0
+	lineStarting := true
+
+	broke := true
+	for broke {
+		broke = false
+		// tokenizer loop
+		for _, sToks := range stateTokens {
+			// if no match we try again with the next rule
+			// the patterns are multiline, `^` would match at every line:
+			// only the matches starting at the current position count
+			loc := sToks.pattern.FindStringSubmatchIndex(source[pos:])
+			if loc == nil || loc[0] != 0 {
+				continue
+			}
+			groups := submatches(source[pos:], loc)
+			grp := groups[0]
+			groups = groups[1:] // Remove first element as it's not in python counterpart.
+			// groupSpan returns the span of the data of the i-th group (as
+			// indexed in groups), which may have been stripped on the right.
+			groupSpan := func(i int, data string) Span {
+				start := loc[2*(i+1)]
+				if start < 0 {
+					start = loc[1]
+				}
+				return srcMap.span(pos+start, pos+start+len(data))
+			}
+
+			// we only match blocks and variables if braces / parentheses
+			// are balanced. continue parsing with the lower rule which
+			// is the operator rule. do this only if the end tags look
+			// like operators
+			if balancingStack.Peek() != nil &&
+				(sToks.tokens == TokenVariableEnd ||
+					sToks.tokens == TokenBlockEnd ||
+					sToks.tokens == TokenLinestatementEnd) {
+				continue
+			}
+
+			// tuples support more options
+			if _, ok := sToks.tokens.(OptionalLStrip); ok {
+				// Rule supports lstrip. Match will look like
+				// text, block type, whitespace control, type, control, ...
+				text := groups[0]
+				// Skipping the text and first type, every other group is the
+				// whitespace control for each type. One of the groups will be
+				// -, +, or empty string instead of None.
+				stripSign := ""
+				for i := 2; i < len(groups); i += 2 {
+					if groups[i] != "" {
+						stripSign = groups[i]
+						break
+					}
+				}
+				if stripSign == "-" {
+					// Strip all whitespace between the text and the tag.
+					stripped := strings.TrimRightFunc(text, unicode.IsSpace)
+					newlinesStripped = strings.Count(text[len(stripped):], "\n")
+					groups = append([]string{stripped}, groups[1:]...)
+				} else if stripSign != "+" && l.lStripBlocks {
+					names := sToks.pattern.SubexpNames()[1:]
+					variableExpression := false
+					for i := 0; i < len(names); i++ {
+						if names[i] == TokenVariableBegin && groups[i] != "" {
+							variableExpression = true
+						}
+					}
+					if !variableExpression {
+						// The start of text between the last newline and the tag.
+						lPos := strings.LastIndex(text, "\n") + 1
+						if lPos > 0 || lineStarting {
+							// If there's only whitespace between the newline and the
+							// tag, strip it.
+							if fullmatch(whitespaceRe, text[lPos:]) {
+								groups = append([]string{text[:lPos]}, groups[1:]...)
+							}
+						}
+					}
+				}
+			}
+			if toks, ok := toToks(sToks.tokens); ok {
+				for idx, token := range toks {
+					if token == "#bygroup" {
+						// bygroup is a bit more complex, in that case we
+						// yield for the current token the first named
+						// group that matched
+						names := sToks.pattern.SubexpNames()[1:]
+						found := false
+						for i := 0; i < len(names); i++ {
+							if names[i] != "" && groups[i] != "" {
+								ret = append(ret, tokenRaw{lineno, names[i], groups[i], groupSpan(i, groups[i])})
+								lineno += strings.Count(groups[i], "\n")
+								found = true
+								break
+							}
+						}
+						if !found {
+							return nil, fmt.Errorf("'%s' wanted to resolve the token dynamically but no group matched", sToks.pattern)
+						}
+					} else {
+						// normal group
+						data := groups[idx]
+						if data != "" || !ignoreIfEmpty.Has(token) {
+							ret = append(ret, tokenRaw{lineno, token, data, groupSpan(idx, data)})
+						}
+						lineno += strings.Count(data, "\n") + newlinesStripped
+						newlinesStripped = 0
+					}
+				}
+			} else if failure, ok := sToks.tokens.(Failure); ok {
+				return nil, failure.Error(lineno, filename)
+			} else if toks, ok := sToks.tokens.(string); ok {
+				// strings as token just are yielded as it.
+				data := grp
+				// update brace / parentheses balance
+				if toks == TokenOperator {
+					col := srcMap.position(pos+loc[0]).Col + 1
+					switch data {
+					case "{":
+						balancingStack.Push("}")
+					case "(":
+						balancingStack.Push(")")
+					case "[":
+						balancingStack.Push("]")
+					case "}", ")", "]":
+						exOp := balancingStack.Pop()
+						if exOp == nil {
+							return nil, errors.TemplateSyntaxErrorAt(fmt.Sprintf("unexpected '%s'", data), lineno, col, name, filename)
+						}
+						if *exOp != data {
+							return nil, errors.TemplateSyntaxErrorAt(fmt.Sprintf("unexpected '%s', expected '%s'", data, *exOp), lineno, col, name, filename)
+						}
+					}
+				}
+
+				// yield items
+				if data != "" || !ignoreIfEmpty.Has(toks) {
+					ret = append(ret, tokenRaw{lineno, toks, data, srcMap.span(pos+loc[0], pos+loc[1])})
+				}
+				lineno += strings.Count(data, "\n")
+			} else {
+				return nil, fmt.Errorf("unexpected type")
+			}
+
+			lineStarting = strings.HasSuffix(grp, "\n")
+			// fetch new position into new variable so that we can check
+			// if there is a internal parsing error which would result
+			// in an infinite loop
+			pos2 := pos + loc[1]
+			// handle state changes
+			if sToks.command != nil {
+				// remove the uppermost state
+				if *sToks.command == "#pop" {
+					st.Pop()
+				} else if *sToks.command == "#bygroup" {
+					// resolve the new state by group checking
+					names := sToks.pattern.SubexpNames()[1:]
+					found := false
+					for i := 0; i < len(names); i++ {
+						if names[i] != "" && groups[i] != "" {
+							st.Push(names[i])
+							found = true
+							break
+						}
+					}
+					if !found {
+						return nil, fmt.Errorf("'%s' wanted to resolve the new state dynamically but no group matched", sToks.pattern)
+					}
+				} else {
+					st.Push(*sToks.command)
+				}
+
+				stateTokens = rules[*st.Peek()]
+			} else if pos2 == pos {
+				// we are still at the same position and no stack change.
+				// this means a loop without break condition, avoid that and
+				// raise error
+				return nil, fmt.Errorf("'%s' yielded empty string without stack change", sToks.pattern)
+			}
+			// publish new function and start again
+			pos = pos2
+			broke = true
+			break
+		}
+	}
+
+	// if loop terminated without break we haven't found a single match
+	// either we are at the end of the file or we have a problem
+	if pos >= sourceLength {
+		return
+	}
+	at := srcMap.position(pos)
+	return nil, errors.TemplateSyntaxErrorAt(fmt.Sprintf("unexpected char '%s' at %d", string(source[pos]), at.Offset), lineno, at.Col+1, name, filename)
+}
+
+func toToks(tokens any) ([]string, bool) {
+	switch v := tokens.(type) {
+	case []string:
+		return v, true
+	case OptionalLStrip:
+		return v.data, true
+	default:
+		return nil, false
+	}
+}
+
+// submatches returns the text of the groups located by loc, like
+// FindStringSubmatch would.
+func submatches(s string, loc []int) []string {
+	groups := make([]string, len(loc)/2)
+	for i := range groups {
+		if loc[2*i] >= 0 {
+			groups[i] = s[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return groups
+}
+
+func fullmatch(re *regexp.Regexp, text string) bool {
+	l := len(text)
+	for _, m := range re.FindAllString(text, -1) {
+		if len(m) == l {
+			return true
+		}
+	}
+	return false
+}
+
+func c(x string) *regexp.Regexp {
+	return regexp.MustCompile("(?ms)" + x)
+}
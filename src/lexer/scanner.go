@@ -0,0 +1,737 @@
+package lexer
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/utils/identifier"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// rootRule is a tag starting in the template data: the start of a block, a
+// variable or a comment, or the prefix of a line statement or comment.
+type rootRule struct {
+	token string
+	start string
+}
+
+// compileRootRules returns the root rules in the order they are tried at the
+// same position: the longest first, like the alternatives of Jinja's regex.
+func compileRootRules(env *EnvLexerInformation) []rootRule {
+	rules := []rootRule{
+		{TokenCommentBegin, env.CommentStartString},
+		{TokenBlockBegin, env.BlockStartString},
+		{TokenVariableBegin, env.VariableStartString},
+	}
+	if env.LineStatementPrefix != nil {
+		rules = append(rules, rootRule{TokenLinestatementBegin, *env.LineStatementPrefix})
+	}
+	if env.LineCommentPrefix != nil {
+		rules = append(rules, rootRule{TokenLinecommentBegin, *env.LineCommentPrefix})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].start) == len(rules[j].start) {
+			return rules[i].token > rules[j].token
+		}
+		return len(rules[i].start) > len(rules[j].start)
+	})
+	return rules
+}
+
+// notFound is the position of the root rules that don't occur anymore.
+const notFound = math.MaxInt
+
+// scanner is a state machine tokenizing the normalized source of a template,
+// it produces the tokens the regular expressions of Jinja would (see
+// tokeniterRegexp) without backtracking over the source.
+type scanner struct {
+	l              *Lexer
+	source         string
+	srcMap         sourceMap
+	name, filename *string
+
+	pos    int
+	lineno int
+	states []string
+	// balancing are the closing brackets expected in the current tag, the
+	// end of the tag isn't matched until they are closed.
+	balancing        []byte
+	newlinesStripped int
+	lineStarting     bool
+	// next caches the next position of every root rule, the positions
+	// don't change as long as they are after the current position.
+	next   []int
+	tokens []tokenRaw
+}
+
+func newScanner(l *Lexer, source string, srcMap sourceMap, name *string, filename *string) *scanner {
+	next := make([]int, len(l.rootRules))
+	for i := range next {
+		next[i] = -1
+	}
+	return &scanner{
+		l:            l,
+		source:       source,
+		srcMap:       srcMap,
+		name:         name,
+		filename:     filename,
+		lineno:       1,
+		states:       []string{"root"},
+		lineStarting: true,
+		next:         next,
+		tokens:       make([]tokenRaw, 0, len(source)/4),
+	}
+}
+
+func (s *scanner) run(state *string) ([]tokenRaw, error) {
+	if state != nil && *state != "root" {
+		if *state != "variable" && *state != "block" {
+			return nil, fmt.Errorf("invalid state")
+		}
+		s.states = append(s.states, *state+"_begin")
+	}
+
+	for {
+		state := s.states[len(s.states)-1]
+		if s.pos == len(s.source) && !s.matchesAtEnd(state) {
+			return s.tokens, nil
+		}
+		var err error
+		switch state {
+		case "root":
+			s.scanRoot()
+		case TokenCommentBegin:
+			err = s.scanComment()
+		case TokenRawBegin:
+			err = s.scanRaw()
+		case TokenLinecommentBegin:
+			s.scanLinecomment()
+		case TokenBlockBegin:
+			err = s.scanTag(s.matchBlockEnd, TokenBlockEnd)
+		case TokenVariableBegin:
+			err = s.scanTag(s.matchVariableEnd, TokenVariableEnd)
+		case TokenLinestatementBegin:
+			err = s.scanTag(s.matchLinestatementEnd, TokenLinestatementEnd)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// matchesAtEnd tells if the end of the template ends the state, like the end
+// of a line would.
+func (s *scanner) matchesAtEnd(state string) bool {
+	return state == TokenLinecommentBegin || (state == TokenLinestatementBegin && len(s.balancing) == 0)
+}
+
+func (s *scanner) emit(token string, value string, start int, end int) {
+	if value != "" || !ignoreIfEmpty.Has(token) {
+		s.tokens = append(s.tokens, tokenRaw{s.lineno, token, value, s.srcMap.span(start, end)})
+	}
+}
+
+func (s *scanner) push(state string) {
+	s.states = append(s.states, state)
+}
+
+func (s *scanner) pop() {
+	s.states = s.states[:len(s.states)-1]
+}
+
+// advance moves to end, after the match of a rule.
+func (s *scanner) advance(end int) {
+	s.lineStarting = end > s.pos && s.source[end-1] == '\n'
+	s.pos = end
+}
+
+// isSpace tells if c matches `\s` in Go regular expressions.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// skipSpace returns the position after the whitespace at pos.
+func (s *scanner) skipSpace(pos int) int {
+	for pos < len(s.source) && isSpace(s.source[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// hasSignedPrefix tells if the source at pos is sign followed by prefix.
+func (s *scanner) hasSignedPrefix(pos int, sign byte, prefix string) bool {
+	return pos < len(s.source) && s.source[pos] == sign && strings.HasPrefix(s.source[pos+1:], prefix)
+}
+
+// skipSign returns the whitespace control sign at pos, `-`, `+` or nothing.
+func (s *scanner) skipSign(pos int) string {
+	if pos < len(s.source) && (s.source[pos] == '-' || s.source[pos] == '+') {
+		return s.source[pos : pos+1]
+	}
+	return ""
+}
+
+// emitText emits the data before a tag, stripped according to the sign of
+// the tag and the lstrip_blocks setting.
+func (s *scanner) emitText(text string, sign string, variable bool) {
+	if sign == "-" {
+		// Strip all whitespace between the text and the tag.
+		stripped := strings.TrimRightFunc(text, unicode.IsSpace)
+		s.newlinesStripped = strings.Count(text[len(stripped):], "\n")
+		text = stripped
+	} else if sign != "+" && s.l.lStripBlocks && !variable {
+		// The start of text between the last newline and the tag.
+		lPos := strings.LastIndexByte(text, '\n') + 1
+		if (lPos > 0 || s.lineStarting) && isBlank(text[lPos:]) {
+			text = text[:lPos]
+		}
+	}
+	s.emit(TokenData, text, s.pos, s.pos+len(text))
+	s.lineno += strings.Count(text, "\n") + s.newlinesStripped
+	s.newlinesStripped = 0
+}
+
+// isBlank tells if text is made of whitespace only, and not empty.
+func isBlank(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if !isSpace(text[i]) {
+			return false
+		}
+	}
+	return text != ""
+}
+
+func (s *scanner) scanRoot() {
+	start, rule := s.findRootRule()
+	if rule < 0 {
+		// no more tags, the rest is data
+		s.emit(TokenData, s.source[s.pos:], s.pos, len(s.source))
+		s.lineno += strings.Count(s.source[s.pos:], "\n")
+		s.advance(len(s.source))
+		return
+	}
+
+	token := s.l.rootRules[rule].token
+	var end int
+	var sign string
+	if rawEnd, rawSign, ok := s.matchRawBegin(start); ok {
+		token, end, sign = TokenRawBegin, rawEnd, rawSign
+	} else {
+		end = start
+		switch token {
+		case TokenLinestatementBegin:
+			end = s.skipLinestatementIndent(start)
+		case TokenLinecommentBegin:
+			for isIndent(s.source[end]) {
+				end++
+			}
+		}
+		end += len(s.l.rootRules[rule].start)
+		sign = s.skipSign(end)
+		end += len(sign)
+	}
+
+	s.emitText(s.source[s.pos:start], sign, token == TokenVariableBegin)
+	tag := s.source[start:end]
+	s.emit(token, tag, start, end)
+	s.lineno += strings.Count(tag, "\n")
+	s.advance(end)
+	s.push(token)
+}
+
+// findRootRule returns the position of the first tag after the current
+// position and the index of its root rule, or -1 if there's none. Tags
+// starting at the same position are tried in the order of the rules.
+func (s *scanner) findRootRule() (int, int) {
+	best, bestRule := notFound, -1
+	for i, rule := range s.l.rootRules {
+		if s.next[i] < s.pos {
+			s.next[i] = s.findRule(rule)
+		}
+		if s.next[i] < best {
+			best, bestRule = s.next[i], i
+		}
+	}
+	return best, bestRule
+}
+
+// findRule returns the first position of rule after the current position,
+// or notFound.
+func (s *scanner) findRule(rule rootRule) int {
+	if rule.start == "" {
+		return notFound
+	}
+	switch rule.token {
+	case TokenLinestatementBegin:
+		return s.findLinestatement(rule.start)
+	case TokenLinecommentBegin:
+		return s.findLinecomment(rule.start)
+	}
+	if idx := strings.Index(s.source[s.pos:], rule.start); idx >= 0 {
+		return s.pos + idx
+	}
+	return notFound
+}
+
+// findLinestatement returns the start of the first line beginning with the
+// prefix, after spaces and tabs.
+func (s *scanner) findLinestatement(prefix string) int {
+	lineStart := s.pos
+	if lineStart > 0 && s.source[lineStart-1] != '\n' {
+		lineStart = s.nextLine(lineStart)
+	}
+	for lineStart < len(s.source) {
+		if strings.HasPrefix(s.source[s.skipLinestatementIndent(lineStart):], prefix) {
+			return lineStart
+		}
+		lineStart = s.nextLine(lineStart)
+	}
+	return notFound
+}
+
+func (s *scanner) nextLine(pos int) int {
+	if idx := strings.IndexByte(s.source[pos:], '\n'); idx >= 0 {
+		return pos + idx + 1
+	}
+	return len(s.source)
+}
+
+// findLinecomment returns the start of the first line comment: the prefix
+// and the spaces before it, which must follow the start of a line or a
+// non-space character.
+func (s *scanner) findLinecomment(prefix string) int {
+	from := s.pos
+	for {
+		idx := strings.Index(s.source[from:], prefix)
+		if idx < 0 {
+			return notFound
+		}
+		start := s.skipIndentBack(from + idx)
+		if start == 0 || !isIndent(s.source[start-1]) {
+			return start
+		}
+		from += idx + 1
+	}
+}
+
+// isIndent tells if c matches `[^\S\r\n]`, the whitespace before a line
+// comment.
+func isIndent(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\f'
+}
+
+// skipIndentBack returns the start of the indentation before pos, without
+// going before the current position.
+func (s *scanner) skipIndentBack(pos int) int {
+	for pos > s.pos && isIndent(s.source[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// skipLinestatementIndent returns the position after the spaces and tabs at
+// pos, the indentation allowed before line statements.
+func (s *scanner) skipLinestatementIndent(pos int) int {
+	for pos < len(s.source) && (s.source[pos] == ' ' || s.source[pos] == '\t' || s.source[pos] == '\v') {
+		pos++
+	}
+	return pos
+}
+
+// matchRawBegin matches `{% raw %}` at pos, it returns the end of the tag
+// and its whitespace control sign.
+func (s *scanner) matchRawBegin(pos int) (int, string, bool) {
+	blockStart, blockEnd := s.l.env.BlockStartString, s.l.env.BlockEndString
+	if !strings.HasPrefix(s.source[pos:], blockStart) {
+		return 0, "", false
+	}
+	pos += len(blockStart)
+	sign := s.skipSign(pos)
+	pos = s.skipSpace(pos + len(sign))
+	if !strings.HasPrefix(s.source[pos:], "raw") {
+		return 0, "", false
+	}
+	pos = s.skipSpace(pos + len("raw"))
+	switch {
+	case s.hasSignedPrefix(pos, '-', blockEnd):
+		return s.skipSpace(pos + 1 + len(blockEnd)), sign, true
+	case strings.HasPrefix(s.source[pos:], blockEnd):
+		return pos + len(blockEnd), sign, true
+	}
+	return 0, "", false
+}
+
+// matchTagEnd matches the end of a block or a comment at pos: `+end`,
+// `-end` followed by whitespace, or `end` followed by a newline if
+// trim_blocks is set. It returns the end of the match.
+func (s *scanner) matchTagEnd(pos int, end string) (int, bool) {
+	switch {
+	case s.hasSignedPrefix(pos, '+', end):
+		return pos + 1 + len(end), true
+	case s.hasSignedPrefix(pos, '-', end):
+		return s.skipSpace(pos + 1 + len(end)), true
+	case strings.HasPrefix(s.source[pos:], end):
+		pos += len(end)
+		if s.l.env.TrimBlocks && pos < len(s.source) && s.source[pos] == '\n' {
+			pos++
+		}
+		return pos, true
+	}
+	return 0, false
+}
+
+// findTagEnd returns the first match of matchTagEnd after the current
+// position, a sign before the end is part of the match.
+func (s *scanner) findTagEnd(end string) (int, int, bool) {
+	from := s.pos
+	for {
+		idx := strings.Index(s.source[from:], end)
+		if idx < 0 {
+			return 0, 0, false
+		}
+		start := from + idx
+		if start > s.pos && (s.source[start-1] == '+' || s.source[start-1] == '-') {
+			start--
+		}
+		if matchEnd, ok := s.matchTagEnd(start, end); ok {
+			return start, matchEnd, true
+		}
+		from += idx + 1
+	}
+}
+
+func (s *scanner) scanComment() error {
+	start, end, ok := s.findTagEnd(s.l.env.CommentEndString)
+	if !ok {
+		return Failure{"Missing end of comment tag"}.Error(s.lineno, s.filename)
+	}
+	comment := s.source[s.pos:start]
+	s.emit(TokenComment, comment, s.pos, start)
+	s.lineno += strings.Count(comment, "\n")
+	s.emit(TokenCommentEnd, s.source[start:end], start, end)
+	s.lineno += strings.Count(s.source[start:end], "\n")
+	s.advance(end)
+	s.pop()
+	return nil
+}
+
+// scanHeader emits the header directive as a comment, see ReadHeader.
+func (s *scanner) scanHeader(h *header) {
+	s.emit(TokenCommentBegin, s.source[:h.contentStart], 0, h.contentStart)
+	comment := s.source[h.contentStart:h.contentEnd]
+	s.emit(TokenComment, comment, h.contentStart, h.contentEnd)
+	s.lineno += strings.Count(comment, "\n")
+	s.emit(TokenCommentEnd, s.source[h.contentEnd:h.end], h.contentEnd, h.end)
+	s.lineno += strings.Count(s.source[h.contentEnd:h.end], "\n")
+	s.advance(h.end)
+}
+
+func (s *scanner) scanRaw() error {
+	blockStart := s.l.env.BlockStartString
+	from := s.pos
+	for {
+		idx := strings.Index(s.source[from:], blockStart)
+		if idx < 0 {
+			return Failure{"Missing end of raw directive"}.Error(s.lineno, s.filename)
+		}
+		start := from + idx
+		pos := start + len(blockStart)
+		sign := s.skipSign(pos)
+		pos = s.skipSpace(pos + len(sign))
+		if strings.HasPrefix(s.source[pos:], "endraw") {
+			if end, ok := s.matchTagEnd(s.skipSpace(pos+len("endraw")), s.l.env.BlockEndString); ok {
+				s.emitText(s.source[s.pos:start], sign, false)
+				s.emit(TokenRawEnd, s.source[start:end], start, end)
+				s.lineno += strings.Count(s.source[start:end], "\n")
+				s.advance(end)
+				s.pop()
+				return nil
+			}
+		}
+		from = start + 1
+	}
+}
+
+// scanLinecomment scans the rest of the line, the newline isn't part of the
+// comment.
+func (s *scanner) scanLinecomment() {
+	end := s.pos + strings.IndexByte(s.source[s.pos:], '\n')
+	if end < s.pos {
+		end = len(s.source)
+	}
+	s.emit(TokenLinecomment, s.source[s.pos:end], s.pos, end)
+	s.emit(TokenLinecommentEnd, "", end, end)
+	s.advance(end)
+	s.pop()
+}
+
+func (s *scanner) matchBlockEnd() (int, bool) {
+	return s.matchTagEnd(s.pos, s.l.env.BlockEndString)
+}
+
+func (s *scanner) matchVariableEnd() (int, bool) {
+	end := s.l.env.VariableEndString
+	switch {
+	case s.hasSignedPrefix(s.pos, '-', end):
+		return s.skipSpace(s.pos + 1 + len(end)), true
+	case strings.HasPrefix(s.source[s.pos:], end):
+		return s.pos + len(end), true
+	}
+	return 0, false
+}
+
+// matchLinestatementEnd matches the whitespace up to the last newline of
+// the whitespace, or up to the end of the template.
+func (s *scanner) matchLinestatementEnd() (int, bool) {
+	end := s.skipSpace(s.pos)
+	if end == len(s.source) {
+		return end, true
+	}
+	if idx := strings.LastIndexByte(s.source[s.pos:end], '\n'); idx >= 0 {
+		return s.pos + idx + 1, true
+	}
+	return 0, false
+}
+
+// scanTag scans a token of a block, a variable or a line statement. The end
+// of the tag is matched only if the brackets are balanced.
+func (s *scanner) scanTag(matchEnd func() (int, bool), endToken string) error {
+	if len(s.balancing) == 0 {
+		if end, ok := matchEnd(); ok {
+			s.emit(endToken, s.source[s.pos:end], s.pos, end)
+			s.lineno += strings.Count(s.source[s.pos:end], "\n")
+			s.advance(end)
+			s.pop()
+			return nil
+		}
+	}
+
+	token, end := s.matchToken()
+	if end == s.pos {
+		at := s.srcMap.position(s.pos)
+		return errors.TemplateSyntaxErrorAt(fmt.Sprintf("unexpected char '%s' at %d", string(rune(s.source[s.pos])), at.Offset), s.lineno, at.Col+1, s.name, s.filename)
+	}
+	value := s.source[s.pos:end]
+	if token == TokenOperator {
+		if err := s.balance(value); err != nil {
+			return err
+		}
+	}
+	s.emit(token, value, s.pos, end)
+	s.lineno += strings.Count(value, "\n")
+	s.advance(end)
+	return nil
+}
+
+// balance updates the brackets to close with an operator.
+func (s *scanner) balance(op string) error {
+	var expected byte
+	switch op {
+	case "{":
+		s.balancing = append(s.balancing, '}')
+		return nil
+	case "(":
+		s.balancing = append(s.balancing, ')')
+		return nil
+	case "[":
+		s.balancing = append(s.balancing, ']')
+		return nil
+	case "}", ")", "]":
+	default:
+		return nil
+	}
+	col := s.srcMap.position(s.pos).Col + 1
+	if len(s.balancing) == 0 {
+		return errors.TemplateSyntaxErrorAt(fmt.Sprintf("unexpected '%s'", op), s.lineno, col, s.name, s.filename)
+	}
+	expected, s.balancing = s.balancing[len(s.balancing)-1], s.balancing[:len(s.balancing)-1]
+	if op[0] != expected {
+		return errors.TemplateSyntaxErrorAt(fmt.Sprintf("unexpected '%s', expected '%c'", op, expected), s.lineno, col, s.name, s.filename)
+	}
+	return nil
+}
+
+// matchToken matches a token inside of a tag at the current position, it
+// returns the end of the token, which is the current position if nothing
+// matched.
+func (s *scanner) matchToken() (string, int) {
+	pos := s.pos
+	if end := s.skipSpace(pos); end > pos {
+		return TokenWhitespace, end
+	}
+	if end := s.matchFloat(pos); end > pos {
+		return TokenFloat, end
+	}
+	if end := s.matchInteger(pos); end > pos {
+		return TokenInteger, end
+	}
+	if end := s.matchName(pos); end > pos {
+		return TokenName, end
+	}
+	if end := s.matchString(pos); end > pos {
+		return TokenString, end
+	}
+	if end := s.matchOperator(pos); end > pos {
+		return TokenOperator, end
+	}
+	return "", pos
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// matchDigits matches digits separated by single underscores, `(\d+_)*\d+`.
+func (s *scanner) matchDigits(pos int, isDigit func(byte) bool) int {
+	if pos >= len(s.source) || !isDigit(s.source[pos]) {
+		return pos
+	}
+	for {
+		for pos < len(s.source) && isDigit(s.source[pos]) {
+			pos++
+		}
+		if pos+1 < len(s.source) && s.source[pos] == '_' && isDigit(s.source[pos+1]) {
+			pos++
+			continue
+		}
+		return pos
+	}
+}
+
+// matchFloat matches a float with a fractional part, an exponent or both.
+func (s *scanner) matchFloat(pos int) int {
+	mantissa := s.matchDigits(pos, isDigit)
+	if mantissa == pos {
+		return pos
+	}
+	end := mantissa
+	fraction := mantissa
+	if end < len(s.source) && s.source[end] == '.' {
+		if e := s.matchDigits(end+1, isDigit); e > end+1 {
+			fraction = e
+		}
+	}
+	if exponent := s.matchExponent(fraction); exponent > fraction {
+		return exponent
+	}
+	if fraction == mantissa {
+		// an integer
+		return pos
+	}
+	return fraction
+}
+
+func (s *scanner) matchExponent(pos int) int {
+	if pos >= len(s.source) || (s.source[pos] != 'e' && s.source[pos] != 'E') {
+		return pos
+	}
+	digits := pos + 1
+	if digits < len(s.source) && (s.source[digits] == '+' || s.source[digits] == '-') {
+		digits++
+	}
+	if end := s.matchDigits(digits, isDigit); end > digits {
+		return end
+	}
+	return pos
+}
+
+// matchInteger matches a binary, octal, hexadecimal or decimal integer.
+func (s *scanner) matchInteger(pos int) int {
+	if pos >= len(s.source) || !isDigit(s.source[pos]) {
+		return pos
+	}
+	if s.source[pos] != '0' {
+		return s.matchUnderscored(pos+1, isDigit)
+	}
+	if pos+1 < len(s.source) {
+		var digits func(byte) bool
+		switch s.source[pos+1] {
+		case 'b', 'B':
+			digits = func(c byte) bool { return c == '0' || c == '1' }
+		case 'o', 'O':
+			digits = func(c byte) bool { return c >= '0' && c <= '7' }
+		case 'x', 'X':
+			digits = func(c byte) bool {
+				return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+			}
+		}
+		if digits != nil {
+			if end := s.matchUnderscored(pos+2, digits); end > pos+2 {
+				return end
+			}
+		}
+	}
+	return s.matchUnderscored(pos+1, func(c byte) bool { return c == '0' })
+}
+
+// matchUnderscored matches digits each optionally preceded by an
+// underscore, `(_?\d)*`.
+func (s *scanner) matchUnderscored(pos int, isDigit func(byte) bool) int {
+	for {
+		if pos < len(s.source) && isDigit(s.source[pos]) {
+			pos++
+		} else if pos+1 < len(s.source) && s.source[pos] == '_' && isDigit(s.source[pos+1]) {
+			pos += 2
+		} else {
+			return pos
+		}
+	}
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// matchName matches the characters of identifier.NameRe, the names are
+// validated when the tokens are wrapped.
+func (s *scanner) matchName(pos int) int {
+	for pos < len(s.source) {
+		if c := s.source[pos]; c < 0x80 {
+			if !isWordChar(c) {
+				return pos
+			}
+			pos++
+			continue
+		}
+		loc := identifier.NameRe.FindStringIndex(s.source[pos:])
+		if loc == nil {
+			return pos
+		}
+		pos += loc[1]
+	}
+	return pos
+}
+
+// matchString matches a single or double quoted string with backslash
+// escapes.
+func (s *scanner) matchString(pos int) int {
+	if pos >= len(s.source) || (s.source[pos] != '\'' && s.source[pos] != '"') {
+		return pos
+	}
+	quote := s.source[pos]
+	for i := pos + 1; i < len(s.source); i++ {
+		switch s.source[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return pos
+}
+
+func (s *scanner) matchOperator(pos int) int {
+	if pos+1 < len(s.source) {
+		if _, ok := operators[s.source[pos:pos+2]]; ok {
+			return pos + 2
+		}
+	}
+	if pos < len(s.source) {
+		if _, ok := operators[s.source[pos:pos+1]]; ok {
+			return pos + 1
+		}
+	}
+	return pos
+}
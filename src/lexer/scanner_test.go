@@ -0,0 +1,220 @@
+package lexer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// corpus is tokenized by both the scanner and the regexp lexer in every
+// configuration of corpusEnvs.
+var corpus = []string{
+	``,
+	`plain text`,
+	"a\r\nb\rc\n",
+	`{{ name }}`,
+	`{{name}}{{-name-}}  x  {{- name }}`,
+	"{% if name != \"OFF\" %}\nmy name is {{ name }}\n{% endif %}\n{{ 5 + 1 }}",
+	"  {% for x in xs -%}\n  {{ x }}\n  {%- endfor %}\n  done",
+	"<ul>\n    {% for item in seq %}\n        <li>{{ item }}</li>\n    {% endfor %}\n</ul>\n",
+	"\t{%+ if x %}\n\t{% endif +%}\n",
+	"  {# comment #}\n  {#- stripped -#}   \n{#+ kept +#}\n",
+	"{# multi\nline\ncomment #}\nafter",
+	"{% raw %}{{ not }}{% a tag %}{% endraw %}",
+	"  {%- raw -%}  \n {{ x }}\n  {%- endraw -%}  \n",
+	"{%raw%}a{%endraw%}{% raw\n%}b{%\nendraw\n%}\n{%+ raw %}c{%+ endraw +%}",
+	"{% raw %}{% endrawx %}{% endraw %}",
+	"    {% raw %}\n    x\n    {% endraw %}\n",
+	"{{ 1 }}{{ 0 }}{{ 00_0 }}{{ 1_000 }}{{ 1__0 }}{{ 12_ }}{{ 0b1_01 }}{{ 0B2 }}{{ 0o17 }}{{ 0x_fF }}{{ 0xg }}",
+	"{{ 1.5 }}{{ 1e3 }}{{ 1E+3 }}{{ 1.5e-3 }}{{ 1_0.0_1e1_0 }}{{ 1. }}{{ 1.e3 }}{{ 1e }}{{ .5 }}{{ x.1.2 }}",
+	`{{ 'a' }}{{ "b" }}{{ 'it\'s' }}{{ "a\"b" }}{{ 'a\\' }}{{ "multi
+line" }}{{ '' }}`,
+	"{{ a // b ** c == d != e >= f <= g > h < i = j . k : l | m , n ; o ~ p + q - r * s / t % u }}",
+	"{{ {'a': {'b': [1, (2, 3)]}} }}{% set x = {'a': '}}'} %}",
+	"{{ {} }}}}",
+	"{{ f(a)[b]{c} }}",
+	"{{ ) }}",
+	"{{ (] }}",
+	"{% if x %}",
+	"{{ x",
+	"{# unclosed",
+	"{% raw %} unclosed",
+	"{{ x ! y }}",
+	"{{ x ? }}",
+	"{{ 'unclosed }}",
+	"{{ naïve }}{{ _x1 }}{{ x\u0301 }}",
+	"{{ é }}",
+	"text {{ x }}\n\n  {% if y -%}\n\n   {{- z -}}\n\n{%- endif %}  \n",
+	"a\n  {%- if x %}\n  b\n  {% endif -%}\n  c",
+	"  {{ x }}\n  {% y %}\n  {# z #}",
+	"{{ x }}{{- y }}\n{{- z }}",
+	"{% set x = 1 -%}\n\n{{ x }}",
+	"{%- if true %}{{ '{%' }}{% endif -%}",
+	"{{ x|default('}}') }}{{ '{#' }}",
+	"{% if x\n%}{#}#}{#-#}{#+#}{%-%}{%+%}x{#",
+	"\v{% x %}\n \f{% y %}\na\u00a0{%- z %}",
+	"{{ 1e5_0 }}{{ 1_e5 }}{{ '\\\n' }}{{ x\u0300 }}",
+	"{% raw -%}\n\n{%- endraw %}",
+	"{{-}}{% x -%",
+}
+
+var corpusEnvs = map[string]func(*EnvLexerInformation){
+	"default": func(*EnvLexerInformation) {},
+	"trim_blocks": func(env *EnvLexerInformation) {
+		env.TrimBlocks = true
+	},
+	"lstrip_blocks": func(env *EnvLexerInformation) {
+		env.LStripBlocks = true
+	},
+	"trim_and_lstrip_blocks": func(env *EnvLexerInformation) {
+		env.TrimBlocks = true
+		env.LStripBlocks = true
+	},
+	"keep_trailing_newline": func(env *EnvLexerInformation) {
+		env.KeepTrailingNewline = true
+	},
+	"custom_delimiters": func(env *EnvLexerInformation) {
+		env.BlockStartString, env.BlockEndString = "<%", "%>"
+		env.VariableStartString, env.VariableEndString = "${", "}"
+		env.CommentStartString, env.CommentEndString = "<#", "#>"
+		env.TrimBlocks = true
+	},
+	"latex": func(env *EnvLexerInformation) {
+		env.BlockStartString, env.BlockEndString = `\BLOCK{`, "}"
+		env.VariableStartString, env.VariableEndString = `\VAR{`, "}"
+		env.CommentStartString, env.CommentEndString = `\#{`, "}"
+		env.LineStatementPrefix = strPtr("%%")
+		env.TrimBlocks = true
+		env.LStripBlocks = true
+	},
+	"line_statements": func(env *EnvLexerInformation) {
+		env.LineStatementPrefix = strPtr("#")
+	},
+	"line_statements_lstrip": func(env *EnvLexerInformation) {
+		env.LineStatementPrefix = strPtr("%")
+		env.TrimBlocks = true
+		env.LStripBlocks = true
+	},
+}
+
+// lineStatementCorpus is tokenized in the configurations with line
+// statements.
+var lineStatementCorpus = []string{
+	"# for x in xs\n  {{ x }}\n# endfor",
+	"# for x in xs:\n  # if x\n{{ x }}\n  # endif\n# endfor\n",
+	"  \t# if (a,\n  b)\nx\n# endif\n\n\n",
+	"#- if x\n#+ endif",
+	"a\n# if x\n\n  \n# endif",
+	"#\n#",
+	"\\BLOCK{ for x in xs }\n  \\VAR{ x }\n\\BLOCK{ endfor }\n%% if y\n\\#{ comment }\n%% endif",
+	"% for x in xs\n  {% if x %}\n  % endif\n",
+	"% x (\n)\n# if (\n",
+	"a%%b\n%% x\n\\BLOCK{ {'a': 1} }}\\VAR{ {} }",
+}
+
+func TestScannerCorpus(t *testing.T) {
+	for envName, configure := range corpusEnvs {
+		env := DefaultEnvLexerInformation()
+		configure(env)
+		l := New(env)
+		sources := corpus
+		if env.LineStatementPrefix != nil {
+			sources = append(append([]string(nil), corpus...), lineStatementCorpus...)
+		}
+		for _, source := range sources {
+			for _, state := range []*string{nil, strPtr("block"), strPtr("variable")} {
+				expected, expectedErr := l.tokeniterRegexp(source, nil, nil, state)
+				got, err := l.Tokeniter(source, nil, nil, state)
+				if (err == nil) != (expectedErr == nil) || (err != nil && err.Error() != expectedErr.Error()) {
+					t.Fatalf("%s: %q: expected error %v, got %v", envName, source, expectedErr, err)
+				}
+				if (len(got) > 0 || len(expected) > 0) && !reflect.DeepEqual(got, expected) {
+					t.Fatalf("%s: %q:\nexpected %v\ngot      %v", envName, source, expected, got)
+				}
+			}
+		}
+	}
+}
+
+func TestScannerLineComments(t *testing.T) {
+	env := DefaultEnvLexerInformation()
+	env.LineStatementPrefix = strPtr("#")
+	env.LineCommentPrefix = strPtr("##")
+	tokens, err := New(env).Tokeniter("a ## one\n  ## two\n# if x\nb\t## four\n# endif\n##", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, token := range tokens {
+		got = append(got, token.token+":"+token.valueStr)
+	}
+	expected := []string{
+		"data:a", "linecomment_begin: ##", "linecomment: one", "linecomment_end:", "data:\n",
+		"linecomment_begin:  ##", "linecomment: two", "linecomment_end:", "data:\n",
+		"linestatement_begin:#", "whitespace: ", "name:if", "whitespace: ", "name:x", "linestatement_end:\n", "data:b", "linecomment_begin:\t##", "linecomment: four", "linecomment_end:", "data:\n",
+		"linestatement_begin:#", "whitespace: ", "name:endif", "linestatement_end:\n",
+		"linecomment_begin:##", "linecomment_end:",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q\ngot      %q", expected, got)
+	}
+}
+
+func TestScannerLineStatementStart(t *testing.T) {
+	env := DefaultEnvLexerInformation()
+	env.LineStatementPrefix = strPtr("#")
+	// The regexp lexer saw the start of a line after every tag, the prefix
+	// of line statements must start the line like in Jinja.
+	tokens, err := New(env).Tokeniter("{{ x }}# y\n  # z", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, token := range tokens {
+		got = append(got, token.token+":"+token.valueStr)
+	}
+	expected := []string{
+		"variable_begin:{{", "whitespace: ", "name:x", "whitespace: ", "variable_end:}}", "data:# y\n",
+		"linestatement_begin:  #", "whitespace: ", "name:z", "linestatement_end:",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q\ngot      %q", expected, got)
+	}
+}
+
+// benchmarkSource is a template of about 20KB, the regexp lexer is
+// quadratic in the length of the template.
+var benchmarkSource = strings.Repeat(`<ul class="{{ cls|default('items') }}">
+  {# the items of the page #}
+  {% for item in items if item.visible -%}
+    <li id="item-{{ loop.index }}">{{ item.title|e }} ({{ item.price * 1.2 }})</li>
+  {%- else %}
+    <li>{{ _('No items, see %(url)s', url=urls['help']) }}</li>
+  {%- endfor %}
+</ul>
+{% raw %}{{ raw }}{% endraw %}
+`, 60)
+
+func BenchmarkTokeniter(b *testing.B) {
+	l := New(DefaultEnvLexerInformation())
+	b.SetBytes(int64(len(benchmarkSource)))
+	for i := 0; i < b.N; i++ {
+		if _, err := l.Tokeniter(benchmarkSource, nil, nil, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTokeniterRegexp(b *testing.B) {
+	l := New(DefaultEnvLexerInformation())
+	b.SetBytes(int64(len(benchmarkSource)))
+	for i := 0; i < b.N; i++ {
+		if _, err := l.tokeniterRegexp(benchmarkSource, nil, nil, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -11,6 +11,7 @@ type TokenStream struct {
 	filename *string
 	closed   bool
 	current  Token
+	previous Token
 	idx      int
 }
 
@@ -20,15 +21,26 @@ func NewTokenStream(tokens []Token, name *string, filename *string) *TokenStream
 		name:     name,
 		filename: filename,
 		closed:   false,
-		current:  Token{1, TokenInitial, ""},
+		current:  Token{Lineno: 1, Type: TokenInitial, Value: ""},
 		idx:      0,
 	}
 	_ = ret.Next()
 	return ret
 }
 
+// Name returns the name of the template the tokens come from.
+func (ts TokenStream) Name() *string {
+	return ts.name
+}
+
+// Filename returns the file the tokens come from.
+func (ts TokenStream) Filename() *string {
+	return ts.filename
+}
+
 func (ts *TokenStream) Next() Token {
 	rv := ts.current
+	ts.previous = rv
 
 	if ts.current.Type != TokenEOF {
 		if ts.idx < len(ts.tokens) {
@@ -43,7 +55,8 @@ func (ts *TokenStream) Next() Token {
 }
 
 func (ts *TokenStream) Close() {
-	ts.current = Token{ts.current.Lineno, TokenEOF, ""}
+	end := ts.current.Span.End
+	ts.current = Token{Lineno: ts.current.Lineno, Type: TokenEOF, Value: "", Span: Span{end, end}}
 	ts.closed = true
 }
 
@@ -59,9 +72,16 @@ func (ts TokenStream) Current() Token {
 	return ts.current
 }
 
+// Previous returns the last token consumed by Next, which is the last
+// token of whatever was just parsed.
+func (ts TokenStream) Previous() Token {
+	return ts.previous
+}
+
 func (ts TokenStream) Look() Token {
-	if ts.idx+1 < len(ts.tokens) {
-		return ts.tokens[ts.idx+1]
+	// current is tokens[idx-1], so the next one is at idx
+	if ts.idx < len(ts.tokens) {
+		return ts.tokens[ts.idx]
 	}
 	return ts.current
 }
@@ -89,16 +109,18 @@ func (ts *TokenStream) Expect(expr string) (*Token, error) {
 		desc := DescribeTokenExpr(expr)
 
 		if ts.current.Type == TokenEOF {
-			return nil, errors.TemplateSyntaxError(
+			return nil, errors.TemplateSyntaxErrorAt(
 				fmt.Sprintf("unexpected end of template, expected '%s'.", desc),
 				ts.current.Lineno,
+				ts.current.Span.Start.Col+1,
 				ts.name,
 				ts.filename,
 			)
 		}
-		return nil, errors.TemplateSyntaxError(
+		return nil, errors.TemplateSyntaxErrorAt(
 			fmt.Sprintf("expected token '%s', got '%s'", desc, DescribeToken(ts.current)),
 			ts.current.Lineno,
+			ts.current.Span.Start.Col+1,
 			ts.name,
 			ts.filename,
 		)
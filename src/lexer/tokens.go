@@ -114,7 +114,7 @@ func getOperatorRe(ops map[string]string) *regexp.Regexp {
 		els[i] = regexp.QuoteMeta(el)
 	}
 	pat := strings.Join(els, "|")
-	return regexp.MustCompile("^" + pat)
+	return regexp.MustCompile("^(?:" + pat + ")")
 }
 
 var ignoredTokens = set.FrozenFromElems(
@@ -188,10 +188,40 @@ func DescribeTokenExpr(expr string) string {
 	return describeTokenType(expr)
 }
 
+// Position is a location in the template source.
+type Position struct {
+	// Offset is the byte offset in the source passed to the lexer.
+	Offset int
+	// Lineno is the 1-based line number.
+	Lineno int
+	// Col is the 0-based byte offset from the start of the line.
+	Col int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Lineno, p.Col+1)
+}
+
+// Span is the part of the source between Start (inclusive) and End (exclusive).
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// IsZero tells if the span wasn't set.
+func (s Span) IsZero() bool {
+	return s == Span{}
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
+}
+
 type Token struct {
 	Lineno int
 	Type   string
 	Value  any
+	Span   Span
 }
 
 func (t Token) String() string {
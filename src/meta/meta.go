@@ -0,0 +1,335 @@
+// Package meta provides functions giving information about the abstract
+// syntax tree of templates, like Jinja's `jinja2.meta` module.
+package meta
+
+import (
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/utils/set"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// FindUndeclaredVariables returns the sorted names of the variables a
+// template looks up in the render context: the variables that aren't set,
+// imported, loop targets or macro arguments where they are used. Variables
+// only set in some branches of an if are undeclared, as they come from the
+// context in the other branches.
+//
+// Unlike Jinja, the AST doesn't know its environment, so the globals are
+// returned as well.
+func FindUndeclaredVariables(ast *nodes.Template) []string {
+	f := &finder{undeclared: set.New[string]()}
+	root := newSymbols(nil)
+	root.declare("self")
+	f.frame(root, func(s *symbols) {
+		f.visitList(s, ast.Body)
+	})
+	for len(f.pending) > 0 {
+		next := f.pending[0]
+		f.pending = f.pending[1:]
+		next()
+	}
+	names := maps.Keys(f.undeclared)
+	slices.Sort(names)
+	return names
+}
+
+// symbols are the names defined in a frame, the scope of a template, a
+// macro, a loop body...
+type symbols struct {
+	parent *symbols
+	refs   set.Set[string]
+	stores set.Set[string]
+	// frame is the symbols of the frame, the symbols of the branches of an
+	// if are copies merged into it.
+	frame *symbols
+}
+
+func newSymbols(parent *symbols) *symbols {
+	if parent != nil {
+		parent = parent.frame
+	}
+	s := &symbols{parent: parent, refs: set.New[string](), stores: set.New[string]()}
+	s.frame = s
+	return s
+}
+
+func (s *symbols) find(name string) bool {
+	for cur := s; cur != nil; cur = cur.parent {
+		if cur.refs.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *symbols) declare(name string) {
+	s.refs.Add(name)
+}
+
+func (s *symbols) store(name string) {
+	s.refs.Add(name)
+	s.stores.Add(name)
+}
+
+func (s *symbols) copy() *symbols {
+	return &symbols{parent: s.parent, refs: copySet(s.refs), stores: copySet(s.stores), frame: s.frame}
+}
+
+func copySet(s set.Set[string]) set.Set[string] {
+	ret := make(set.Set[string], len(s))
+	maps.Copy(ret, s)
+	return ret
+}
+
+// finder tracks the names like the symbols of Jinja's code generator: a
+// frame is analyzed in the order of the template, but the frames nested in
+// it (macros, loop bodies...) are analyzed after it, so they see the names
+// defined anywhere in the enclosing frames.
+type finder struct {
+	undeclared set.Set[string]
+	pending    []func()
+}
+
+// frame analyzes a frame with analyze once the current frames are done.
+func (f *finder) frame(s *symbols, analyze func(*symbols)) {
+	f.pending = append(f.pending, func() {
+		analyze(s)
+	})
+}
+
+func (f *finder) load(s *symbols, name string) {
+	if !s.find(name) {
+		s.declare(name)
+		f.undeclared.Add(name)
+	}
+}
+
+func (f *finder) visitList(s *symbols, list []nodes.Node) {
+	for _, n := range list {
+		f.visit(s, n)
+	}
+}
+
+func (f *finder) visit(s *symbols, node nodes.Node) {
+	switch n := node.(type) {
+	case *nodes.Name:
+		switch n.Ctx {
+		case "store":
+			s.store(n.Name)
+		case "param":
+			s.declare(n.Name)
+		default:
+			f.load(s, n.Name)
+		}
+	case *nodes.NSRef:
+		f.load(s, n.Name)
+	case *nodes.Assign:
+		f.visit(s, n.Node)
+		f.visit(s, n.Target)
+	case *nodes.AssignBlock:
+		f.visit(s, n.Target)
+		f.frame(newSymbols(s), func(inner *symbols) {
+			f.visitList(inner, n.Body)
+			if n.Filter != nil {
+				f.visit(inner, n.Filter)
+			}
+		})
+	case *nodes.If:
+		f.visit(s, n.Test)
+		branches := [][]nodes.Node{n.Body}
+		for _, elif := range n.Elif {
+			f.visit(s, elif.Test)
+			branches = append(branches, elif.Body)
+		}
+		f.branches(s, append(branches, n.Else)...)
+	case *nodes.For:
+		f.visit(s, n.Iter)
+		f.frame(newSymbols(s), func(inner *symbols) {
+			inner.declare("loop")
+			declareTarget(inner, n.Target)
+			f.visitList(inner, n.Body)
+		})
+		if n.Test != nil {
+			f.frame(newSymbols(s), func(inner *symbols) {
+				declareTarget(inner, n.Target)
+				f.visit(inner, *n.Test)
+			})
+		}
+		f.frame(newSymbols(s), func(inner *symbols) {
+			f.visitList(inner, n.Else)
+		})
+	case *nodes.Macro:
+		s.store(n.Name)
+		f.macro(s, n.MacroCall, n.Body)
+	case *nodes.CallBlock:
+		f.visit(s, &n.Call)
+		f.macro(s, n.MacroCall, n.Body)
+	case *nodes.FilterBlock:
+		f.visit(s, n.Filter)
+		f.frame(newSymbols(s), func(inner *symbols) {
+			f.visitList(inner, n.Body)
+		})
+	case *nodes.With:
+		for _, value := range n.Values {
+			f.visit(s, value)
+		}
+		f.frame(newSymbols(s), func(inner *symbols) {
+			for _, target := range n.Targets {
+				declareTarget(inner, target)
+			}
+			f.visitList(inner, n.Body)
+		})
+	case *nodes.Block:
+		// blocks are rendered on their own, they only see the context
+		f.frame(newSymbols(nil), func(inner *symbols) {
+			inner.declare("self")
+			inner.declare("super")
+			f.visitList(inner, n.Body)
+		})
+	case *nodes.Scope:
+		f.frame(newSymbols(s), func(inner *symbols) {
+			f.visitList(inner, n.Body)
+		})
+	case *nodes.ScopedEvalContextModifier:
+		f.visit(s, &n.EvalContextModifier)
+		f.frame(newSymbols(s), func(inner *symbols) {
+			f.visitList(inner, n.Body)
+		})
+	case *nodes.Import:
+		f.visit(s, n.Template)
+		s.store(n.Target)
+	case *nodes.FromImport:
+		f.visit(s, n.Template)
+		for _, name := range n.Names {
+			s.store(name[len(name)-1])
+		}
+	default:
+		for _, child := range nodes.Children(node) {
+			f.visit(s, child)
+		}
+	}
+}
+
+// declareTarget declares the names of a loop or with target.
+func declareTarget(s *symbols, target nodes.Node) {
+	nodes.Inspect(target, func(n nodes.Node) bool {
+		if name, ok := n.(*nodes.Name); ok {
+			s.declare(name.Name)
+		}
+		return true
+	})
+}
+
+// macro analyzes the frame of a macro or of the body of a call block.
+func (f *finder) macro(s *symbols, call nodes.MacroCall, body []nodes.Node) {
+	f.frame(newSymbols(s), func(inner *symbols) {
+		for _, name := range []string{"caller", "kwargs", "varargs"} {
+			inner.declare(name)
+		}
+		for _, arg := range call.Args {
+			inner.declare(arg.Name)
+		}
+		for _, def := range call.Defaults {
+			f.visit(inner, def)
+		}
+		f.visitList(inner, body)
+	})
+}
+
+// branches analyzes the branches of an if, an empty else included. The
+// names set in every branch are set after the if, the ones set in some
+// branches only are looked up in the context if they weren't known before
+// the if, in the frame or the enclosing ones. Jinja counts the elifs as a
+// single branch, even without elifs, so it doesn't see the names set in
+// both branches of an if/else.
+func (f *finder) branches(s *symbols, branches ...[]nodes.Node) {
+	inners := make([]*symbols, len(branches))
+	for i, branch := range branches {
+		inners[i] = s.copy()
+		f.visitList(inners[i], branch)
+	}
+	// the names known before the if (arguments, targets, names set earlier)
+	// are never looked up in the context
+	stored := make(map[string]int)
+	for _, inner := range inners {
+		for name := range inner.stores {
+			if !s.find(name) {
+				stored[name]++
+			}
+		}
+	}
+	for _, inner := range inners {
+		maps.Copy(s.refs, inner.refs)
+		maps.Copy(s.stores, inner.stores)
+	}
+	for name, count := range stored {
+		if count < len(branches) {
+			f.undeclared.Add(name)
+		}
+	}
+}
+
+// FindReferencedTemplates returns the names of the templates extended,
+// included or imported by a template, in the order of the template. The
+// names of templates computed at render time are nil. Includes of lists of
+// templates return the strings of the list, or nil for the dynamic items.
+func FindReferencedTemplates(ast *nodes.Template) []*string {
+	var names []*string
+	nodes.Inspect(ast, func(node nodes.Node) bool {
+		var template nodes.Expr
+		switch n := node.(type) {
+		case *nodes.Extends:
+			template = n.Template
+		case *nodes.Include:
+			template = n.Template
+		case *nodes.Import:
+			template = n.Template
+		case *nodes.FromImport:
+			template = n.Template
+		default:
+			return true
+		}
+		_, include := node.(*nodes.Include)
+		names = append(names, templateNames(template, include)...)
+		return true
+	})
+	return names
+}
+
+func templateNames(template nodes.Expr, include bool) []*string {
+	var items []nodes.Expr
+	switch t := template.(type) {
+	case *nodes.Const:
+		if s, ok := t.Value.(string); ok {
+			return []*string{&s}
+		}
+		if values, ok := t.Value.([]any); ok && include {
+			var names []*string
+			for _, v := range values {
+				if s, ok := v.(string); ok {
+					names = append(names, &s)
+				}
+			}
+			return names
+		}
+		return []*string{nil}
+	case *nodes.Tuple:
+		items = t.Items
+	case *nodes.List:
+		items = t.Items
+	default:
+		return []*string{nil}
+	}
+
+	var names []*string
+	for _, item := range items {
+		c, ok := item.(*nodes.Const)
+		if !ok {
+			names = append(names, nil)
+		} else if s, ok := c.Value.(string); ok {
+			names = append(names, &s)
+		}
+	}
+	return names
+}
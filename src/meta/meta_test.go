@@ -0,0 +1,76 @@
+package meta
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/nodes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, source string) *nodes.Template {
+	env, err := environment.New(environment.DefaultEnvOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := env.Parse(source, nil, nil)
+	if err != nil {
+		t.Fatal(source, err)
+	}
+	return template
+}
+
+var undeclaredCases = map[string]string{
+	`{% set foo = 42 %}{{ bar + foo }}`:                                                               "bar",
+	`{{ x }}{% set x = 1 %}{{ x }}`:                                                                   "x",
+	`{% set x = x + 1 %}`:                                                                             "x",
+	`{% for item in seq %}{{ item }}{{ loop.index }}{% endfor %}{{ item }}`:                           "item,seq",
+	`{% for x in y if x > z %}{% set w = 1 %}{% else %}{{ x }}{% endfor %}{{ w }}`:                    "w,x,y,z",
+	`{% for i in y %}{{ z }}{% endfor %}{% set z = 1 %}`:                                              "y",
+	`{% macro m(a, b=c) %}{{ a }}{{ b }}{{ d }}{{ caller() }}{% endmacro %}{{ m }}`:                   "c,d",
+	`{% call(item) m(a) %}{{ item }}{{ e }}{% endcall %}`:                                             "a,e,m",
+	`{% with a = b, c = a %}{{ a }}{{ c }}{{ d }}{% endwith %}{{ a }}`:                                "a,b,d",
+	`{% import 'x' as x %}{% from 'y' import z as w, v %}{{ x }}{{ w }}{{ v }}{{ z }}`:                "z",
+	`{% if a %}{% set x = 1 %}{% else %}{% set x = 2 %}{% endif %}{{ x }}`:                            "a",
+	`{% if a %}{% set x = 1 %}{% elif b %}{% set x = 2 %}{% else %}{% set x = 3 %}{% endif %}{{ x }}`: "a,b",
+	`{% if a %}{% set x = 1 %}{% endif %}{{ x }}`:                                                     "a,x",
+	`{% if a %}{% set x = 1 %}{% elif b %}{% set x = 2 %}{% endif %}`:                                 "a,b,x",
+	`{% if a %}{% for i in l %}{{ z }}{% endfor %}{% endif %}{% set z = 1 %}`:                         "a,l",
+	`{% set x = 1 %}{% block b %}{{ x }}{{ self }}{{ super() }}{% endblock %}`:                        "x",
+	`{% set ns = namespace() %}{% set ns.a = b %}{{ ns.a }}`:                                          "b,namespace",
+	`{% set x %}{{ y }}{% set z = 1 %}{% endset %}{{ x }}{{ z }}`:                                     "y,z",
+	`{% filter upper(f) %}{{ g }}{% endfilter %}`:                                                     "f,g",
+	`{{ self }}{{ range(3) }}`:                                                                        "range",
+	`{% macro m(x) %}{% if a %}{% set x = 1 %}{% endif %}{{ x }}{% endmacro %}`:                       "a",
+	`{% for x in y %}{% if a %}{% set x = 1 %}{% endif %}{{ x }}{% endfor %}`:                         "a,y",
+	`{% with x = 1 %}{% if a %}{% set x = 2 %}{% endif %}{{ x }}{% endwith %}`:                        "a",
+	`{% set x = 1 %}{% for i in y %}{% if a %}{% set x = 2 %}{% endif %}{{ x }}{% endfor %}`:          "a,y",
+}
+
+func TestFindUndeclaredVariables(t *testing.T) {
+	for source, expected := range undeclaredCases {
+		if res := strings.Join(FindUndeclaredVariables(parse(t, source)), ","); res != expected {
+			t.Fatalf("%s: expected %q, got %q", source, expected, res)
+		}
+	}
+}
+
+func TestFindReferencedTemplates(t *testing.T) {
+	template := parse(t, `{% extends "layout.html" %}
+{% include ["a.html", b, 1] %}
+{% import "macros.html" as m %}
+{% from name import x %}
+{% include "c" ~ d %}`)
+	var names []any
+	for _, name := range FindReferencedTemplates(template) {
+		if name == nil {
+			names = append(names, nil)
+		} else {
+			names = append(names, *name)
+		}
+	}
+	expected := []any{"layout.html", "a.html", nil, "macros.html", nil, nil}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatal("expected", expected, "got", names)
+	}
+}
@@ -0,0 +1,312 @@
+package nodes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// nodeType is the type implemented by the nodes, the value nodes in fields
+// like If.Elif are found with it.
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+// Dump returns a representation of node like the repr of Jinja's nodes,
+// indented like Python's ast.dump:
+//
+//	Template(
+//	  body=[
+//	    Output(
+//	      nodes=[
+//	        Name(name='x', ctx='load')])])
+//
+// The fields are the ones of the Go nodes, in snake case, without the line
+// numbers and spans.
+func Dump(node Node) string {
+	s, _ := dump(reflect.ValueOf(&node).Elem(), "  ", 0)
+	return s
+}
+
+// Repr returns the representation of Dump on a single line, like
+// `Template(body=[Output(nodes=[Name(name='x', ctx='load')])])`.
+func Repr(node Node) string {
+	s, _ := dump(reflect.ValueOf(&node).Elem(), "", 0)
+	return s
+}
+
+// dump formats v like Python's ast.dump, it tells if the result is simple
+// enough to be written on the line of its parent.
+func dump(v reflect.Value, indent string, level int) (string, bool) {
+	prefix, sep := "", ", "
+	if indent != "" {
+		level++
+		prefix = "\n" + strings.Repeat(indent, level)
+		sep = "," + prefix
+	}
+
+	if node, ok := asNode(v); ok {
+		var args []string
+		simple := true
+		for _, f := range fields(node) {
+			s, ok := dump(f.value, indent, level)
+			simple = simple && ok
+			args = append(args, f.name+"="+s)
+		}
+		name := node.Type().Name()
+		if simple && len(args) <= 3 {
+			return name + "(" + strings.Join(args, ", ") + ")", len(args) == 0
+		}
+		return name + "(" + prefix + strings.Join(args, sep) + ")", false
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return "None", true
+		}
+		return dump(v.Elem(), indent, level)
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return "[]", true
+		}
+		items := make([]string, v.Len())
+		simple := true
+		for i := range items {
+			var ok bool
+			items[i], ok = dump(v.Index(i), indent, level)
+			simple = simple && ok
+		}
+		if simple {
+			return "[" + strings.Join(items, ", ") + "]", false
+		}
+		return "[" + prefix + strings.Join(items, sep) + "]", false
+	case reflect.Map:
+		keys := sortedKeys(v)
+		items := make([]string, len(keys))
+		for i, k := range keys {
+			key, _ := dump(k, "", 0)
+			value, _ := dump(v.MapIndex(k), "", 0)
+			items[i] = key + ": " + value
+		}
+		return "{" + strings.Join(items, ", ") + "}", true
+	case reflect.String:
+		return pyRepr(v.String()), true
+	case reflect.Bool:
+		if v.Bool() {
+			return "True", true
+		}
+		return "False", true
+	case reflect.Float32, reflect.Float64:
+		return formatFloat(v.Float()), true
+	}
+	return fmt.Sprint(v.Interface()), true
+}
+
+// field is a field of a node, with its name in snake case.
+type field struct {
+	name  string
+	value reflect.Value
+}
+
+// asNode returns the node struct v holds, whether v is a node, a pointer to
+// a node or an interface holding one.
+func asNode(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || !reflect.PointerTo(v.Type()).Implements(nodeType) {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// fields returns the fields of a node struct, the ones of the embedded
+// structs included, without the line numbers and spans.
+func fields(v reflect.Value) []field {
+	var ret []field
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() || f.Name == "Lineno" || f.Name == "Span" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			ret = append(ret, fields(v.Field(i))...)
+			continue
+		}
+		ret = append(ret, field{snakeCase(f.Name), v.Field(i)})
+	}
+	return ret
+}
+
+// snakeCase converts the name of a Go field to the name of a Jinja field,
+// like DynArgs to dyn_args.
+func snakeCase(name string) string {
+	var builder strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				builder.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// pyRepr quotes s like Python's repr.
+func pyRepr(s string) string {
+	quote := byte('\'')
+	if strings.Contains(s, "'") && !strings.Contains(s, `"`) {
+		quote = '"'
+	}
+	quoted := strconv.Quote(s)
+	quoted = strings.ReplaceAll(quoted[1:len(quoted)-1], `\"`, `"`)
+	if quote == '\'' {
+		quoted = strings.ReplaceAll(quoted, "'", `\'`)
+	}
+	return string(quote) + quoted + string(quote)
+}
+
+// formatFloat formats f like Python's repr.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
+
+// sortedKeys returns the keys of a map in the order of their representation,
+// so dumps don't depend on the iteration order.
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := dump(keys[i], "", 0)
+		b, _ := dump(keys[j], "", 0)
+		return a < b
+	})
+	return keys
+}
+
+// DumpJSON returns the JSON representation of node, indented. Each node is
+// an object with its type, its line number and its fields in snake case:
+//
+//	{"type": "Name", "lineno": 1, "name": "x", "ctx": "load"}
+func DumpJSON(node Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := dumpJSON(&buf, reflect.ValueOf(&node).Elem()); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func dumpJSON(buf *bytes.Buffer, v reflect.Value) error {
+	if node, ok := asNode(v); ok {
+		buf.WriteString(`{"type":`)
+		writeJSON(buf, node.Type().Name())
+		buf.WriteString(`,"lineno":`)
+		writeJSON(buf, lineno(node))
+		for _, f := range fields(node) {
+			buf.WriteByte(',')
+			writeJSON(buf, f.name)
+			buf.WriteByte(':')
+			if err := dumpJSON(buf, f.value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		buf.WriteString("null")
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return dumpJSON(buf, v.Elem())
+	case reflect.Slice:
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := dumpJSON(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case reflect.Map:
+		// the keys of the constants aren't always strings, the maps are
+		// written as lists of pairs
+		buf.WriteByte('[')
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('[')
+			if err := dumpJSON(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(',')
+			if err := dumpJSON(buf, v.MapIndex(k)); err != nil {
+				return err
+			}
+			buf.WriteByte(']')
+		}
+		buf.WriteByte(']')
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); math.IsInf(f, 0) || math.IsNaN(f) {
+			return fmt.Errorf("can't represent %s in JSON", formatFloat(f))
+		}
+		writeJSON(buf, v.Interface())
+	case reflect.String, reflect.Bool:
+		writeJSON(buf, v.Interface())
+	default:
+		if !v.CanInt() && !v.CanUint() {
+			return fmt.Errorf("can't represent %s in JSON", v.Type())
+		}
+		writeJSON(buf, v.Interface())
+	}
+	return nil
+}
+
+// writeJSON writes a value that can always be encoded.
+func writeJSON(buf *bytes.Buffer, v any) {
+	data, _ := json.Marshal(v)
+	buf.Write(data)
+}
+
+// lineno returns the line number of a node struct, which may not be
+// addressable.
+func lineno(v reflect.Value) int {
+	if !v.CanAddr() {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		v = ptr.Elem()
+	}
+	return v.Addr().Interface().(Node).GetLineno()
+}
@@ -0,0 +1,63 @@
+package nodes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	template := &Template{Body: []Node{
+		&Output{Nodes: []Expr{&Name{Name: "x", Ctx: "load"}}},
+	}}
+	if res := Repr(template); res != `Template(body=[Output(nodes=[Name(name='x', ctx='load')])])` {
+		t.Fatal("unexpected repr", res)
+	}
+	expected := `Template(
+  body=[
+    Output(
+      nodes=[
+        Name(name='x', ctx='load')])])`
+	if res := Dump(template); res != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, res)
+	}
+
+	filter := &Filter{FilterTestCommon{
+		Name:   "f",
+		Args:   []Expr{&Const{Value: 1.0}, &Const{Value: "it's"}, &Const{Value: map[any]any{"b": nil, "a": []any{true}}}},
+		Kwargs: []Keyword{{Key: "k", Value: &Const{Value: int64(2)}}},
+	}}
+	res := Repr(filter)
+	expected = `Filter(node=None, name='f', args=[Const(value=1.0), Const(value="it's"), Const(value={'a': [True], 'b': None})], kwargs=[Keyword(key='k', value=Const(value=2))], dyn_args=None, dyn_kwargs=None)`
+	if res != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, res)
+	}
+
+	imp := &FromImport{Template: &Const{Value: "a"}, Names: [][]string{{"b"}, {"c", "d"}}}
+	if res := Repr(imp); res != `FromImport(template=Const(value='a'), with_context=False, names=[['b'], ['c', 'd']])` {
+		t.Fatal("unexpected repr", res)
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	node := &If{
+		Test: &Name{Name: "a", Ctx: "load", ExprCommon: ExprCommon{Lineno: 1}},
+		Body: []Node{&Output{Nodes: []Expr{&Const{Value: map[any]any{int64(1): "x"}}}, StmtCommon: StmtCommon{Lineno: 2}}},
+		Elif: []If{{Test: &Const{Value: nil}, StmtCommon: StmtCommon{Lineno: 3}}},
+	}
+	data, err := DumpJSON(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"type":"If","lineno":0,"test":{"type":"Name","lineno":1,"name":"a","ctx":"load"},` +
+		`"body":[{"type":"Output","lineno":2,"nodes":[{"type":"Const","lineno":0,"value":[[1,"x"]]}]}],` +
+		`"elif":[{"type":"If","lineno":3,"test":{"type":"Const","lineno":0,"value":null},"body":[],"elif":[],"else":[]}],` +
+		`"else":[]}`
+	compact := strings.Join(strings.Fields(string(data)), "")
+	if compact != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, compact)
+	}
+
+	if _, err = DumpJSON(&Const{Value: struct{}{}}); err == nil {
+		t.Fatal("expected an error for a value without JSON representation")
+	}
+}
@@ -1,12 +1,19 @@
 package nodes
 
 import (
+	"github.com/gojinja/gojinja/src/lexer"
 	"golang.org/x/exp/slices"
 )
 
 type Node interface {
 	GetLineno() int
+	// GetSpan returns the part of the source the node was parsed from.
+	GetSpan() lexer.Span
+	SetSpan(span lexer.Span)
 	SetCtx(ctx string)
+	// VisitChildren passes the fields holding child nodes to v, in the order
+	// of the fields of Jinja's nodes. See Children and TransformChildren.
+	VisitChildren(v *ChildVisitor)
 }
 
 type ExprWithName interface {
@@ -21,24 +28,49 @@ type SetWithContexter interface {
 
 type NodeCommon struct {
 	Lineno int
+	Span   lexer.Span
 }
 
 func (n *NodeCommon) GetLineno() int {
 	return n.Lineno
 }
 
+func (n *NodeCommon) GetSpan() lexer.Span {
+	return n.Span
+}
+
+func (n *NodeCommon) SetSpan(span lexer.Span) {
+	n.Span = span
+}
+
 type ExprCommon NodeCommon
 
 func (e *ExprCommon) GetLineno() int {
 	return e.Lineno
 }
 
+func (e *ExprCommon) GetSpan() lexer.Span {
+	return e.Span
+}
+
+func (e *ExprCommon) SetSpan(span lexer.Span) {
+	e.Span = span
+}
+
 type StmtCommon NodeCommon
 
 func (s *StmtCommon) GetLineno() int {
 	return s.Lineno
 }
 
+func (s *StmtCommon) GetSpan() lexer.Span {
+	return s.Span
+}
+
+func (s *StmtCommon) SetSpan(span lexer.Span) {
+	s.Span = span
+}
+
 type StmtWithNodes interface {
 	GetNodes() []Expr
 	Stmt
@@ -59,6 +91,10 @@ func (t *Template) SetCtx(ctx string) {
 	}
 }
 
+func (t *Template) VisitChildren(v *ChildVisitor) {
+	ChildList(v, &t.Body)
+}
+
 type Stmt interface {
 	Node
 }
@@ -82,6 +118,10 @@ func (b *Block) SetCtx(ctx string) {
 	}
 }
 
+func (b *Block) VisitChildren(v *ChildVisitor) {
+	ChildList(v, &b.Body)
+}
+
 type Output struct {
 	Nodes []Expr
 	StmtCommon
@@ -97,6 +137,10 @@ func (o *Output) SetCtx(ctx string) {
 	}
 }
 
+func (o *Output) VisitChildren(v *ChildVisitor) {
+	ChildList(v, &o.Nodes)
+}
+
 type Extends struct {
 	Template Expr
 	StmtCommon
@@ -106,6 +150,10 @@ func (e *Extends) SetCtx(ctx string) {
 	e.Template.SetCtx(ctx)
 }
 
+func (e *Extends) VisitChildren(v *ChildVisitor) {
+	Child(v, &e.Template)
+}
+
 type MacroCall struct {
 	Args     []Name
 	Defaults []Expr
@@ -130,6 +178,12 @@ func (m *Macro) SetCtx(ctx string) {
 	}
 }
 
+func (m *Macro) VisitChildren(v *ChildVisitor) {
+	ChildValues(v, &m.Args)
+	ChildList(v, &m.Defaults)
+	ChildList(v, &m.Body)
+}
+
 type EvalContextModifier struct {
 	Options []Keyword
 	StmtCommon
@@ -141,6 +195,10 @@ func (e *EvalContextModifier) SetCtx(ctx string) {
 	}
 }
 
+func (e *EvalContextModifier) VisitChildren(v *ChildVisitor) {
+	ChildValues(v, &e.Options)
+}
+
 type ScopedEvalContextModifier struct {
 	Body []Node
 	EvalContextModifier
@@ -152,6 +210,11 @@ func (s *ScopedEvalContextModifier) SetCtx(ctx string) {
 	}
 }
 
+func (s *ScopedEvalContextModifier) VisitChildren(v *ChildVisitor) {
+	ChildValues(v, &s.Options)
+	ChildList(v, &s.Body)
+}
+
 type Scope struct {
 	Body []Node
 	StmtCommon
@@ -163,6 +226,10 @@ func (s *Scope) SetCtx(ctx string) {
 	}
 }
 
+func (s *Scope) VisitChildren(v *ChildVisitor) {
+	ChildList(v, &s.Body)
+}
+
 type FilterBlock struct {
 	Body   []Node
 	Filter *Filter
@@ -176,6 +243,11 @@ func (f *FilterBlock) SetCtx(ctx string) {
 	f.Filter.SetCtx(ctx)
 }
 
+func (f *FilterBlock) VisitChildren(v *ChildVisitor) {
+	ChildList(v, &f.Body)
+	Child(v, &f.Filter)
+}
+
 type Literal Expr
 type LiteralCommon ExprCommon
 
@@ -183,6 +255,14 @@ func (l LiteralCommon) GetLineno() int {
 	return l.Lineno
 }
 
+func (l LiteralCommon) GetSpan() lexer.Span {
+	return l.Span
+}
+
+func (l *LiteralCommon) SetSpan(span lexer.Span) {
+	l.Span = span
+}
+
 func (LiteralCommon) CanAssign() bool {
 	return false
 }
@@ -198,6 +278,10 @@ func (l *List) SetCtx(ctx string) {
 	}
 }
 
+func (l *List) VisitChildren(v *ChildVisitor) {
+	ChildList(v, &l.Items)
+}
+
 type Pair struct {
 	Key   Expr
 	Value Expr
@@ -209,6 +293,11 @@ func (p *Pair) SetCtx(ctx string) {
 	p.Value.SetCtx(ctx)
 }
 
+func (p *Pair) VisitChildren(v *ChildVisitor) {
+	Child(v, &p.Key)
+	Child(v, &p.Value)
+}
+
 type Dict struct {
 	Items []Pair
 	LiteralCommon
@@ -220,6 +309,10 @@ func (d *Dict) SetCtx(ctx string) {
 	}
 }
 
+func (d *Dict) VisitChildren(v *ChildVisitor) {
+	ChildValues(v, &d.Items)
+}
+
 // TemplateData represents a constant template string.
 type TemplateData struct {
 	Data string
@@ -228,6 +321,8 @@ type TemplateData struct {
 
 func (t *TemplateData) SetCtx(string) {}
 
+func (t *TemplateData) VisitChildren(*ChildVisitor) {}
+
 type Tuple struct {
 	Items []Expr
 	Ctx   string
@@ -241,6 +336,19 @@ func (t *Tuple) SetCtx(ctx string) {
 	t.Ctx = ctx
 }
 
+func (t *Tuple) CanAssign() bool {
+	for _, n := range t.Items {
+		if !n.CanAssign() {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Tuple) VisitChildren(v *ChildVisitor) {
+	ChildList(v, &t.Items)
+}
+
 type Const struct {
 	Value any
 	LiteralCommon
@@ -248,6 +356,8 @@ type Const struct {
 
 func (c *Const) SetCtx(string) {}
 
+func (c *Const) VisitChildren(*ChildVisitor) {}
+
 type Name struct {
 	Name string
 	Ctx  string
@@ -258,6 +368,8 @@ func (n *Name) SetCtx(ctx string) {
 	n.Ctx = ctx
 }
 
+func (n *Name) VisitChildren(*ChildVisitor) {}
+
 func (n Name) CanAssign() bool {
 	return !slices.Contains([]string{"true", "false", "none", "True", "False", "None"}, n.Name)
 }
@@ -274,6 +386,8 @@ type NSRef struct {
 
 func (n NSRef) SetCtx(string) {}
 
+func (n *NSRef) VisitChildren(*ChildVisitor) {}
+
 func (n NSRef) CanAssign() bool {
 	return true
 }
@@ -297,6 +411,12 @@ func (c *CondExpr) SetCtx(ctx string) {
 	}
 }
 
+func (c *CondExpr) VisitChildren(v *ChildVisitor) {
+	Child(v, &c.Test)
+	Child(v, &c.Expr1)
+	ChildPtr(v, &c.Expr2)
+}
+
 type Helper Node
 type HelperCommon NodeCommon
 
@@ -304,6 +424,14 @@ func (h HelperCommon) GetLineno() int {
 	return h.Lineno
 }
 
+func (h HelperCommon) GetSpan() lexer.Span {
+	return h.Span
+}
+
+func (h *HelperCommon) SetSpan(span lexer.Span) {
+	h.Span = span
+}
+
 type Operand struct {
 	Op   string
 	Expr Node
@@ -314,6 +442,10 @@ func (o *Operand) SetCtx(ctx string) {
 	o.Expr.SetCtx(ctx)
 }
 
+func (o *Operand) VisitChildren(v *ChildVisitor) {
+	Child(v, &o.Expr)
+}
+
 type Compare struct {
 	Expr Expr
 	Ops  []Operand
@@ -327,6 +459,11 @@ func (c *Compare) SetCtx(ctx string) {
 	}
 }
 
+func (c *Compare) VisitChildren(v *ChildVisitor) {
+	Child(v, &c.Expr)
+	ChildValues(v, &c.Ops)
+}
+
 type BinExpr struct {
 	Left  Expr
 	Right Expr
@@ -339,6 +476,11 @@ func (b *BinExpr) SetCtx(ctx string) {
 	b.Right.SetCtx(ctx)
 }
 
+func (b *BinExpr) VisitChildren(v *ChildVisitor) {
+	Child(v, &b.Left)
+	Child(v, &b.Right)
+}
+
 type Concat struct {
 	Nodes []Expr
 	ExprCommon
@@ -350,6 +492,10 @@ func (c *Concat) SetCtx(ctx string) {
 	}
 }
 
+func (c *Concat) VisitChildren(v *ChildVisitor) {
+	ChildList(v, &c.Nodes)
+}
+
 type UnaryExpr struct {
 	Node Expr
 	Op   string // same as lexer.TokenAdd etc. + "not"
@@ -360,6 +506,10 @@ func (u *UnaryExpr) SetCtx(ctx string) {
 	u.Node.SetCtx(ctx)
 }
 
+func (u *UnaryExpr) VisitChildren(v *ChildVisitor) {
+	Child(v, &u.Node)
+}
+
 type Getattr struct {
 	Node Expr
 	Attr string
@@ -371,6 +521,10 @@ func (g *Getattr) SetCtx(ctx string) {
 	g.Node.SetCtx(ctx)
 }
 
+func (g *Getattr) VisitChildren(v *ChildVisitor) {
+	Child(v, &g.Node)
+}
+
 type Getitem struct {
 	Node Expr
 	Arg  Expr
@@ -382,6 +536,11 @@ func (g *Getitem) SetCtx(ctx string) {
 	g.Node.SetCtx(ctx)
 }
 
+func (g *Getitem) VisitChildren(v *ChildVisitor) {
+	Child(v, &g.Node)
+	Child(v, &g.Arg)
+}
+
 type Slice struct {
 	Start *Expr
 	Stop  *Expr
@@ -401,6 +560,12 @@ func (s *Slice) SetCtx(ctx string) {
 	}
 }
 
+func (s *Slice) VisitChildren(v *ChildVisitor) {
+	ChildPtr(v, &s.Start)
+	ChildPtr(v, &s.Stop)
+	ChildPtr(v, &s.Step)
+}
+
 type Call struct {
 	Node      Expr
 	Args      []Expr
@@ -426,6 +591,14 @@ func (c *Call) SetCtx(ctx string) {
 	}
 }
 
+func (c *Call) VisitChildren(v *ChildVisitor) {
+	Child(v, &c.Node)
+	ChildList(v, &c.Args)
+	ChildValues(v, &c.Kwargs)
+	ChildPtr(v, &c.DynArgs)
+	ChildPtr(v, &c.DynKwargs)
+}
+
 type Include struct {
 	Template      Expr
 	WithContext   bool
@@ -441,6 +614,10 @@ func (i *Include) SetCtx(ctx string) {
 	i.Template.SetCtx(ctx)
 }
 
+func (i *Include) VisitChildren(v *ChildVisitor) {
+	Child(v, &i.Template)
+}
+
 type Assign struct {
 	Target Expr
 	Node   Node
@@ -452,6 +629,11 @@ func (a *Assign) SetCtx(ctx string) {
 	a.Node.SetCtx(ctx)
 }
 
+func (a *Assign) VisitChildren(v *ChildVisitor) {
+	Child(v, &a.Target)
+	Child(v, &a.Node)
+}
+
 type AssignBlock struct {
 	Target Expr
 	Body   []Node
@@ -469,6 +651,12 @@ func (a *AssignBlock) SetCtx(ctx string) {
 	}
 }
 
+func (a *AssignBlock) VisitChildren(v *ChildVisitor) {
+	Child(v, &a.Target)
+	OptionalChild(v, &a.Filter)
+	ChildList(v, &a.Body)
+}
+
 type With struct {
 	Targets []Expr
 	Values  []Expr
@@ -488,6 +676,12 @@ func (w *With) SetCtx(ctx string) {
 	}
 }
 
+func (w *With) VisitChildren(v *ChildVisitor) {
+	ChildList(v, &w.Targets)
+	ChildList(v, &w.Values)
+	ChildList(v, &w.Body)
+}
+
 type FromImport struct {
 	Template    Expr
 	WithContext bool
@@ -503,6 +697,10 @@ func (f *FromImport) SetCtx(ctx string) {
 	f.Template.SetCtx(ctx)
 }
 
+func (f *FromImport) VisitChildren(v *ChildVisitor) {
+	Child(v, &f.Template)
+}
+
 type Import struct {
 	Template    Expr
 	WithContext bool
@@ -518,6 +716,10 @@ func (i *Import) SetCtx(ctx string) {
 	i.Template.SetCtx(ctx)
 }
 
+func (i *Import) VisitChildren(v *ChildVisitor) {
+	Child(v, &i.Template)
+}
+
 type FilterTestCommon struct {
 	Node      *Expr
 	Name      string
@@ -554,6 +756,14 @@ func (f *FilterTestCommon) SetCtx(ctx string) {
 	}
 }
 
+func (f *FilterTestCommon) VisitChildren(v *ChildVisitor) {
+	ChildPtr(v, &f.Node)
+	ChildList(v, &f.Args)
+	ChildValues(v, &f.Kwargs)
+	ChildPtr(v, &f.DynArgs)
+	ChildPtr(v, &f.DynKwargs)
+}
+
 type Keyword struct {
 	Key   string
 	Value Expr
@@ -564,6 +774,10 @@ func (k *Keyword) SetCtx(ctx string) {
 	k.Value.SetCtx(ctx)
 }
 
+func (k *Keyword) VisitChildren(v *ChildVisitor) {
+	Child(v, &k.Value)
+}
+
 type If struct {
 	Test Node
 	Body []Node
@@ -585,6 +799,13 @@ func (i *If) SetCtx(ctx string) {
 	}
 }
 
+func (i *If) VisitChildren(v *ChildVisitor) {
+	Child(v, &i.Test)
+	ChildList(v, &i.Body)
+	ChildValues(v, &i.Elif)
+	ChildList(v, &i.Else)
+}
+
 type CallBlock struct {
 	Call Call
 	Body []Node
@@ -605,6 +826,13 @@ func (c *CallBlock) SetCtx(ctx string) {
 	}
 }
 
+func (c *CallBlock) VisitChildren(v *ChildVisitor) {
+	ChildValue(v, &c.Call)
+	ChildValues(v, &c.Args)
+	ChildList(v, &c.Defaults)
+	ChildList(v, &c.Body)
+}
+
 type For struct {
 	Target    Node
 	Iter      Node
@@ -629,6 +857,80 @@ func (f *For) SetCtx(ctx string) {
 	}
 }
 
+func (f *For) VisitChildren(v *ChildVisitor) {
+	Child(v, &f.Target)
+	Child(v, &f.Iter)
+	ChildList(v, &f.Body)
+	ChildList(v, &f.Else)
+	ChildPtr(v, &f.Test)
+}
+
+// Break stops the innermost loop, it's added by the loopcontrols extension.
+type Break struct {
+	StmtCommon
+}
+
+func (b *Break) SetCtx(string) {}
+
+func (b *Break) VisitChildren(*ChildVisitor) {}
+
+// Continue skips to the next iteration of the innermost loop, it's added by
+// the loopcontrols extension.
+type Continue struct {
+	StmtCommon
+}
+
+func (c *Continue) SetCtx(string) {}
+
+func (c *Continue) VisitChildren(*ChildVisitor) {}
+
+// ExprStmt evaluates an expression and discards the result, it's added by
+// the do extension.
+type ExprStmt struct {
+	Node Expr
+	StmtCommon
+}
+
+func (e *ExprStmt) SetCtx(ctx string) {
+	e.Node.SetCtx(ctx)
+}
+
+func (e *ExprStmt) VisitChildren(v *ChildVisitor) {
+	Child(v, &e.Node)
+}
+
+// ContextReference evaluates to the current template context.
+type ContextReference struct {
+	ExprCommon
+}
+
+func (c *ContextReference) SetCtx(string) {}
+
+func (c *ContextReference) VisitChildren(*ChildVisitor) {}
+
+// InternalName is a name created by the parser for extensions (see
+// FreeIdentifier of the extension parser), templates can't refer to it.
+type InternalName struct {
+	Name string
+	ExprCommon
+}
+
+func (i *InternalName) SetCtx(string) {}
+
+func (i *InternalName) VisitChildren(*ChildVisitor) {}
+
+// ExtensionAttribute evaluates to the attribute Name of the extension whose
+// identifier is Identifier, see extensions.Attr.
+type ExtensionAttribute struct {
+	Identifier string
+	Name       string
+	ExprCommon
+}
+
+func (e *ExtensionAttribute) SetCtx(string) {}
+
+func (e *ExtensionAttribute) VisitChildren(*ChildVisitor) {}
+
 // Assert all types of nodes implement Node interface.
 var _ Node = &Template{}
 
@@ -650,6 +952,9 @@ var _ Stmt = &With{}
 var _ Stmt = &For{}
 var _ Stmt = &Block{}
 var _ Stmt = &FromImport{}
+var _ Stmt = &Break{}
+var _ Stmt = &Continue{}
+var _ Stmt = &ExprStmt{}
 
 var _ StmtWithNodes = &Output{}
 
@@ -670,6 +975,9 @@ var _ Expr = &NSRef{}
 var _ Expr = &Getattr{}
 var _ Expr = &Getitem{}
 var _ Expr = &Slice{}
+var _ Expr = &ContextReference{}
+var _ Expr = &InternalName{}
+var _ Expr = &ExtensionAttribute{}
 
 var _ ExprWithName = &Name{}
 var _ ExprWithName = &NSRef{}
@@ -0,0 +1,331 @@
+package nodes
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ChildVisitor is passed to the VisitChildren method of the nodes, which
+// passes it every field holding child nodes with Child, ChildPtr,
+// ChildList, ChildValues or ChildValue. It either collects the children
+// (see Children) or replaces them (see TransformChildren).
+type ChildVisitor struct {
+	children  []Node
+	transform func(Node) ([]Node, error)
+	err       error
+}
+
+// visit collects child or transforms it, it returns the nodes replacing
+// child and whether they must replace it.
+func (v *ChildVisitor) visit(child Node) ([]Node, bool) {
+	if v.err != nil || isNil(child) {
+		return nil, false
+	}
+	if v.transform == nil {
+		v.children = append(v.children, child)
+		return nil, false
+	}
+	res, err := v.transform(child)
+	if err != nil {
+		v.err = err
+		return nil, false
+	}
+	return res, true
+}
+
+func (v *ChildVisitor) failf(format string, args ...any) {
+	if v.err == nil {
+		v.err = fmt.Errorf(format, args...)
+	}
+}
+
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	value := reflect.ValueOf(node)
+	return value.Kind() == reflect.Pointer && value.IsNil()
+}
+
+// single returns the only node of res as a T.
+func single[T Node](v *ChildVisitor, child Node, res []Node) (T, bool) {
+	var zero T
+	if len(res) != 1 {
+		v.failf("%T must be replaced by a single node, got %d", child, len(res))
+		return zero, false
+	}
+	t, ok := res[0].(T)
+	if !ok {
+		v.failf("%T can't be replaced by %T", child, res[0])
+	}
+	return t, ok
+}
+
+// Child visits a field holding a required node.
+func Child[T Node](v *ChildVisitor, field *T) {
+	if res, ok := v.visit(*field); ok {
+		if t, ok := single[T](v, *field, res); ok {
+			*field = t
+		}
+	}
+}
+
+// OptionalChild visits a field holding a node that can be nil, the node is
+// set to nil when it's removed.
+func OptionalChild[T Node](v *ChildVisitor, field *T) {
+	if res, ok := v.visit(*field); ok {
+		if len(res) == 0 {
+			var zero T
+			*field = zero
+		} else if t, ok := single[T](v, *field, res); ok {
+			*field = t
+		}
+	}
+}
+
+// ChildPtr visits a field holding a pointer to a node, like the optional
+// arguments of calls. The pointer is set to nil when the node is removed.
+func ChildPtr[T Node](v *ChildVisitor, field **T) {
+	if *field == nil {
+		return
+	}
+	if res, ok := v.visit(**field); ok {
+		if len(res) == 0 {
+			*field = nil
+		} else if t, ok := single[T](v, **field, res); ok {
+			**field = t
+		}
+	}
+}
+
+// ChildList visits a field holding a list of nodes, a node can be removed
+// or replaced by several nodes.
+func ChildList[T Node](v *ChildVisitor, field *[]T) {
+	list := *field
+	if v.transform == nil {
+		for _, child := range list {
+			v.visit(child)
+		}
+		return
+	}
+	var ret []T
+	for idx, child := range list {
+		res, ok := v.visit(child)
+		if v.err != nil {
+			return
+		}
+		if !ok || (len(res) == 1 && res[0] == Node(child)) {
+			if ret != nil {
+				ret = append(ret, child)
+			}
+			continue
+		}
+		if ret == nil {
+			ret = append(make([]T, 0, len(list)), list[:idx]...)
+		}
+		for _, n := range res {
+			t, ok := n.(T)
+			if !ok {
+				v.failf("%T can't be replaced by %T", child, n)
+				return
+			}
+			ret = append(ret, t)
+		}
+	}
+	if ret != nil {
+		*field = ret
+	}
+}
+
+// ChildValues visits a field holding a list of nodes stored by value, like
+// the arguments of macros. The replacing nodes must have the same type.
+func ChildValues[T any, PT interface {
+	*T
+	Node
+}](v *ChildVisitor, field *[]T) {
+	nodes := make([]PT, len(*field))
+	for i := range *field {
+		nodes[i] = &(*field)[i]
+	}
+	ChildList(v, &nodes)
+	if v.transform == nil || v.err != nil || !changed(nodes, *field) {
+		return
+	}
+	values := make([]T, len(nodes))
+	for i, n := range nodes {
+		values[i] = *n
+	}
+	*field = values
+}
+
+// changed tells if nodes aren't the pointers to the values anymore.
+func changed[T any, PT interface {
+	*T
+	Node
+}](nodes []PT, values []T) bool {
+	if len(nodes) != len(values) {
+		return true
+	}
+	for i := range nodes {
+		if nodes[i] != &values[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// ChildValue visits a field holding a required node stored by value, like
+// the call of a call block. The replacing node must have the same type.
+func ChildValue[T any, PT interface {
+	*T
+	Node
+}](v *ChildVisitor, field *T) {
+	var n PT = field
+	Child(v, &n)
+	if n != field {
+		*field = *n
+	}
+}
+
+// Children returns the child nodes of node, in the order of the fields of
+// Jinja's nodes.
+func Children(node Node) []Node {
+	v := &ChildVisitor{}
+	node.VisitChildren(v)
+	return v.children
+}
+
+// Visitor visits the nodes of a tree with Walk.
+type Visitor interface {
+	// Visit is called with every node. If the returned visitor w isn't nil,
+	// the children of the node are visited with w, followed by a call of
+	// w.Visit(nil).
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree depth-first: it calls v.Visit(node) and visits
+// the children of node with the returned visitor.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, child := range Children(node) {
+		Walk(v, child)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree depth-first, it calls f with every node and
+// visits the children of the node if f returns true. f is called with nil
+// after the children of a node.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// TypeVisitor is a Visitor dispatching the nodes by type, like the
+// `visit_<Type>` methods of Jinja's NodeVisitor: the function added with On
+// for the type of a node is called with it, and the children of the node are
+// visited if it returns true. The children of the other nodes are always
+// visited.
+type TypeVisitor struct {
+	funcs map[reflect.Type]func(Node) bool
+}
+
+var _ Visitor = &TypeVisitor{}
+
+// On makes v call f with the nodes of type T, which must be a concrete type
+// like *Name.
+func On[T Node](v *TypeVisitor, f func(T) bool) *TypeVisitor {
+	if v.funcs == nil {
+		v.funcs = make(map[reflect.Type]func(Node) bool)
+	}
+	v.funcs[reflect.TypeOf((*T)(nil)).Elem()] = func(node Node) bool {
+		return f(node.(T))
+	}
+	return v
+}
+
+func (v *TypeVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		return nil
+	}
+	if f, ok := v.funcs[reflect.TypeOf(node)]; ok && !f(node) {
+		return nil
+	}
+	return v
+}
+
+// Transformer rewrites the nodes of a tree, like Jinja's NodeTransformer.
+type Transformer interface {
+	// Transform returns the nodes replacing node: node itself to keep it, no
+	// node to remove it or other nodes. Only the nodes in lists can be
+	// replaced by several nodes, and only optional nodes can be removed. The
+	// children of node aren't transformed unless Transform calls
+	// TransformChildren.
+	Transform(node Node) ([]Node, error)
+}
+
+// TransformChildren replaces the children of node by the result of
+// t.Transform. The replacing nodes must have a type the fields can hold.
+func TransformChildren(t Transformer, node Node) error {
+	v := &ChildVisitor{transform: t.Transform}
+	node.VisitChildren(v)
+	return v.err
+}
+
+// TransformFunc is a Transformer calling the function with every node,
+// after the children of the node were transformed.
+type TransformFunc func(node Node) ([]Node, error)
+
+var _ Transformer = TransformFunc(nil)
+
+func (f TransformFunc) Transform(node Node) ([]Node, error) {
+	if err := TransformChildren(f, node); err != nil {
+		return nil, err
+	}
+	return f(node)
+}
+
+// Find returns the first node of type T among the descendants of node, in
+// the order of Walk.
+func Find[T Node](node Node) (T, bool) {
+	var found T
+	ok := false
+	for _, child := range Children(node) {
+		Inspect(child, func(n Node) bool {
+			if ok || n == nil {
+				return false
+			}
+			found, ok = n.(T)
+			return !ok
+		})
+		if ok {
+			break
+		}
+	}
+	return found, ok
+}
+
+// FindAll returns the nodes of type T among the descendants of node, in the
+// order of Walk.
+func FindAll[T Node](node Node) []T {
+	var found []T
+	for _, child := range Children(node) {
+		Inspect(child, func(n Node) bool {
+			if t, ok := n.(T); ok {
+				found = append(found, t)
+			}
+			return n != nil
+		})
+	}
+	return found
+}
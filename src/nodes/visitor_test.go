@@ -0,0 +1,183 @@
+package nodes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func name(n string, ctx string) *Name {
+	return &Name{Name: n, Ctx: ctx}
+}
+
+// testTemplate is `{% for x in items if x %}{{ f(x, y, k=z, *a) }}{% endfor %}{{ x }}`.
+func testTemplate() *Template {
+	var test Node = name("x", "load")
+	var dynArgs Expr = name("a", "load")
+	return &Template{Body: []Node{
+		&For{
+			Target: name("x", "store"),
+			Iter:   name("items", "load"),
+			Body: []Node{&Output{Nodes: []Expr{&Call{
+				Node:    name("f", "load"),
+				Args:    []Expr{name("x", "load"), name("y", "load")},
+				Kwargs:  []Keyword{{Key: "k", Value: name("z", "load")}},
+				DynArgs: &dynArgs,
+			}}}},
+			Test: &test,
+		},
+		&Output{Nodes: []Expr{name("x", "load")}},
+	}}
+}
+
+// names returns the names in the tree, in the order of Walk.
+func names(node Node) string {
+	var ret []string
+	Inspect(node, func(n Node) bool {
+		if n, ok := n.(*Name); ok {
+			ret = append(ret, n.Name)
+		}
+		return true
+	})
+	return strings.Join(ret, ",")
+}
+
+func TestChildren(t *testing.T) {
+	template := testTemplate()
+	loop := template.Body[0].(*For)
+	children := Children(loop)
+	if len(children) != 4 || children[0] != loop.Target || children[1] != loop.Iter || children[2] != loop.Body[0] || children[3] != *loop.Test {
+		t.Fatal("unexpected children", children)
+	}
+	call := loop.Body[0].(*Output).Nodes[0].(*Call)
+	children = Children(call)
+	if len(children) != 5 || children[3] != &call.Kwargs[0] || children[4] != *call.DynArgs {
+		t.Fatal("unexpected children", children)
+	}
+
+	block := &CallBlock{Call: Call{Node: name("m", "load")}, MacroCall: MacroCall{Args: []Name{{Name: "a"}}}}
+	children = Children(block)
+	if len(children) != 2 || children[0] != &block.Call || children[1] != &block.Args[0] {
+		t.Fatal("unexpected children", children)
+	}
+	if len(Children(&Const{Value: 1})) != 0 {
+		t.Fatal("constants have no children")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	template := testTemplate()
+	if res := names(template); res != "x,items,f,x,y,z,a,x,x" {
+		t.Fatal("unexpected names", res)
+	}
+
+	depth, maxDepth := 0, 0
+	Inspect(template, func(n Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		return true
+	})
+	if depth != 0 || maxDepth != 6 {
+		t.Fatal("unexpected depths", depth, maxDepth)
+	}
+}
+
+func TestTypeVisitor(t *testing.T) {
+	var visited []string
+	v := &TypeVisitor{}
+	On(v, func(n *Name) bool {
+		visited = append(visited, n.Name)
+		return true
+	})
+	On(v, func(c *Call) bool {
+		visited = append(visited, "call")
+		return false
+	})
+	Walk(v, testTemplate())
+	if res := strings.Join(visited, ","); res != "x,items,call,x,x" {
+		t.Fatal("unexpected visited nodes", res)
+	}
+}
+
+func TestFind(t *testing.T) {
+	template := testTemplate()
+	var loaded []string
+	for _, n := range FindAll[*Name](template) {
+		if n.Ctx == "load" {
+			loaded = append(loaded, n.Name)
+		}
+	}
+	if res := strings.Join(loaded, ","); res != "items,f,x,y,z,a,x,x" {
+		t.Fatal("unexpected names", res)
+	}
+
+	call, ok := Find[*Call](template)
+	if !ok || call.Node.(*Name).Name != "f" {
+		t.Fatal("expected the call", call)
+	}
+	if _, ok := Find[*Template](template); ok {
+		t.Fatal("the node itself must not be found")
+	}
+	if keywords := FindAll[*Keyword](template); len(keywords) != 1 || keywords[0].Key != "k" {
+		t.Fatal("unexpected keywords", keywords)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	template := testTemplate()
+	err := TransformChildren(TransformFunc(func(n Node) ([]Node, error) {
+		switch n := n.(type) {
+		case *Name:
+			if n.Name == "y" {
+				return []Node{&Const{Value: 1}}, nil
+			}
+			if n.Name == "a" || (n.Name == "x" && n.Ctx == "load") {
+				return nil, nil
+			}
+		case *Keyword:
+			return []Node{&Keyword{Key: "w", Value: n.Value}}, nil
+		case *Output:
+			if len(n.Nodes) == 0 {
+				return []Node{&Output{}, &Output{}}, nil
+			}
+		}
+		return []Node{n}, nil
+	}), template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loop := template.Body[0].(*For)
+	if loop.Test != nil {
+		t.Fatal("the test should be removed")
+	}
+	call := loop.Body[0].(*Output).Nodes[0].(*Call)
+	if len(call.Args) != 1 || !reflect.DeepEqual(call.Args[0], &Const{Value: 1}) {
+		t.Fatal("unexpected args", call.Args)
+	}
+	if len(call.Kwargs) != 1 || call.Kwargs[0].Key != "w" || call.DynArgs != nil {
+		t.Fatal("unexpected call", call)
+	}
+	if len(template.Body) != 3 {
+		t.Fatal("the emptied output should be replaced by two outputs", template.Body)
+	}
+
+	for _, res := range [][]Node{nil, {&Const{}, &Const{}}, {&Output{}}} {
+		res := res
+		err = TransformChildren(TransformFunc(func(n Node) ([]Node, error) {
+			if n, ok := n.(*Name); ok && n.Name == "f" {
+				return res, nil
+			}
+			return []Node{n}, nil
+		}), testTemplate())
+		if err == nil {
+			t.Fatal("expected an error replacing the called function by", res)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package operator
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ICall is implemented by values that can be called from templates with
+// keyword arguments.
+type ICall interface {
+	Call(args []any, kwargs map[string]any) (any, error)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Call calls fn with the given arguments. Go functions can't take keyword
+// arguments, they can be called with positional arguments only. Their
+// results are converted: no result gives nil, a trailing error is returned
+// as the error.
+func Call(fn any, args []any, kwargs map[string]any) (any, error) {
+	if c, ok := fn.(ICall); ok {
+		return c.Call(args, kwargs)
+	}
+
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return nil, fmt.Errorf("%T object is not callable", fn)
+	}
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%T doesn't take keyword arguments", fn)
+	}
+
+	fnType := value.Type()
+	in, err := callArgs(fnType, args)
+	if err != nil {
+		return nil, err
+	}
+	out := value.Call(in)
+
+	if n := fnType.NumOut(); n > 0 && fnType.Out(n-1) == errorType {
+		if errV := out[n-1]; !errV.IsNil() {
+			return nil, errV.Interface().(error)
+		}
+		out = out[:n-1]
+	}
+	switch len(out) {
+	case 0:
+		return nil, nil
+	case 1:
+		return out[0].Interface(), nil
+	default:
+		ret := make([]any, 0, len(out))
+		for _, o := range out {
+			ret = append(ret, o.Interface())
+		}
+		return ret, nil
+	}
+}
+
+func callArgs(fnType reflect.Type, args []any) ([]reflect.Value, error) {
+	numIn := fnType.NumIn()
+	if fnType.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, fmt.Errorf("expected at least %d arguments, got %d", numIn-1, len(args))
+		}
+	} else if len(args) != numIn {
+		return nil, fmt.Errorf("expected %d arguments, got %d", numIn, len(args))
+	}
+
+	in := make([]reflect.Value, 0, len(args))
+	for i, arg := range args {
+		var argType reflect.Type
+		if fnType.IsVariadic() && i >= numIn-1 {
+			argType = fnType.In(numIn - 1).Elem()
+		} else {
+			argType = fnType.In(i)
+		}
+
+		if arg == nil {
+			switch argType.Kind() {
+			case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+				in = append(in, reflect.Zero(argType))
+				continue
+			}
+			return nil, fmt.Errorf("argument %d can't be None", i+1)
+		}
+		v := reflect.ValueOf(arg)
+		if v.Type().AssignableTo(argType) {
+			in = append(in, v)
+		} else if v.Type().ConvertibleTo(argType) && v.Kind() != reflect.String && argType.Kind() != reflect.String {
+			// numbers coming from templates are int64 and float64
+			in = append(in, v.Convert(argType))
+		} else {
+			return nil, fmt.Errorf("argument %d: can't use %T as %s", i+1, arg, argType)
+		}
+	}
+	return in, nil
+}
@@ -0,0 +1,49 @@
+package operator
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type callCase struct {
+	fn     any
+	args   []any
+	kwargs map[string]any
+	res    any
+	err    bool
+}
+
+type kwargsCallable struct{}
+
+func (kwargsCallable) Call(args []any, kwargs map[string]any) (any, error) {
+	return []any{len(args), kwargs["x"]}, nil
+}
+
+func TestCall(t *testing.T) {
+	cases := []callCase{
+		{func() {}, nil, nil, nil, false},
+		{func(a, b int) int { return a + b }, []any{int64(1), int64(2)}, nil, 3, false},
+		{func(a float64) float64 { return a * 2 }, []any{int64(2)}, nil, 4.0, false},
+		{func(s string, rest ...int) int { return len(s) + len(rest) }, []any{"ab", 1, 2}, nil, 4, false},
+		{func(p *int) bool { return p == nil }, []any{nil}, nil, true, false},
+		{func() (int, error) { return 1, nil }, nil, nil, 1, false},
+		{func() (int, error) { return 0, fmt.Errorf("fail") }, nil, nil, nil, true},
+		{func() (int, string) { return 1, "a" }, nil, nil, []any{1, "a"}, false},
+		{func(a int) int { return a }, nil, nil, nil, true},
+		{func(a int) int { return a }, []any{"a"}, nil, nil, true},
+		{func(a string) string { return a }, []any{65}, nil, nil, true},
+		{func(a int) int { return a }, []any{1}, map[string]any{"b": 1}, nil, true},
+		{kwargsCallable{}, []any{1}, map[string]any{"x": 2}, []any{1, 2}, false},
+		{42, nil, nil, nil, true},
+	}
+	for i, c := range cases {
+		res, err := Call(c.fn, c.args, c.kwargs)
+		if (err != nil) != c.err {
+			t.Fatal("case", i, "unexpected error state:", err)
+		}
+		if !reflect.DeepEqual(res, c.res) {
+			t.Fatal("case", i, "expected", c.res, "got", res)
+		}
+	}
+}
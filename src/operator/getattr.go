@@ -1,10 +1,38 @@
 package operator
 
 import (
+	stderrors "errors"
 	"fmt"
+	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/utils"
 	"reflect"
 )
 
+// ErrNotFound is matched (with errors.Is) by the errors of lookups of
+// attributes and items that don't exist. Environments turn these lookups
+// into undefined values, other errors are passed through.
+var ErrNotFound = stderrors.New("not found")
+
+// lookupError is the error of a lookup of a missing attribute or item.
+type lookupError struct {
+	msg string
+}
+
+func (e *lookupError) Error() string {
+	return e.msg
+}
+
+func (e *lookupError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// NotFound returns an error for a missing attribute or item, matching
+// ErrNotFound. Implementations of IGetAttribute, IGetAttr and IGetItem
+// return it when they don't have what was asked for.
+func NotFound(format string, args ...any) error {
+	return &lookupError{fmt.Sprintf(format, args...)}
+}
+
 type IGetAttribute interface {
 	GetAttribute(name string) (any, error)
 }
@@ -13,19 +41,71 @@ type IGetAttr interface {
 	GetAttr(name string) (any, error)
 }
 
-func GetAttr(v any, name string) (any, error) {
+type ISetAttr interface {
+	SetAttr(name string, value any) error
+}
+
+// AttributePolicy decides which attributes can be accessed, it's the
+// attribute part of the sandbox policies of the environments.
+type AttributePolicy interface {
+	// IsSafeAttribute tells if attr of obj, whose value is value, can be accessed.
+	IsSafeAttribute(obj any, attr string, value any) bool
+}
+
+// GetAttr returns the attribute name of v. Exported struct fields and
+// methods (as bound method values) are attributes, types can provide their
+// own attributes with IGetAttribute (consulted first) and IGetAttr
+// (consulted last). Accessing an attribute policy rejects is a security
+// error, a nil policy allows every attribute.
+func GetAttr(v any, name string, policy AttributePolicy) (any, error) {
+	value, err := getAttr(v, name)
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil && !policy.IsSafeAttribute(v, name, value) {
+		return nil, errors.TemplateSecurityError(fmt.Sprintf("access to attribute '%s' of '%s' is unsafe.", name, utils.ObjectTypeRepr(v)))
+	}
+	return value, nil
+}
+
+func getAttr(v any, name string) (any, error) {
 	if gA, ok := v.(IGetAttribute); ok {
 		return gA.GetAttribute(name)
 	}
 	value := reflect.ValueOf(v)
-	if value.Kind() == reflect.Struct {
-		res := value.FieldByName(name)
-		if res.Kind() != reflect.Invalid {
-			return res.Interface(), nil
+	if value.Kind() == reflect.Pointer && !value.IsNil() && value.Elem().Kind() == reflect.Struct {
+		if res, ok := exportedField(value.Elem(), name); ok {
+			return res, nil
+		}
+	} else if value.Kind() == reflect.Struct {
+		if res, ok := exportedField(value, name); ok {
+			return res, nil
+		}
+	}
+	if value.IsValid() {
+		if method := value.MethodByName(name); method.IsValid() {
+			return method.Interface(), nil
 		}
 	}
 	if gA, ok := v.(IGetAttr); ok {
 		return gA.GetAttr(name)
 	}
-	return nil, fmt.Errorf("can't get attribute %s of element", name)
+	return nil, NotFound("can't get attribute %s of element", name)
+}
+
+func exportedField(value reflect.Value, name string) (any, bool) {
+	field, ok := value.Type().FieldByName(name)
+	if !ok || !field.IsExported() {
+		return nil, false
+	}
+	return value.FieldByIndex(field.Index).Interface(), true
+}
+
+// SetAttr sets the attribute name of v, only values implementing ISetAttr
+// support it.
+func SetAttr(v any, name string, value any) error {
+	if sA, ok := v.(ISetAttr); ok {
+		return sA.SetAttr(name, value)
+	}
+	return fmt.Errorf("can't set attribute %s of element", name)
 }
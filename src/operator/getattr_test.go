@@ -1,8 +1,11 @@
 package operator
 
 import (
+	stderrors "errors"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/gojinja/gojinja/src/errors"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -30,6 +33,15 @@ func (g getAttributeStruct) GetAttribute(name string) (any, error) {
 
 var _ IGetAttribute = getAttributeStruct{}
 
+type methodStruct struct {
+	Foo    string
+	hidden string
+}
+
+func (m *methodStruct) Upper() string {
+	return strings.ToUpper(m.Foo)
+}
+
 type getAttrCase struct {
 	s    any
 	name string
@@ -46,15 +58,28 @@ func TestGetAttr(t *testing.T) {
 		{getAttributeStruct{"bar"}, "Foo", "Foo", false},
 		{getAttributeStruct{"bar"}, "foo", "foo", false},
 		{0, "Foo", nil, true},
+		{nil, "Foo", nil, true},
+		{&cleanStruct{"bar"}, "Foo", "bar", false},
+		{methodStruct{"bar", "baz"}, "hidden", nil, true},
+		{&methodStruct{"bar", "baz"}, "hidden", nil, true},
+		{methodStruct{"bar", "baz"}, "Upper", nil, true},
 	}
 
 	for _, c := range cases {
 		runGetAttrCase(t, c)
 	}
+
+	upper, err := GetAttr(&methodStruct{Foo: "bar"}, "Upper", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := Call(upper, nil, nil); err != nil || res != "BAR" {
+		t.Fatal("expected the bound method, got", res, err)
+	}
 }
 
 func runGetAttrCase(t *testing.T, c getAttrCase) {
-	res, err := GetAttr(c.s, c.name)
+	res, err := GetAttr(c.s, c.name, nil)
 	if err != nil {
 		if c.err {
 			return
@@ -68,3 +93,27 @@ func runGetAttrCase(t *testing.T, c getAttrCase) {
 	}
 
 }
+
+// fooPolicy rejects the attributes named Foo.
+type fooPolicy struct{}
+
+func (fooPolicy) IsSafeAttribute(_ any, attr string, _ any) bool {
+	return attr != "Foo"
+}
+
+func TestGetAttrPolicy(t *testing.T) {
+	var sErr *errors.SecurityError
+	for _, v := range []any{cleanStruct{"bar"}, getAttributeStruct{"bar"}, getAttrStruct{"bar"}} {
+		_, err := GetAttr(v, "Foo", fooPolicy{})
+		if !stderrors.As(err, &sErr) {
+			t.Fatal("expected a security error, got", err)
+		}
+	}
+	if v, err := GetAttr(getAttrStruct{"bar"}, "foo", fooPolicy{}); err != nil || v != "foo" {
+		t.Fatal("expected the attribute, got", v, err)
+	}
+	// missing attributes aren't checked
+	if _, err := GetAttr(cleanStruct{"bar"}, "Bar", fooPolicy{}); !stderrors.Is(err, ErrNotFound) {
+		t.Fatal("expected a missing attribute, got", err)
+	}
+}
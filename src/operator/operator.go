@@ -2,6 +2,7 @@ package operator
 
 import (
 	"fmt"
+	"github.com/gojinja/gojinja/src/errors"
 	"github.com/gojinja/gojinja/src/utils/numbers"
 	"golang.org/x/exp/slices"
 	"math"
@@ -114,6 +115,13 @@ type IGetItem interface {
 }
 
 func Mul(a any, b any) (any, error) {
+	return MulWithLimit(a, b, 0)
+}
+
+// MulWithLimit is Mul refusing to repeat strings and slices into values longer
+// than maxLen (in bytes for strings, in elements for slices). The limit is
+// ignored if it's not positive.
+func MulWithLimit(a any, b any, maxLen int) (any, error) {
 	if imul, ok := a.(IMul); ok {
 		return imul.Mul(b)
 	}
@@ -125,26 +133,45 @@ func Mul(a any, b any) (any, error) {
 			return multiplyNumeric(a, b), nil
 		}
 		if aI, ok := numbers.ToInt(a); ok {
-			switch reflect.TypeOf(b).Kind() {
-			case reflect.Slice, reflect.Array:
-				return mulSliceByInt(b, aI), nil
-			case reflect.String:
-				return mulStrByInt(b.(string), aI), nil
-			}
+			return repeat(b, aI, maxLen)
 		}
 	} else {
 		if bI, ok := numbers.ToInt(b); ok {
-			switch reflect.TypeOf(a).Kind() {
-			case reflect.Slice, reflect.Array:
-				return mulSliceByInt(a, bI), nil
-			case reflect.String:
-				return mulStrByInt(a.(string), bI), nil
-			}
+			return repeat(a, bI, maxLen)
 		}
 	}
 	return nil, fmt.Errorf("given elements can't be multipied")
 }
 
+func repeat(a any, n int64, maxLen int) (any, error) {
+	if n < 0 {
+		n = 0
+	}
+	switch reflect.TypeOf(a).Kind() {
+	case reflect.Slice, reflect.Array:
+		if err := checkRepeat(reflect.ValueOf(a).Len(), n, maxLen); err != nil {
+			return nil, err
+		}
+		return mulSliceByInt(a, n), nil
+	case reflect.String:
+		if err := checkRepeat(len(a.(string)), n, maxLen); err != nil {
+			return nil, err
+		}
+		return mulStrByInt(a.(string), n), nil
+	}
+	return nil, fmt.Errorf("given elements can't be multipied")
+}
+
+func checkRepeat(length int, n int64, maxLen int) error {
+	if maxLen > 0 && length > 0 && n > int64(maxLen/length) {
+		return errors.LimitExceeded("MaxRepetition", maxLen)
+	}
+	if length > 0 && n > int64(math.MaxInt/length) {
+		return fmt.Errorf("repeated value is too long")
+	}
+	return nil
+}
+
 func Add(a any, b any) (any, error) {
 	if iadd, ok := a.(IAdd); ok {
 		return iadd.Add(b)
@@ -347,19 +374,19 @@ func GetItem(a any, b any) (any, error) {
 	case reflect.Map:
 		ret := value.MapIndex(reflect.ValueOf(b))
 		if ret.Kind() == reflect.Invalid {
-			return nil, fmt.Errorf("unknown key")
+			return nil, NotFound("unknown key")
 		}
 		return ret.Interface(), nil
 	case reflect.Array, reflect.Slice, reflect.String:
 		if i, ok := numbers.ToInt(b); ok {
 			if value.Len() <= int(i) {
-				return nil, fmt.Errorf("index out of range")
+				return nil, NotFound("index out of range")
 			}
 			return value.Index(int(i)).Interface(), nil
 		}
-		return nil, fmt.Errorf("wrong type for index in getitem")
+		return nil, NotFound("wrong type for index in getitem")
 	default:
-		return nil, fmt.Errorf("can't get item")
+		return nil, NotFound("can't get item")
 	}
 }
 
@@ -484,16 +511,21 @@ func addSlices(a, b any) (any, bool) {
 }
 
 func mulStrByInt(a string, b int64) string {
-	res := ""
-	for i := int64(0); i < b; i++ {
-		res += a
+	if b <= 0 {
+		return ""
 	}
-	return res
+	return strings.Repeat(a, int(b))
 }
 
 func mulSliceByInt(a any, b int64) interface{} {
-	t, v := reflect.TypeOf(a), reflect.ValueOf(a)
-	c := reflect.MakeSlice(t, v.Len()*int(b), v.Len()*int(b))
+	if b < 0 {
+		b = 0
+	}
+	v := reflect.ValueOf(a)
+	if v.Len() == 0 {
+		b = 0
+	}
+	c := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), v.Len()*int(b), v.Len()*int(b))
 	for i := 0; i < int(b); i++ {
 		reflect.Copy(c.Slice(i*v.Len(), (i+1)*v.Len()), v)
 	}
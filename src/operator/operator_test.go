@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/gojinja/gojinja/src/utils/numbers"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -101,6 +102,25 @@ func TestMul(t *testing.T) {
 		{3, iMul{}, nil, true},
 		{[]string{"foo"}, []int{3}, nil, true},
 		{"foo", "bar", nil, true},
+		{"aa", -2, "", false},
+		{[2]int{1, 2}, 2, []int{1, 2, 1, 2}, false},
+		{"aa", math.MaxInt64, nil, true},
+		{math.MaxInt64, []any{1, 2}, nil, true},
+		{[]any{}, math.MaxInt64, []any{}, false},
+	})
+}
+
+func TestMulWithLimit(t *testing.T) {
+	mul := func(a any, b any) (any, error) {
+		return MulWithLimit(a, b, 6)
+	}
+	runBinTestCases(t, mul, []binCase{
+		{"aa", 3, "aaaaaa", false},
+		{"aa", 4, nil, true},
+		{1 << 40, "a", nil, true},
+		{[]int{1, 2, 3}, 3, nil, true},
+		{"", 1 << 40, "", false},
+		{1000, 1000, int64(1000000), false},
 	})
 }
 
@@ -0,0 +1,487 @@
+// Package optimizer evaluates the constant parts of templates at compile
+// time, like Jinja's optimizer.
+package optimizer
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/filters"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/operator"
+	"strconv"
+	"strings"
+)
+
+// Environment is what the optimizer needs from the environment, it's
+// implemented by environment.Environment.
+type Environment interface {
+	CallBinop(op string, a any, b any) (any, error)
+	CallUnop(op string, a any) (any, error)
+	// ConstFilter returns the filter name if it can be evaluated at compile
+	// time in the given context, its result must only depend on its
+	// arguments.
+	ConstFilter(name string, ctx EvalContext) (filters.Filter, bool)
+}
+
+// EvalContext is the evaluation context of the nodes, like Jinja's
+// EvalContext. It changes in `{% autoescape %}` blocks.
+type EvalContext struct {
+	Autoescape bool
+	// Volatile is set when the context is only known at render time, like in
+	// an autoescape block with a variable. Filters aren't evaluated then.
+	Volatile bool
+}
+
+// Optimizer is a nodes.Transformer replacing the constant expressions by
+// Const nodes, merging the adjacent template data of outputs and removing
+// the branches of ifs that can't be taken.
+type Optimizer struct {
+	env Environment
+	ctx EvalContext
+	// Constants are the lists, tuples and dicts made of constants, by node.
+	// They can't be replaced by a Const as they create a new value every
+	// time they are evaluated, but their value is known.
+	Constants map[nodes.Expr]any
+}
+
+var _ nodes.Transformer = &Optimizer{}
+
+func New(env Environment, ctx EvalContext) *Optimizer {
+	return &Optimizer{env: env, ctx: ctx, Constants: make(map[nodes.Expr]any)}
+}
+
+// Optimize optimizes the descendants of node in place.
+func (o *Optimizer) Optimize(node nodes.Node) error {
+	return nodes.TransformChildren(o, node)
+}
+
+func (o *Optimizer) Transform(node nodes.Node) ([]nodes.Node, error) {
+	switch n := node.(type) {
+	case *nodes.If:
+		return o.transformIf(n)
+	case *nodes.ScopedEvalContextModifier:
+		if err := nodes.TransformChildren(o, &n.EvalContextModifier); err != nil {
+			return nil, err
+		}
+		saved := o.ctx
+		defer func() {
+			o.ctx = saved
+		}()
+		o.modify(n.Options)
+		body, err := o.transformBody(n.Body)
+		if err != nil {
+			return nil, err
+		}
+		n.Body = body
+		return []nodes.Node{n}, nil
+	}
+
+	if err := nodes.TransformChildren(o, node); err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case *nodes.EvalContextModifier:
+		o.modify(n.Options)
+	case *nodes.Output:
+		n.Nodes = mergeTemplateData(n.Nodes)
+	case *nodes.CondExpr:
+		if test, ok := n.Test.(*nodes.Const); ok {
+			if truthy(test.Value) {
+				return []nodes.Node{n.Expr1}, nil
+			} else if n.Expr2 != nil {
+				return []nodes.Node{*n.Expr2}, nil
+			}
+		}
+	case nodes.Expr:
+		if v, ok := o.AsConst(n); ok {
+			if _, literal := n.(*nodes.Const); literal {
+				return []nodes.Node{n}, nil
+			}
+			if !hasSafeRepr(v, false) {
+				o.Constants[n] = v
+				return []nodes.Node{n}, nil
+			}
+			return []nodes.Node{&nodes.Const{
+				Value:         v,
+				LiteralCommon: nodes.LiteralCommon{Lineno: n.GetLineno(), Span: n.GetSpan()},
+			}}, nil
+		}
+	}
+	return []nodes.Node{node}, nil
+}
+
+// transformBody transforms a list of statements.
+func (o *Optimizer) transformBody(body []nodes.Node) ([]nodes.Node, error) {
+	scope := &nodes.Scope{Body: body}
+	err := nodes.TransformChildren(o, scope)
+	return scope.Body, err
+}
+
+// modify applies the options of an eval context modifier, the context is
+// volatile if their values aren't constant.
+func (o *Optimizer) modify(options []nodes.Keyword) {
+	for _, option := range options {
+		c, ok := option.Value.(*nodes.Const)
+		if !ok {
+			o.ctx.Volatile = true
+			continue
+		}
+		switch option.Key {
+		case "autoescape":
+			o.ctx.Autoescape = truthy(c.Value)
+		case "volatile":
+			o.ctx.Volatile = truthy(c.Value)
+		}
+	}
+}
+
+// transformIf removes the branches whose test is constant, an if is
+// replaced by the body of its first branch with a true test. Ifs containing
+// blocks are kept, so `super()` still finds the blocks.
+func (o *Optimizer) transformIf(n *nodes.If) ([]nodes.Node, error) {
+	elifs, els := n.Elif, n.Else
+	n.Elif, n.Else = nil, nil
+	if err := nodes.TransformChildren(o, n); err != nil {
+		return nil, err
+	}
+	for i := range elifs {
+		if err := nodes.TransformChildren(o, &elifs[i]); err != nil {
+			return nil, err
+		}
+	}
+	els, err := o.transformBody(els)
+	if err != nil {
+		return nil, err
+	}
+	n.Elif, n.Else = elifs, els
+	if _, ok := nodes.Find[*nodes.Block](n); ok {
+		return []nodes.Node{n}, nil
+	}
+
+	branches := append([]nodes.If{*n}, n.Elif...)
+	var kept []nodes.If
+	for _, branch := range branches {
+		test, ok := branch.Test.(*nodes.Const)
+		if !ok {
+			kept = append(kept, branch)
+			continue
+		}
+		if !truthy(test.Value) {
+			continue
+		}
+		if len(kept) == 0 {
+			return branch.Body, nil
+		}
+		// the following branches can't be taken
+		n.Else = branch.Body
+		break
+	}
+	if len(kept) == 0 {
+		return n.Else, nil
+	}
+	n.Test, n.Body, n.Elif = kept[0].Test, kept[0].Body, kept[1:]
+	return []nodes.Node{n}, nil
+}
+
+// mergeTemplateData merges the adjacent TemplateData nodes.
+func mergeTemplateData(exprs []nodes.Expr) []nodes.Expr {
+	var ret []nodes.Expr
+	for _, expr := range exprs {
+		data, ok := expr.(*nodes.TemplateData)
+		if ok && len(ret) > 0 {
+			if prev, ok := ret[len(ret)-1].(*nodes.TemplateData); ok {
+				span := prev.Span
+				span.End = data.Span.End
+				ret[len(ret)-1] = &nodes.TemplateData{
+					Data:          prev.Data + data.Data,
+					LiteralCommon: nodes.LiteralCommon{Lineno: prev.Lineno, Span: span},
+				}
+				continue
+			}
+		}
+		ret = append(ret, expr)
+	}
+	return ret
+}
+
+// AsConst returns the value of an expression if it can be evaluated at
+// compile time, like the `as_const` method of Jinja's nodes. The children
+// of node must be optimized already.
+func (o *Optimizer) AsConst(node nodes.Expr) (v any, ok bool) {
+	defer func() {
+		// the operators and the filters may panic with unexpected values, the
+		// expression is evaluated at render time then
+		if recover() != nil {
+			v, ok = nil, false
+		}
+	}()
+	return o.asConst(node)
+}
+
+func (o *Optimizer) asConst(node nodes.Expr) (any, bool) {
+	switch n := node.(type) {
+	case *nodes.Const:
+		return n.Value, true
+	case *nodes.List, *nodes.Tuple, *nodes.Dict:
+		v, ok := o.Constants[n]
+		if ok {
+			return v, true
+		}
+		return o.literal(n)
+	case *nodes.BinExpr:
+		left, ok := o.asConst(n.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := o.asConst(n.Right)
+		if !ok {
+			return nil, false
+		}
+		switch n.Op {
+		case "and":
+			if !truthy(left) {
+				return left, true
+			}
+			return right, true
+		case "or":
+			if truthy(left) {
+				return left, true
+			}
+			return right, true
+		}
+		return check(o.env.CallBinop(n.Op, left, right))
+	case *nodes.UnaryExpr:
+		v, ok := o.asConst(n.Node)
+		if !ok {
+			return nil, false
+		}
+		return check(o.env.CallUnop(n.Op, v))
+	case *nodes.Compare:
+		return o.compare(n)
+	case *nodes.Concat:
+		var builder strings.Builder
+		for _, expr := range n.Nodes {
+			v, ok := o.asConst(expr)
+			if !ok {
+				return nil, false
+			}
+			s, ok := str(v)
+			if !ok {
+				return nil, false
+			}
+			builder.WriteString(s)
+		}
+		return builder.String(), true
+	case *nodes.CondExpr:
+		test, ok := o.asConst(n.Test)
+		if !ok {
+			return nil, false
+		}
+		if truthy(test) {
+			return o.asConst(n.Expr1)
+		}
+		if n.Expr2 == nil {
+			return nil, false
+		}
+		return o.asConst(*n.Expr2)
+	case *nodes.Filter:
+		return o.filter(n)
+	}
+	return nil, false
+}
+
+func (o *Optimizer) literal(node nodes.Expr) (any, bool) {
+	switch n := node.(type) {
+	case *nodes.List:
+		return o.items(n.Items)
+	case *nodes.Tuple:
+		return o.items(n.Items)
+	case *nodes.Dict:
+		ret := make(map[any]any, len(n.Items))
+		for _, pair := range n.Items {
+			key, ok := o.asConst(pair.Key)
+			if !ok || !hasSafeRepr(key, true) {
+				return nil, false
+			}
+			value, ok := o.asConst(pair.Value)
+			if !ok {
+				return nil, false
+			}
+			ret[key] = value
+		}
+		return ret, true
+	}
+	return nil, false
+}
+
+func (o *Optimizer) items(exprs []nodes.Expr) (any, bool) {
+	ret := make([]any, 0, len(exprs))
+	for _, expr := range exprs {
+		v, ok := o.asConst(expr)
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, v)
+	}
+	return ret, true
+}
+
+// compareOps are the comparison operators, `in` and `notin` are handled by
+// compare.
+var compareOps = map[string]func(a any, b any) (any, error){
+	lexer.TokenEq:   operator.Eq,
+	lexer.TokenNe:   operator.Ne,
+	lexer.TokenLt:   operator.Lt,
+	lexer.TokenLteq: operator.Le,
+	lexer.TokenGt:   operator.Gt,
+	lexer.TokenGteq: operator.Ge,
+}
+
+// compare evaluates chained comparisons like Python, `a < b < c` is
+// `a < b and b < c`.
+func (o *Optimizer) compare(n *nodes.Compare) (any, bool) {
+	value, ok := o.asConst(n.Expr)
+	if !ok {
+		return nil, false
+	}
+	var result any = true
+	for _, operand := range n.Ops {
+		expr, ok := operand.Expr.(nodes.Expr)
+		if !ok {
+			return nil, false
+		}
+		next, ok := o.asConst(expr)
+		if !ok {
+			return nil, false
+		}
+		var err error
+		switch operand.Op {
+		case "in", "notin":
+			var contains bool
+			contains, err = operator.Contains(next, value)
+			result = contains == (operand.Op == "in")
+		default:
+			op, ok := compareOps[operand.Op]
+			if !ok {
+				return nil, false
+			}
+			result, err = op(value, next)
+		}
+		if err != nil {
+			return nil, false
+		}
+		if !truthy(result) {
+			return false, true
+		}
+		value = next
+	}
+	return result, true
+}
+
+func (o *Optimizer) filter(n *nodes.Filter) (any, bool) {
+	if o.ctx.Volatile || n.Node == nil || n.DynArgs != nil || n.DynKwargs != nil {
+		return nil, false
+	}
+	fn, ok := o.env.ConstFilter(n.Name, o.ctx)
+	if !ok {
+		return nil, false
+	}
+	v, ok := o.asConst(*n.Node)
+	if !ok {
+		return nil, false
+	}
+	args := []any{v}
+	for _, arg := range n.Args {
+		v, ok := o.asConst(arg)
+		if !ok {
+			return nil, false
+		}
+		args = append(args, v)
+	}
+	kwargs := make(map[string]any, len(n.Kwargs))
+	for _, kwarg := range n.Kwargs {
+		v, ok := o.asConst(kwarg.Value)
+		if !ok {
+			return nil, false
+		}
+		kwargs[kwarg.Key] = v
+	}
+	return fn(args, kwargs), true
+}
+
+func check(v any, err error) (any, bool) {
+	return v, err == nil
+}
+
+// truthy is operator.Bool, nil and the empty lists and dicts are false.
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case []any:
+		return len(v) > 0
+	case map[any]any:
+		return len(v) > 0
+	}
+	b, err := operator.Bool(v)
+	return err == nil && b
+}
+
+// str converts the values to strings like Python's `str` for the types it
+// formats the same way.
+func str(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case bool:
+		if v {
+			return "True", true
+		}
+		return "False", true
+	case nil:
+		return "None", true
+	}
+	return "", false
+}
+
+// hasSafeRepr tells if v can be stored in a Const, like Jinja's
+// `has_safe_repr`: the scalars of the template language, and the lists and
+// dicts of them if containers is set.
+func hasSafeRepr(v any, containers bool) bool {
+	switch v := v.(type) {
+	case nil, bool, int64, float64, string:
+		return true
+	case []any:
+		if !containers {
+			return false
+		}
+		for _, item := range v {
+			if !hasSafeRepr(item, true) {
+				return false
+			}
+		}
+		return true
+	case map[any]any:
+		if !containers {
+			return false
+		}
+		for key, value := range v {
+			if !hasSafeRepr(key, false) || !hasSafeRepr(value, true) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Optimize optimizes the descendants of node in the evaluation context ctx,
+// see Optimizer.
+func Optimize(env Environment, node nodes.Node, ctx EvalContext) error {
+	if err := New(env, ctx).Optimize(node); err != nil {
+		return fmt.Errorf("can't optimize the template: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package optimizer
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/filters"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/nodes"
+	"github.com/gojinja/gojinja/src/operator"
+	"github.com/gojinja/gojinja/src/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testEnv has the default operators and a pure `upper` filter.
+type testEnv struct{}
+
+var binops = map[string]func(a any, b any) (any, error){
+	lexer.TokenAdd: operator.Add,
+	lexer.TokenSub: operator.Sub,
+	lexer.TokenMul: operator.Mul,
+	lexer.TokenDiv: operator.Div,
+}
+
+func (testEnv) CallBinop(op string, a any, b any) (any, error) {
+	fn, ok := binops[op]
+	if !ok {
+		return nil, fmt.Errorf("unknown binary operator '%s'", op)
+	}
+	return fn(a, b)
+}
+
+func (testEnv) CallUnop(op string, a any) (any, error) {
+	switch op {
+	case lexer.TokenSub:
+		return operator.Neg(a)
+	case "not":
+		return operator.Not(a)
+	}
+	return nil, fmt.Errorf("unknown unary operator '%s'", op)
+}
+
+func (testEnv) ConstFilter(name string, ctx EvalContext) (filters.Filter, bool) {
+	if name != "upper" {
+		return nil, false
+	}
+	return func(args []any, kwargs map[string]any) any {
+		return strings.ToUpper(args[0].(string))
+	}, true
+}
+
+func optimize(t *testing.T, source string) *nodes.Template {
+	stream, err := lexer.GetLexer(lexer.DefaultEnvLexerInformation()).Tokenize(source, nil, nil, nil)
+	if err != nil {
+		t.Fatal(source, err)
+	}
+	template, err := parser.NewParser(stream, nil, nil, nil, nil).Parse()
+	if err != nil {
+		t.Fatal(source, err)
+	}
+	if err = Optimize(testEnv{}, template, EvalContext{}); err != nil {
+		t.Fatal(source, err)
+	}
+	return template
+}
+
+// output returns the expression of a template made of a single output.
+func output(t *testing.T, source string) nodes.Expr {
+	template := optimize(t, source)
+	if len(template.Body) != 1 {
+		t.Fatal(source, "expected a single node", template.Body)
+	}
+	out, ok := template.Body[0].(*nodes.Output)
+	if !ok || len(out.Nodes) != 1 {
+		t.Fatal(source, "expected an output of a single node", template.Body[0])
+	}
+	return out.Nodes[0]
+}
+
+var foldCases = map[string]any{
+	`{{ 1 + 2 * 3 }}`:                 7,
+	`{{ -(1 - 3) }}`:                  2,
+	`{{ "a" ~ 1 ~ true ~ none }}`:     "a1TrueNone",
+	`{{ 1 < 2 < 3 }}`:                 true,
+	`{{ 1 < 3 < 2 }}`:                 false,
+	`{{ 3 in [1, 2] }}`:               false,
+	`{{ "b" not in "abc" }}`:          false,
+	`{{ 0 or "x" }}`:                  "x",
+	`{{ not 1 and 2 }}`:               false,
+	`{{ "a" if 1 > 2 else "b" }}`:     "b",
+	`{{ "abc"|upper }}`:               "ABC",
+	`{{ ("a" ~ "b")|upper ~ "c" }}`:   "ABc",
+	`{{ [1, 2][0] if false else 3 }}`: 3,
+}
+
+func TestFold(t *testing.T) {
+	for source, expected := range foldCases {
+		c, ok := output(t, source).(*nodes.Const)
+		if !ok {
+			t.Fatal(source, "expected a constant, got", output(t, source))
+		}
+		if i, ok := expected.(int); ok {
+			expected = int64(i)
+		}
+		if !reflect.DeepEqual(c.Value, expected) {
+			t.Fatalf("%s: expected %#v, got %#v", source, expected, c.Value)
+		}
+	}
+}
+
+var notFoldedCases = []string{
+	`{{ x + 1 }}`,
+	`{{ 1 / 0 }}`,
+	`{{ 1 ** 2 }}`,
+	`{{ "a" ~ 1.5 }}`,
+	`{{ "abc"|lower }}`,
+	`{{ "abc"|upper(*x) }}`,
+	`{{ 1 < x < 2 }}`,
+	`{{ x if false }}`,
+	`{{ [1, 2] }}`,
+}
+
+func TestNotFolded(t *testing.T) {
+	for _, source := range notFoldedCases {
+		if c, ok := output(t, source).(*nodes.Const); ok {
+			t.Fatal(source, "shouldn't be folded, got", c.Value)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	template := optimize(t, `{{ [1, (2, "a" ~ "b")] }}`)
+	o := New(testEnv{}, EvalContext{})
+	if err := o.Optimize(template); err != nil {
+		t.Fatal(err)
+	}
+	list := template.Body[0].(*nodes.Output).Nodes[0]
+	expected := []any{int64(1), []any{int64(2), "ab"}}
+	if v, ok := o.Constants[list]; !ok || !reflect.DeepEqual(v, expected) {
+		t.Fatal("unexpected constant", v)
+	}
+}
+
+func TestCondExpr(t *testing.T) {
+	if name, ok := output(t, `{{ x if 1 else y }}`).(*nodes.Name); !ok || name.Name != "x" {
+		t.Fatal("expected x, got", name)
+	}
+	if name, ok := output(t, `{{ x if 0 else y }}`).(*nodes.Name); !ok || name.Name != "y" {
+		t.Fatal("expected y, got", name)
+	}
+}
+
+func TestMergeTemplateData(t *testing.T) {
+	data, ok := output(t, `a{# comment #}b{% raw %}c{% endraw %}`).(*nodes.TemplateData)
+	if !ok || data.Data != "abc" {
+		t.Fatal("expected the merged data, got", data)
+	}
+}
+
+// data returns the template data of the outputs of body.
+func data(body []nodes.Node) string {
+	var ret []string
+	for _, node := range body {
+		for _, data := range nodes.FindAll[*nodes.TemplateData](&nodes.Scope{Body: []nodes.Node{node}}) {
+			ret = append(ret, data.Data)
+		}
+	}
+	return strings.Join(ret, ",")
+}
+
+func TestIf(t *testing.T) {
+	cases := map[string]string{
+		`{% if 1 %}a{% else %}b{% endif %}`:                           "a",
+		`{% if 0 %}a{% else %}b{% endif %}`:                           "b",
+		`{% if 0 %}a{% endif %}`:                                      "",
+		`{% if 0 %}a{% elif 1 %}b{% else %}c{% endif %}`:              "b",
+		`{% if 0 %}a{% elif 0 %}b{% elif x %}c{% else %}d{% endif %}`: "c,d",
+		`{% if 1 > 2 %}{% block b %}a{% endblock %}{% endif %}`:       "a",
+	}
+	for source, expected := range cases {
+		if res := data(optimize(t, source).Body); res != expected {
+			t.Fatalf("%s: expected %q, got %q", source, expected, res)
+		}
+	}
+
+	body := optimize(t, `{% if x %}a{% elif 0 %}b{% elif y %}c{% elif 1 %}d{% else %}e{% endif %}`).Body
+	n, ok := body[0].(*nodes.If)
+	if !ok || len(body) != 1 {
+		t.Fatal("expected an if, got", body)
+	}
+	if len(n.Elif) != 1 || n.Elif[0].Test.(*nodes.Name).Name != "y" || data(n.Else) != "d" {
+		t.Fatal("unexpected branches", n.Elif, n.Else)
+	}
+
+	body = optimize(t, `{% if 1 > 2 %}{% block b %}a{% endblock %}{% endif %}`).Body
+	if n, ok := body[0].(*nodes.If); !ok || n.Test.(*nodes.Const).Value != false {
+		t.Fatal("ifs with blocks should be kept", body)
+	}
+}
+
+// scoped returns the first output expression of an autoescape block, which
+// is parsed like Jinja as a scope around the modifier.
+func scoped(node nodes.Node) nodes.Expr {
+	modifier := node.(*nodes.Scope).Body[0].(*nodes.ScopedEvalContextModifier)
+	return modifier.Body[0].(*nodes.Output).Nodes[0]
+}
+
+func TestEvalContext(t *testing.T) {
+	body := optimize(t, `{% autoescape x %}{{ "a"|upper }}{% endautoescape %}{{ "b"|upper }}`).Body
+	inner := scoped(body[0])
+	if _, ok := inner.(*nodes.Filter); !ok {
+		t.Fatal("filters shouldn't be called in volatile contexts", inner)
+	}
+	if c, ok := body[1].(*nodes.Output).Nodes[0].(*nodes.Const); !ok || c.Value != "B" {
+		t.Fatal("the context should be restored after the block", body[1])
+	}
+
+	body = optimize(t, `{% autoescape true %}{{ "a"|upper }}{% endautoescape %}`).Body
+	inner = scoped(body[0])
+	if c, ok := inner.(*nodes.Const); !ok || c.Value != "A" {
+		t.Fatal("filters should be called in constant contexts", inner)
+	}
+}
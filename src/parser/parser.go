@@ -28,6 +28,18 @@ var statementKeywords = set.FrozenFromElems(
 	"autoescape",
 )
 
+// blockStatements are the statements that have a body closed by an `end` tag.
+var blockStatements = set.FrozenFromElems(
+	"for",
+	"if",
+	"block",
+	"macro",
+	"call",
+	"filter",
+	"with",
+	"autoescape",
+)
+
 var compareOperators = set.FrozenFromElems(
 	"eq", "ne", "lt", "lteq", "gt", "gteq",
 )
@@ -41,6 +53,27 @@ func makeBinaryOpExpr(left, right nodes.Expr, op string, lineno int) nodes.Expr
 	}
 }
 
+// spanFrom sets the span of node from start to the end of the last consumed
+// token and returns the node.
+func spanFrom[T nodes.Node](p *parser, node T, start lexer.Position) T {
+	node.SetSpan(lexer.Span{Start: start, End: p.stream.Previous().Span.End})
+	return node
+}
+
+// fillSpan sets the span of a statement node returned by a statement parser,
+// unless the parser (for example an extension) already did it.
+func fillSpan(node nodes.Node, span lexer.Span) {
+	if node.GetSpan().IsZero() {
+		node.SetSpan(span)
+	}
+	// `{% autoescape %}` is wrapped into a scope, the modifier covers the same source.
+	if scope, ok := node.(*nodes.Scope); ok {
+		for _, n := range scope.Body {
+			fillSpan(n, span)
+		}
+	}
+}
+
 type extensionParser = func(p extensions.IParser) ([]nodes.Node, error)
 
 type parser struct {
@@ -51,6 +84,17 @@ type parser struct {
 	lastIdentifier        int
 	tagStack              *stack.Stack[string]
 	endTokenStack         *stack.Stack[[]string]
+	// loopDepth is the number of loops whose body is being parsed, macros
+	// and blocks reset it as their bodies are separate functions.
+	loopDepth int
+
+	// recovery is set by ParseWithRecovery, the parser then collects syntax
+	// errors instead of stopping at the first one.
+	recovery      bool
+	errors        []error
+	failedAtEOF   bool
+	bodiesEntered int
+	lastNeedle    any
 }
 
 var _ extensions.IParser = &parser{}
@@ -85,16 +129,162 @@ func (p *parser) Parse() (*nodes.Template, error) {
 
 	// TODO set environment
 	return &nodes.Template{
-		Body:       body,
-		NodeCommon: nodes.NodeCommon{Lineno: 1},
+		Body: body,
+		NodeCommon: nodes.NodeCommon{
+			Lineno: 1,
+			Span: lexer.Span{
+				Start: lexer.Position{Lineno: 1},
+				End:   p.stream.Current().Span.End,
+			},
+		},
 	}, nil
 }
 
+// Stream returns the token stream being parsed.
+func (p *parser) Stream() *lexer.TokenStream {
+	return p.stream
+}
+
+// ParseExpression parses an expression, conditional expressions are parsed
+// only if withCondexpr is set.
+func (p *parser) ParseExpression(withCondexpr bool) (nodes.Expr, error) {
+	return p.parseExpression(withCondexpr)
+}
+
+// ParseTuple parses expressions separated by commas, into a tuple if there's
+// more than one.
+func (p *parser) ParseTuple(simplified bool, withCondexpr bool, extraEndRules []string, explicitParentheses bool) (nodes.Expr, error) {
+	return p.parseTuple(simplified, withCondexpr, extraEndRules, explicitParentheses)
+}
+
+// ParseStatements parses the body of a block tag up to one of the end tokens.
+func (p *parser) ParseStatements(endTokens []string, dropNeedle bool) ([]nodes.Node, error) {
+	return p.parseStatements(endTokens, dropNeedle)
+}
+
+// FreeIdentifier returns a new name that can't collide with the names of the
+// template.
+func (p *parser) FreeIdentifier(lineno *int) *nodes.InternalName {
+	p.lastIdentifier++
+	line := p.stream.Current().Lineno
+	if lineno != nil {
+		line = *lineno
+	}
+	return &nodes.InternalName{
+		Name:       fmt.Sprintf("fi%d", p.lastIdentifier),
+		ExprCommon: nodes.ExprCommon{Lineno: line},
+	}
+}
+
+// Fail returns an error created by exc (a syntax error if it's nil) for the
+// given line, or for the current token if lineno is nil.
+func (p *parser) Fail(msg string, lineno *int, exc func(msg string, lineno int, name *string, filename *string) error) error {
+	return p.fail(msg, lineno, exc)
+}
+
+// InLoop tells if the statement being parsed is in the body of a for loop
+// (and not in a macro, a call block or a block inside of the loop).
+func (p *parser) InLoop() bool {
+	return p.loopDepth > 0
+}
+
+// withLoopDepth sets the loop depth for the statements parsed next and
+// returns a function restoring it.
+func (p *parser) withLoopDepth(depth int) func() {
+	saved := p.loopDepth
+	p.loopDepth = depth
+	return func() {
+		p.loopDepth = saved
+	}
+}
+
+// ParseWithRecovery parses the whole template like Parse, but doesn't stop
+// at the first syntax error. Errors are recorded, the parser resynchronises
+// at the end of the failing tag (or at the matching end tag if the header of
+// a block statement failed) and goes on. It returns the partial `Template`
+// node, built from everything that could be parsed, and all the errors found.
+func (p *parser) ParseWithRecovery() (*nodes.Template, []error) {
+	p.recovery = true
+	template, err := p.Parse()
+	if err != nil {
+		p.errors = append(p.errors, err)
+	}
+	return template, p.errors
+}
+
+// recover records err if the parser is in the recovery mode and reports
+// whether parsing can go on.
+func (p *parser) recover(err error) bool {
+	if !p.recovery {
+		return false
+	}
+	// an unclosed statement makes all enclosing ones fail on the end of
+	// the template as well, only the innermost one is worth reporting.
+	if p.stream.Eos() {
+		if p.failedAtEOF {
+			return true
+		}
+		p.failedAtEOF = true
+	}
+	p.errors = append(p.errors, err)
+	return true
+}
+
+// skipTag skips the rest of the current tag, including its end token.
+func (p *parser) skipTag() {
+	for !p.stream.Eos() {
+		switch p.stream.Current().Type {
+		case lexer.TokenBlockEnd, lexer.TokenVariableEnd:
+			p.stream.Next()
+			return
+		case lexer.TokenBlockBegin, lexer.TokenVariableBegin, lexer.TokenData:
+			return
+		}
+		p.stream.Next()
+	}
+}
+
+// resyncStatement moves the stream after the statement with the given tag
+// that just failed. If the failure happened before its body was closed, the
+// body is skipped too, as parsing it would only produce follow-up errors.
+func (p *parser) resyncStatement(tag any, bodiesEntered int) {
+	p.skipTag()
+	name, ok := tag.(string)
+	if !ok || !blockStatements.Has(name) {
+		return
+	}
+	if bodiesEntered != p.bodiesEntered && p.lastNeedle == "end"+name {
+		return
+	}
+
+	depth := 1
+	for !p.stream.Eos() {
+		if p.stream.Next().Type != lexer.TokenBlockBegin {
+			continue
+		}
+		switch p.stream.Current().Value {
+		case name:
+			depth++
+		case "end" + name:
+			depth--
+			if depth == 0 {
+				p.skipTag()
+				return
+			}
+		}
+	}
+}
+
 func (p *parser) subparse(endTokens []string) ([]nodes.Node, error) {
 	body := make([]nodes.Node, 0)
 	dataBuffer := make([]nodes.Expr, 0)
-	addData := func(node nodes.Expr) {
+	var dataSpan lexer.Span
+	addData := func(node nodes.Expr, start lexer.Position) {
+		if len(dataBuffer) == 0 {
+			dataSpan.Start = start
+		}
 		dataBuffer = append(dataBuffer, node)
+		dataSpan.End = p.stream.Previous().Span.End
 	}
 
 	if endTokens != nil {
@@ -107,7 +297,7 @@ func (p *parser) subparse(endTokens []string) ([]nodes.Node, error) {
 			lineno := dataBuffer[0].GetLineno()
 			body = append(body, &nodes.Output{
 				Nodes:      dataBuffer,
-				StmtCommon: nodes.StmtCommon{Lineno: lineno},
+				StmtCommon: nodes.StmtCommon{Lineno: lineno, Span: dataSpan},
 			})
 			dataBuffer = make([]nodes.Expr, 0)
 		}
@@ -117,23 +307,28 @@ func (p *parser) subparse(endTokens []string) ([]nodes.Node, error) {
 		token := p.stream.Current()
 		switch token.Type {
 		case lexer.TokenData:
+			p.stream.Next()
 			if token.Value != "" {
 				// type assert is safe, because token.Type == lexer.TokenData
 				addData(&nodes.TemplateData{
 					Data:          token.Value.(string),
-					LiteralCommon: nodes.LiteralCommon{Lineno: token.Lineno},
-				})
+					LiteralCommon: nodes.LiteralCommon{Lineno: token.Lineno, Span: token.Span},
+				}, token.Span.Start)
 			}
-			p.stream.Next()
 		case lexer.TokenVariableBegin:
 			p.stream.Next()
 			tuple, err := p.parseTuple(false, true, nil, false)
-			if err != nil {
-				return nil, err
+			if err == nil {
+				_, err = p.stream.Expect(lexer.TokenVariableEnd)
 			}
-			addData(tuple)
-			if _, err := p.stream.Expect(lexer.TokenVariableEnd); err != nil {
-				return nil, err
+			if err == nil {
+				addData(tuple, token.Span.Start)
+			}
+			if err != nil {
+				if !p.recover(err) {
+					return nil, err
+				}
+				p.skipTag()
 			}
 		case lexer.TokenBlockBegin:
 			flushData()
@@ -141,16 +336,29 @@ func (p *parser) subparse(endTokens []string) ([]nodes.Node, error) {
 			if endTokens != nil && p.stream.Current().TestAny(endTokens...) {
 				return body, nil
 			}
+			tag := p.stream.Current().Value
+			bodiesEntered := p.bodiesEntered
 			rvs, err := p.parseStatement()
+			if err == nil {
+				_, err = p.stream.Expect(lexer.TokenBlockEnd)
+				span := lexer.Span{Start: token.Span.Start, End: p.stream.Previous().Span.End}
+				for _, rv := range rvs {
+					fillSpan(rv, span)
+				}
+				body = append(body, rvs...)
+			}
 			if err != nil {
-				return nil, err
+				if !p.recover(err) {
+					return nil, err
+				}
+				p.resyncStatement(tag, bodiesEntered)
 			}
-			body = append(body, rvs...)
-			if _, err := p.stream.Expect(lexer.TokenBlockEnd); err != nil {
+		default:
+			err := p.fail("internal parsing error", nil, nil)
+			if !p.recover(err) {
 				return nil, err
 			}
-		default:
-			return nil, p.fail("internal parsing error", nil, nil)
+			p.stream.Next()
 		}
 	}
 
@@ -160,6 +368,7 @@ func (p *parser) subparse(endTokens []string) ([]nodes.Node, error) {
 
 func (p *parser) parseTuple(simplified bool, withCondexpr bool, extraEndRules []string, explicitParentheses bool) (nodes.Expr, error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	var parse func() (nodes.Expr, error)
 	if simplified {
 		parse = p.parsePrimary
@@ -208,15 +417,16 @@ func (p *parser) parseTuple(simplified bool, withCondexpr bool, extraEndRules []
 		}
 	}
 
-	return &nodes.Tuple{
+	return spanFrom[nodes.Expr](p, &nodes.Tuple{
 		Items:         args,
 		Ctx:           "load",
 		LiteralCommon: nodes.LiteralCommon{Lineno: lineno},
-	}, nil
+	}, start), nil
 }
 
 func (p *parser) parsePrimary() (nodes.Expr, error) {
 	token := p.stream.Current()
+	start := token.Span.Start
 	var node nodes.Expr
 
 	switch token.Type {
@@ -240,7 +450,7 @@ func (p *parser) parsePrimary() (nodes.Expr, error) {
 			}
 		}
 		p.stream.Next()
-		return node, nil
+		return spanFrom(p, node, start), nil
 	case lexer.TokenString:
 		p.stream.Next()
 		buf := []string{token.Value.(string)}
@@ -248,15 +458,15 @@ func (p *parser) parsePrimary() (nodes.Expr, error) {
 			buf = append(buf, p.stream.Current().Value.(string))
 			p.stream.Next()
 		}
-		return &nodes.Const{
+		return spanFrom[nodes.Expr](p, &nodes.Const{
 			Value:         strings.Join(buf, ""),
 			LiteralCommon: nodes.LiteralCommon{Lineno: token.Lineno},
-		}, nil
+		}, start), nil
 	case lexer.TokenInteger, lexer.TokenFloat:
 		p.stream.Next()
 		return &nodes.Const{
 			Value:         token.Value,
-			LiteralCommon: nodes.LiteralCommon{Lineno: token.Lineno},
+			LiteralCommon: nodes.LiteralCommon{Lineno: token.Lineno, Span: token.Span},
 		}, nil
 	case lexer.TokenLParen:
 		p.stream.Next()
@@ -267,6 +477,10 @@ func (p *parser) parsePrimary() (nodes.Expr, error) {
 		if _, err := p.stream.Expect(lexer.TokenRParen); err != nil {
 			return nil, err
 		}
+		// the parentheses are part of the tuple syntax, they aren't for other expressions
+		if _, ok := node.(*nodes.Tuple); ok {
+			spanFrom(p, node, start)
+		}
 		return node, nil
 	case lexer.TokenLBracket:
 		return p.parseList()
@@ -286,6 +500,7 @@ func (p *parser) parseExpression(withCondexpr bool) (nodes.Expr, error) {
 
 func (p *parser) parseCondexpr() (nodes.Expr, error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	expr1, err := p.parseOr()
 	if err != nil {
 		return nil, err
@@ -306,12 +521,12 @@ func (p *parser) parseCondexpr() (nodes.Expr, error) {
 		} else {
 			expr3 = nil
 		}
-		expr1 = &nodes.CondExpr{
+		expr1 = spanFrom[nodes.Expr](p, &nodes.CondExpr{
 			Test:       expr2,
 			Expr1:      expr1,
 			Expr2:      expr3,
 			ExprCommon: nodes.ExprCommon{Lineno: lineno},
-		}
+		}, start)
 		lineno = p.stream.Current().Lineno
 	}
 
@@ -320,6 +535,7 @@ func (p *parser) parseCondexpr() (nodes.Expr, error) {
 
 func (p *parser) parseOr() (nodes.Expr, error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	left, err := p.parseAnd()
 	if err != nil {
 		return nil, err
@@ -329,7 +545,7 @@ func (p *parser) parseOr() (nodes.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = makeBinaryOpExpr(left, right, "or", lineno)
+		left = spanFrom(p, makeBinaryOpExpr(left, right, "or", lineno), start)
 		lineno = p.stream.Current().Lineno
 	}
 	return left, nil
@@ -337,6 +553,7 @@ func (p *parser) parseOr() (nodes.Expr, error) {
 
 func (p *parser) parseAnd() (nodes.Expr, error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	left, err := p.parseNot()
 	if err != nil {
 		return nil, err
@@ -346,7 +563,7 @@ func (p *parser) parseAnd() (nodes.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = makeBinaryOpExpr(left, right, "and", lineno)
+		left = spanFrom(p, makeBinaryOpExpr(left, right, "and", lineno), start)
 		lineno = p.stream.Current().Lineno
 	}
 	return left, nil
@@ -354,29 +571,30 @@ func (p *parser) parseAnd() (nodes.Expr, error) {
 
 func (p *parser) parseNot() (nodes.Expr, error) {
 	if p.stream.Current().Test("name:not") {
-		lineno := p.stream.Next().Lineno
+		token := p.stream.Next()
 		n, err := p.parseNot()
 		if err != nil {
 			return nil, err
 		}
-		return &nodes.UnaryExpr{
+		return spanFrom[nodes.Expr](p, &nodes.UnaryExpr{
 			Node:       n,
 			Op:         "not",
-			ExprCommon: nodes.ExprCommon{Lineno: lineno},
-		}, nil
+			ExprCommon: nodes.ExprCommon{Lineno: token.Lineno},
+		}, token.Span.Start), nil
 	}
 	return p.parseCompare()
 }
 
 func (p *parser) parseCompare() (nodes.Expr, error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	expr, err := p.parseMath1()
 	if err != nil {
 		return nil, err
 	}
 	var ops []nodes.Operand
 
-	addOperand := func(tokenType string) error {
+	addOperand := func(tokenType string, opStart lexer.Position) error {
 		e, err := p.parseMath1()
 		if err != nil {
 			return err
@@ -386,23 +604,25 @@ func (p *parser) parseCompare() (nodes.Expr, error) {
 			Expr:         e,
 			HelperCommon: nodes.HelperCommon{Lineno: lineno},
 		})
+		spanFrom(p, &ops[len(ops)-1], opStart)
 		return nil
 	}
 
 	for {
 		tokenType := p.stream.Current().Type
+		opStart := p.stream.Current().Span.Start
 		if compareOperators.Has(tokenType) {
 			p.stream.Next()
-			if err := addOperand(tokenType); err != nil {
+			if err := addOperand(tokenType, opStart); err != nil {
 				return nil, err
 			}
 		} else if p.stream.SkipIf("name:in") {
-			if err := addOperand("in"); err != nil {
+			if err := addOperand("in", opStart); err != nil {
 				return nil, err
 			}
 		} else if p.stream.Current().Test("name:not") && p.stream.Look().Test("name:in") {
 			p.stream.Skip(2)
-			if err := addOperand("notin"); err != nil {
+			if err := addOperand("notin", opStart); err != nil {
 				return nil, err
 			}
 		} else {
@@ -414,15 +634,16 @@ func (p *parser) parseCompare() (nodes.Expr, error) {
 	if len(ops) == 0 {
 		return expr, nil
 	}
-	return &nodes.Compare{
+	return spanFrom[nodes.Expr](p, &nodes.Compare{
 		Expr:       expr,
 		Ops:        ops,
 		ExprCommon: nodes.ExprCommon{Lineno: lineno},
-	}, nil
+	}, start), nil
 }
 
 func (p *parser) parseMath1() (nodes.Expr, error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	left, err := p.parseConcat()
 	if err != nil {
 		return nil, err
@@ -435,7 +656,7 @@ func (p *parser) parseMath1() (nodes.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = makeBinaryOpExpr(left, right, currentType, lineno)
+		left = spanFrom(p, makeBinaryOpExpr(left, right, currentType, lineno), start)
 		lineno = p.stream.Current().Lineno
 	}
 	return left, nil
@@ -444,6 +665,7 @@ func (p *parser) parseMath1() (nodes.Expr, error) {
 func (p *parser) parseMath2() (nodes.Expr, error) {
 	// TODO it's almost identical as parseMath1
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	left, err := p.parsePow()
 	if err != nil {
 		return nil, err
@@ -456,7 +678,7 @@ func (p *parser) parseMath2() (nodes.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = makeBinaryOpExpr(left, right, currentType, lineno)
+		left = spanFrom(p, makeBinaryOpExpr(left, right, currentType, lineno), start)
 		lineno = p.stream.Current().Lineno
 	}
 	return left, nil
@@ -465,6 +687,7 @@ func (p *parser) parseMath2() (nodes.Expr, error) {
 
 func (p *parser) parseConcat() (nodes.Expr, error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	left, err := p.parseMath2()
 	if err != nil {
 		return nil, err
@@ -482,14 +705,15 @@ func (p *parser) parseConcat() (nodes.Expr, error) {
 	if len(args) == 1 {
 		return args[0], nil
 	}
-	return &nodes.Concat{
+	return spanFrom[nodes.Expr](p, &nodes.Concat{
 		Nodes:      args,
 		ExprCommon: nodes.ExprCommon{Lineno: lineno},
-	}, nil
+	}, start), nil
 }
 
 func (p *parser) parsePow() (nodes.Expr, error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	left, err := p.parseUnary(true)
 	if err != nil {
 		return nil, err
@@ -501,7 +725,7 @@ func (p *parser) parsePow() (nodes.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = makeBinaryOpExpr(left, right, lexer.TokenPow, lineno)
+		left = spanFrom(p, makeBinaryOpExpr(left, right, lexer.TokenPow, lineno), start)
 		lineno = p.stream.Current().Lineno
 	}
 	return left, nil
@@ -509,6 +733,7 @@ func (p *parser) parsePow() (nodes.Expr, error) {
 
 func (p *parser) parseUnary(withFilter bool) (node nodes.Expr, err error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	tokenType := p.stream.Current().Type
 
 	if tokenType == lexer.TokenSub || tokenType == lexer.TokenAdd {
@@ -517,11 +742,11 @@ func (p *parser) parseUnary(withFilter bool) (node nodes.Expr, err error) {
 		if err != nil {
 			return
 		}
-		node = &nodes.UnaryExpr{
+		node = spanFrom[nodes.Expr](p, &nodes.UnaryExpr{
 			Node:       node,
 			Op:         tokenType,
 			ExprCommon: nodes.ExprCommon{Lineno: lineno},
-		}
+		}, start)
 	} else {
 		node, err = p.parsePrimary()
 		if err != nil {
@@ -594,6 +819,7 @@ func (p *parser) parseFilterExpr(node nodes.Expr) (nodes.Expr, error) {
 }
 
 func (p *parser) parseSubscript(node nodes.Expr) (nodes.Expr, error) {
+	start := node.GetSpan().Start
 	token := p.stream.Next()
 	var arg nodes.Expr
 
@@ -601,25 +827,25 @@ func (p *parser) parseSubscript(node nodes.Expr) (nodes.Expr, error) {
 		attrToken := p.stream.Current()
 		p.stream.Next()
 		if attrToken.Type == lexer.TokenName {
-			return &nodes.Getattr{
+			return spanFrom[nodes.Expr](p, &nodes.Getattr{
 				Node:       node,
 				Attr:       attrToken.Value.(string),
 				Ctx:        "load",
 				ExprCommon: nodes.ExprCommon{Lineno: attrToken.Lineno},
-			}, nil
+			}, start), nil
 		} else if attrToken.Type != lexer.TokenInteger {
 			return nil, p.fail(fmt.Sprintf("expected name or number, got %s", attrToken.Type), &attrToken.Lineno, nil)
 		}
 		arg = &nodes.Const{
 			Value:         attrToken.Value,
-			LiteralCommon: nodes.LiteralCommon{Lineno: attrToken.Lineno},
+			LiteralCommon: nodes.LiteralCommon{Lineno: attrToken.Lineno, Span: attrToken.Span},
 		}
-		return &nodes.Getitem{
+		return spanFrom[nodes.Expr](p, &nodes.Getitem{
 			Node:       node,
 			Arg:        arg,
 			Ctx:        "load",
 			ExprCommon: nodes.ExprCommon{Lineno: attrToken.Lineno},
-		}, nil
+		}, start), nil
 	} else if token.Type == lexer.TokenLBracket {
 		var args []nodes.Expr
 		for p.stream.Current().Type != lexer.TokenRBracket {
@@ -641,19 +867,20 @@ func (p *parser) parseSubscript(node nodes.Expr) (nodes.Expr, error) {
 		if len(args) == 1 {
 			arg = args[0]
 		} else {
-			arg = &nodes.Tuple{
+			// the tuple has no delimiters of its own, it spans the brackets
+			arg = spanFrom[nodes.Expr](p, &nodes.Tuple{
 				Items:         args,
 				Ctx:           "load",
 				LiteralCommon: nodes.LiteralCommon{Lineno: token.Lineno},
-			}
+			}, token.Span.Start)
 		}
 
-		return &nodes.Getitem{
+		return spanFrom[nodes.Expr](p, &nodes.Getitem{
 			Node:       node,
 			Arg:        arg,
 			Ctx:        "load",
 			ExprCommon: nodes.ExprCommon{Lineno: token.Lineno},
-		}, nil
+		}, start), nil
 	}
 
 	return nil, p.fail("expected subscript expression", &token.Lineno, nil)
@@ -661,6 +888,7 @@ func (p *parser) parseSubscript(node nodes.Expr) (nodes.Expr, error) {
 
 func (p *parser) parseSubscribed() (nodes.Expr, error) {
 	lineno := p.stream.Current().Lineno
+	start := p.stream.Current().Span.Start
 	var args []*nodes.Expr
 
 	if p.stream.Current().Type == lexer.TokenColon {
@@ -705,9 +933,9 @@ func (p *parser) parseSubscribed() (nodes.Expr, error) {
 		args = append(args, nil)
 	}
 
-	var start, stop, step *nodes.Expr
+	var startExpr, stop, step *nodes.Expr
 	if len(args) > 0 {
-		start = args[0]
+		startExpr = args[0]
 	}
 	if len(args) > 1 {
 		stop = args[1]
@@ -715,12 +943,12 @@ func (p *parser) parseSubscribed() (nodes.Expr, error) {
 	if len(args) > 2 {
 		step = args[2]
 	}
-	return &nodes.Slice{
-		Start:      start,
+	return spanFrom[nodes.Expr](p, &nodes.Slice{
+		Start:      startExpr,
 		Stop:       stop,
 		Step:       step,
 		ExprCommon: nodes.ExprCommon{Lineno: lineno},
-	}, nil
+	}, start), nil
 }
 
 func (p *parser) parseCall(node nodes.Expr) (nodes.Expr, error) {
@@ -729,14 +957,14 @@ func (p *parser) parseCall(node nodes.Expr) (nodes.Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &nodes.Call{
+	return spanFrom[nodes.Expr](p, &nodes.Call{
 		Node:       node,
 		Args:       args,
 		Kwargs:     kwargs,
 		DynArgs:    dynArgs,
 		DynKwargs:  dynKwargs,
 		ExprCommon: nodes.ExprCommon{Lineno: lineno},
-	}, nil
+	}, node.GetSpan().Start), nil
 }
 
 func (p *parser) parseCallArgs() (args []nodes.Expr, kwargs []nodes.Keyword, dynArgs *nodes.Expr, dynKwargs *nodes.Expr, err error) {
@@ -794,6 +1022,7 @@ func (p *parser) parseCallArgs() (args []nodes.Expr, kwargs []nodes.Keyword, dyn
 					return
 				}
 				key := p.stream.Current().Value
+				keyStart := p.stream.Current().Span.Start
 				p.stream.Skip(2)
 				expr, err = p.parseExpression(true)
 				if err != nil {
@@ -804,6 +1033,7 @@ func (p *parser) parseCallArgs() (args []nodes.Expr, kwargs []nodes.Keyword, dyn
 					Value:        expr,
 					HelperCommon: nodes.HelperCommon{Lineno: expr.GetLineno()},
 				})
+				spanFrom(p, &kwargs[len(kwargs)-1], keyStart)
 			} else {
 				// Parsing an arg
 				if err = ensure(dynArgs == nil && dynKwargs == nil && len(kwargs) == 0); err != nil {
@@ -825,6 +1055,12 @@ func (p *parser) parseCallArgs() (args []nodes.Expr, kwargs []nodes.Keyword, dyn
 }
 
 func (p *parser) parseFilter(node *nodes.Expr, startInline bool) (*nodes.Expr, error) {
+	if node != nil {
+		// callers usually pass the address of the variable they then
+		// overwrite with the result, the filter must not point to it
+		n := *node
+		node = &n
+	}
 	for p.stream.Current().Type == lexer.TokenPipe || startInline {
 		if !startInline {
 			p.stream.Next()
@@ -834,6 +1070,10 @@ func (p *parser) parseFilter(node *nodes.Expr, startInline bool) (*nodes.Expr, e
 		if err != nil {
 			return nil, err
 		}
+		start := token.Span.Start
+		if node != nil {
+			start = (*node).GetSpan().Start
+		}
 		name := token.Value.(string)
 		for p.stream.Current().Type == lexer.TokenDot {
 			p.stream.Next()
@@ -866,6 +1106,7 @@ func (p *parser) parseFilter(node *nodes.Expr, startInline bool) (*nodes.Expr, e
 				ExprCommon: nodes.ExprCommon{Lineno: token.Lineno},
 			},
 		}
+		spanFrom(p, f, start)
 		node = &f
 
 		startInline = false
@@ -931,14 +1172,15 @@ func (p *parser) parseTest(node nodes.Expr) (nodes.Expr, error) {
 		n.Args = append(n.Args, argNode)
 	}
 
+	spanFrom(p, n, node.GetSpan().Start)
 	if negated {
-		return &nodes.UnaryExpr{
+		return spanFrom[nodes.Expr](p, &nodes.UnaryExpr{
 			Node: n,
 			Op:   "not",
 			ExprCommon: nodes.ExprCommon{
 				Lineno: token.Lineno,
 			},
-		}, nil
+		}, node.GetSpan().Start), nil
 	}
 	return n, nil
 }
@@ -972,7 +1214,7 @@ func (p *parser) parseList() (nodes.Expr, error) {
 	if _, err := p.stream.Expect(lexer.TokenRBracket); err != nil {
 		return nil, err
 	}
-	return n, nil
+	return spanFrom(p, n, token.Span.Start), nil
 }
 
 func (p *parser) parseDict() (nodes.Expr, error) {
@@ -1010,12 +1252,13 @@ func (p *parser) parseDict() (nodes.Expr, error) {
 			Value:        value,
 			HelperCommon: nodes.HelperCommon{Lineno: key.GetLineno()},
 		})
+		spanFrom(p, &n.Items[len(n.Items)-1], key.GetSpan().Start)
 	}
 
 	if _, err := p.stream.Expect(lexer.TokenRBrace); err != nil {
 		return nil, err
 	}
-	return n, nil
+	return spanFrom(p, n, token.Span.Start), nil
 }
 
 func (p *parser) isTupleEnd(extraEndRules []string) bool {
@@ -1126,7 +1369,9 @@ func (p *parser) parseFor() (nodes.Node, error) {
 		node.Test = &test
 	}
 	node.Recursive = p.stream.SkipIf("name:recursive")
+	restore := p.withLoopDepth(p.loopDepth + 1)
 	node.Body, err = p.parseStatements([]string{"name:endfor", "name:else"}, false)
+	restore()
 	if err != nil {
 		return nil, err
 	}
@@ -1160,12 +1405,17 @@ func (p *parser) parseIf() (nodes.Node, error) {
 		}
 		node.Elif = []nodes.If{}
 		node.Else = []nodes.Node{}
+		if node != result {
+			// an elif clause spans from its tag to the end of its body
+			node.SetSpan(lexer.Span{Start: node.Span.Start, End: p.stream.Previous().Span.Start})
+			result.Elif = append(result.Elif, *node)
+		}
+		clauseStart := p.stream.Previous().Span.Start
 		token := p.stream.Next()
 		if token.Test("name:elif") {
 			node = &nodes.If{
-				StmtCommon: nodes.StmtCommon{Lineno: token.Lineno},
+				StmtCommon: nodes.StmtCommon{Lineno: token.Lineno, Span: lexer.Span{Start: clauseStart}},
 			}
-			result.Elif = append(result.Elif, *node)
 			continue
 		} else if token.Test("name:else") {
 			result.Else, err = p.parseStatements([]string{"name:endif"}, true)
@@ -1184,6 +1434,7 @@ func (p *parser) parseStatements(endTokens []string, dropNeedle bool) ([]nodes.N
 	if _, err := p.stream.Expect(lexer.TokenBlockEnd); err != nil {
 		return nil, err
 	}
+	p.bodiesEntered++
 	result, err := p.subparse(endTokens)
 	if err != nil {
 		return nil, err
@@ -1194,6 +1445,7 @@ func (p *parser) parseStatements(endTokens []string, dropNeedle bool) ([]nodes.N
 	if p.stream.Current().Type == lexer.TokenEOF {
 		return nil, p.failEOF(endTokens, nil)
 	}
+	p.lastNeedle = p.stream.Current().Value
 
 	if dropNeedle {
 		p.stream.Next()
@@ -1211,6 +1463,7 @@ func (p *parser) parseBlock() (nodes.Node, error) {
 	node.Name = fmt.Sprint(tokName.Value)
 	node.Scoped = p.stream.SkipIf("name:scoped")
 	node.Required = p.stream.SkipIf("name:required")
+	defer p.withLoopDepth(0)()
 
 	if p.stream.Current().Type == lexer.TokenSub {
 		// Common problem people encounter when switching from django to jinja.
@@ -1287,6 +1540,7 @@ func (p *parser) parseMacro() (nodes.Node, error) {
 	if err = p.parseSignature(&n.MacroCall); err != nil {
 		return nil, err
 	}
+	defer p.withLoopDepth(0)()
 	n.Body, err = p.parseStatements([]string{"name:endmacro"}, true)
 	if err != nil {
 		return nil, err
@@ -1406,7 +1660,14 @@ func (p *parser) parseImport() (nodes.Node, error) {
 
 func (p *parser) parseSet() (nodes.Node, error) {
 	lineno := p.stream.Next().Lineno
-	target, err := p.parseAssignTargetNameNamespace()
+	// like in Jinja, the targets can be tuples, `{% set a, b = x %}`
+	var target nodes.Expr
+	var err error
+	if p.stream.Look().Type == lexer.TokenDot {
+		target, err = p.parseAssignTargetNameNamespace()
+	} else {
+		target, err = p.parseAssignTargetTuple(nil)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -1425,21 +1686,26 @@ func (p *parser) parseSet() (nodes.Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	if f, ok := (*filter).(*nodes.Filter); ok {
-		body, err := p.parseStatements([]string{"name:endset"}, true)
-		if err != nil {
-			return nil, err
+	// the filter is optional, `{% set x %}` has none
+	var f *nodes.Filter
+	if filter != nil {
+		var ok bool
+		if f, ok = (*filter).(*nodes.Filter); !ok {
+			return nil, fmt.Errorf("couldn't parse filter")
 		}
-		return &nodes.AssignBlock{
-			Target: target,
-			Body:   body,
-			Filter: f,
-			StmtCommon: nodes.StmtCommon{
-				Lineno: lineno,
-			},
-		}, nil
 	}
-	return nil, fmt.Errorf("couldn't parse filter")
+	body, err := p.parseStatements([]string{"name:endset"}, true)
+	if err != nil {
+		return nil, err
+	}
+	return &nodes.AssignBlock{
+		Target: target,
+		Body:   body,
+		Filter: f,
+		StmtCommon: nodes.StmtCommon{
+			Lineno: lineno,
+		},
+	}, nil
 }
 
 func (p *parser) parseWith() (nodes.Node, error) {
@@ -1493,7 +1759,7 @@ func (p *parser) parseAutoescape() (nodes.Node, error) {
 	node.Options[0] = nodes.Keyword{
 		Key:          "autoescape",
 		Value:        optsExpr,
-		HelperCommon: nodes.HelperCommon{Lineno: optsExpr.GetLineno()},
+		HelperCommon: nodes.HelperCommon{Lineno: optsExpr.GetLineno(), Span: optsExpr.GetSpan()},
 	}
 	node.Body, err = p.parseStatements([]string{"name:endautoescape"}, true)
 	if err != nil {
@@ -1521,6 +1787,7 @@ func (p *parser) parseCallBlock() (nodes.Node, error) {
 	} else {
 		return nil, p.fail("expected call", &node.Lineno, nil)
 	}
+	defer p.withLoopDepth(0)()
 	node.Body, err = p.parseStatements([]string{"name:endcall"}, true)
 	if err != nil {
 		return nil, err
@@ -1564,7 +1831,7 @@ func (p *parser) parseAssignTargetName() (target *nodes.Name, err error) {
 	target = &nodes.Name{
 		Name:       fmt.Sprint(token.Value),
 		Ctx:        "store",
-		ExprCommon: nodes.ExprCommon{Lineno: token.Lineno},
+		ExprCommon: nodes.ExprCommon{Lineno: token.Lineno, Span: token.Span},
 	}
 	if !target.CanAssign() {
 		lineno := target.GetLineno()
@@ -1576,6 +1843,9 @@ func (p *parser) parseAssignTargetName() (target *nodes.Name, err error) {
 
 func (p *parser) parseAssignTargetTuple(extraEndRules []string) (target nodes.Expr, err error) {
 	target, err = p.parseTuple(true, true, extraEndRules, false)
+	if err != nil {
+		return nil, err
+	}
 	target.SetCtx("store")
 
 	if !target.CanAssign() {
@@ -1616,11 +1886,11 @@ func (p *parser) parseNSRef() (*nodes.NSRef, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &nodes.NSRef{
+	return spanFrom(p, &nodes.NSRef{
 		Name:       fmt.Sprint(token.Value),
 		Attr:       fmt.Sprint(attr.Value),
 		ExprCommon: nodes.ExprCommon{Lineno: token.Lineno},
-	}, nil
+	}, token.Span.Start), nil
 }
 
 func (p *parser) parseSignature(n *nodes.MacroCall) error {
@@ -1665,7 +1935,12 @@ func (p *parser) fail(msg string, lineno *int, exc func(msg string, lineno int,
 	if exc == nil {
 		exc = errors.TemplateSyntaxError
 	}
-	return exc(msg, lineNumber, p.name, p.filename)
+	err := exc(msg, lineNumber, p.name, p.filename)
+	// the error is about the current token, unless we were told otherwise
+	if sErr, ok := err.(*errors.SyntaxError); ok && lineno == nil {
+		sErr.Col = p.stream.Current().Span.Start.Col + 1
+	}
+	return err
 }
 
 func (p *parser) failUnknownTag(name string, lineno *int) error {
@@ -1673,10 +1948,14 @@ func (p *parser) failUnknownTag(name string, lineno *int) error {
 }
 
 func (p *parser) failEOF(endTokens []string, lineno *int) error {
+	endTokenStack := stack.New[[]string]()
+	for _, e := range p.endTokenStack.Iter() {
+		endTokenStack.Push(e)
+	}
 	if endTokens != nil {
-		p.endTokenStack.Push(endTokens)
+		endTokenStack.Push(endTokens)
 	}
-	return p.failUtEof(nil, p.endTokenStack, lineno)
+	return p.failUtEof(nil, endTokenStack, lineno)
 }
 
 func (p *parser) failUtEof(name *string, endTokenStack *stack.Stack[[]string], lineno *int) error {
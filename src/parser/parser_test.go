@@ -1,9 +1,11 @@
 package parser
 
 import (
+	"github.com/gojinja/gojinja/src/errors"
 	"github.com/gojinja/gojinja/src/lexer"
 	"github.com/gojinja/gojinja/src/nodes"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -95,6 +97,33 @@ var cases = []parserTest{
 			NodeCommon: nodes.NodeCommon{Lineno: 1},
 		},
 	},
+	{
+		input: `{% set x %}a{% endset %}`,
+		res: &nodes.Template{
+			Body: []nodes.Node{
+				&nodes.AssignBlock{
+					Target: &nodes.Name{
+						Name:       "x",
+						Ctx:        "store",
+						ExprCommon: nodes.ExprCommon{Lineno: 1},
+					},
+					Body: []nodes.Node{
+						&nodes.Output{
+							Nodes: []nodes.Expr{
+								&nodes.TemplateData{
+									Data:          "a",
+									LiteralCommon: nodes.LiteralCommon{Lineno: 1},
+								},
+							},
+							StmtCommon: nodes.StmtCommon{Lineno: 1},
+						},
+					},
+					StmtCommon: nodes.StmtCommon{Lineno: 1},
+				},
+			},
+			NodeCommon: nodes.NodeCommon{Lineno: 1},
+		},
+	},
 }
 
 func Test(t *testing.T) {
@@ -120,7 +149,225 @@ func runCase(c parserTest, t *testing.T) {
 		t.Fatal(err)
 	}
 
+	clearSpans(reflect.ValueOf(template))
 	if !reflect.DeepEqual(template, c.res) {
-		t.Fatalf("Expected %v, got %v", c.res, template)
+		t.Fatalf("%q: expected\n%s\ngot\n%s", c.input, nodes.Dump(c.res), nodes.Dump(template))
+	}
+}
+
+var spanType = reflect.TypeOf(lexer.Span{})
+
+// clearSpans zeroes the spans of all the nodes reachable from v, so trees
+// can be compared without writing the positions down.
+func clearSpans(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			clearSpans(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearSpans(v.Index(i))
+		}
+	case reflect.Struct:
+		if v.Type() == spanType {
+			if v.CanSet() {
+				v.Set(reflect.Zero(spanType))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			clearSpans(v.Field(i))
+		}
+	}
+}
+
+type spanTest struct {
+	node func(*nodes.Template) nodes.Node
+	text string
+}
+
+func TestSpans(t *testing.T) {
+	input := "a\n{{ foo.bar(x=1)[0] | upper }}\n{% for i in (1, 2) %}{{ -i ~ 'b' }}{% endfor %}\n{% if a %}{% elif b is not c %}x{% endif %}"
+	template, err := NewParser(getTokenStream(input, t), nil, nil, nil, nil).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := func(i int) nodes.Expr {
+		return template.Body[i].(*nodes.Output).Nodes[1]
+	}
+	forNode := func(tpl *nodes.Template) *nodes.For {
+		return tpl.Body[1].(*nodes.For)
+	}
+	filter := func(*nodes.Template) nodes.Node { return output(0) }
+	getitem := func(*nodes.Template) nodes.Node { return *output(0).(*nodes.Filter).Node }
+	call := func(tpl *nodes.Template) nodes.Node { return getitem(tpl).(*nodes.Getitem).Node }
+	cases := []spanTest{
+		{func(tpl *nodes.Template) nodes.Node { return tpl }, input},
+		{func(tpl *nodes.Template) nodes.Node { return tpl.Body[0] }, "a\n{{ foo.bar(x=1)[0] | upper }}\n"},
+		{filter, "foo.bar(x=1)[0] | upper"},
+		{getitem, "foo.bar(x=1)[0]"},
+		{call, "foo.bar(x=1)"},
+		{func(tpl *nodes.Template) nodes.Node { return call(tpl).(*nodes.Call).Node }, "foo.bar"},
+		{func(tpl *nodes.Template) nodes.Node { return &call(tpl).(*nodes.Call).Kwargs[0] }, "x=1"},
+		{func(tpl *nodes.Template) nodes.Node { return forNode(tpl) }, "{% for i in (1, 2) %}{{ -i ~ 'b' }}{% endfor %}"},
+		{func(tpl *nodes.Template) nodes.Node { return forNode(tpl).Target }, "i"},
+		{func(tpl *nodes.Template) nodes.Node { return forNode(tpl).Iter }, "(1, 2)"},
+		{func(tpl *nodes.Template) nodes.Node { return forNode(tpl).Body[0] }, "{{ -i ~ 'b' }}"},
+		{func(tpl *nodes.Template) nodes.Node { return forNode(tpl).Body[0].(*nodes.Output).Nodes[0] }, "-i ~ 'b'"},
+		{func(tpl *nodes.Template) nodes.Node { return &tpl.Body[3].(*nodes.If).Elif[0] }, "{% elif b is not c %}x"},
+		{func(tpl *nodes.Template) nodes.Node { return tpl.Body[3].(*nodes.If).Elif[0].Test }, "b is not c"},
+	}
+	for i, c := range cases {
+		span := c.node(template).GetSpan()
+		if text := input[span.Start.Offset:span.End.Offset]; text != c.text {
+			t.Fatalf("case %d: expected %q, got %q", i, c.text, text)
+		}
+	}
+
+	forSpan := forNode(template).GetSpan()
+	if forSpan.Start.Lineno != 3 || forSpan.Start.Col != 0 || forSpan.End.Lineno != 3 || forSpan.End.Col != 47 {
+		t.Fatalf("unexpected for span %#v", forSpan)
+	}
+}
+
+type recoveryTest struct {
+	input   string
+	linenos []int
+	body    int
+}
+
+var recoveryCases = []recoveryTest{
+	{input: "{{ name }}", linenos: nil, body: 1},
+	{input: "{{ }}\n{{ foo( 1 2 ) }}\n{{ ok }}", linenos: []int{1, 2}, body: 1},
+	{input: "{% for in x %}{{ a }}{% endfor %}{% if %}{% endif %}\n{{ ok }}", linenos: []int{1, 1}, body: 1},
+	{input: "{% for x in y %}{{ }}{% endfor %}{% endif %}", linenos: []int{1, 1}, body: 1},
+	{input: "{% if a %}x{% elif %}y{% endif %}{{ ok }}", linenos: []int{1}, body: 1},
+	{input: "{% for x in y %}\n{% if x %}\n{{ x }}", linenos: []int{3}, body: 0},
+	{input: "{% block a %}{% endblock b c %}\n{% unknown %}{{ ok }}", linenos: []int{1, 2}, body: 3},
+}
+
+func TestParseWithRecovery(t *testing.T) {
+	for _, c := range recoveryCases {
+		ts := getTokenStream(c.input, t)
+		template, errs := NewParser(ts, nil, nil, nil, nil).ParseWithRecovery()
+		if template == nil {
+			t.Fatal("expected a partial template for", c.input)
+		}
+		var linenos []int
+		for _, err := range errs {
+			sErr, ok := err.(*errors.SyntaxError)
+			if !ok {
+				t.Fatal("expected a syntax error, got", err)
+			}
+			linenos = append(linenos, sErr.Lineno)
+		}
+		if !reflect.DeepEqual(linenos, c.linenos) {
+			t.Fatalf("%q: expected errors on lines %v, got %v", c.input, c.linenos, errs)
+		}
+		if len(template.Body) != c.body {
+			t.Fatalf("%q: expected %d nodes, got %d", c.input, c.body, len(template.Body))
+		}
+	}
+}
+
+func TestParseStopsAtFirstError(t *testing.T) {
+	ts := getTokenStream("{{ foo( 1 2 ) }}{{ }}", t)
+	_, err := NewParser(ts, nil, nil, nil, nil).Parse()
+	sErr, ok := err.(*errors.SyntaxError)
+	if !ok {
+		t.Fatal("expected a syntax error, got", err)
+	}
+	if sErr.Lineno != 1 || sErr.Col != 11 {
+		t.Fatalf("expected the error at 1:11, got %d:%d", sErr.Lineno, sErr.Col)
+	}
+}
+
+type lineStatementTest struct {
+	input        string
+	trimBlocks   bool
+	lstripBlocks bool
+	res          string
+}
+
+var lineStatementCases = []lineStatementTest{
+	{
+		input: "# for item in seq:\n  {{ item }} ## the item\n# endfor",
+		res:   `Template(body=[For(target=Name(name='item', ctx='store'), iter=Name(name='seq', ctx='load'), body=[Output(nodes=[TemplateData(data='  '), Name(name='item', ctx='load'), TemplateData(data='\n')])], else=[], test=None, recursive=False)])`,
+	},
+	{
+		input: "a\n  # if x\n## ignored\nb\n\t# elif (y,\n  z)\nc\n  # else\nd\n  # endif\n",
+		res:   `Template(body=[Output(nodes=[TemplateData(data='a\n')]), If(test=Name(name='x', ctx='load'), body=[Output(nodes=[TemplateData(data='\nb\n')])], elif=[If(test=Tuple(items=[Name(name='y', ctx='load'), Name(name='z', ctx='load')], ctx='load'), body=[Output(nodes=[TemplateData(data='c\n')])], elif=[], else=[])], else=[Output(nodes=[TemplateData(data='d\n')])])])`,
+	},
+	{
+		// the line statements end with the newline, trim_blocks changes
+		// the block tags only
+		input:      "# if x\n  {% if y %}\n  a\n  {% endif %}\n# endif\nb",
+		trimBlocks: true,
+		res:        `Template(body=[If(test=Name(name='x', ctx='load'), body=[Output(nodes=[TemplateData(data='  ')]), If(test=Name(name='y', ctx='load'), body=[Output(nodes=[TemplateData(data='  a\n  ')])], elif=[], else=[])], elif=[], else=[]), Output(nodes=[TemplateData(data='b')])])`,
+	},
+	{
+		input:        "  # if x\n  {% if y %}\n  a\n  {% endif %}\n  # endif\n  b",
+		trimBlocks:   true,
+		lstripBlocks: true,
+		res:          `Template(body=[If(test=Name(name='x', ctx='load'), body=[If(test=Name(name='y', ctx='load'), body=[Output(nodes=[TemplateData(data='  a\n')])], elif=[], else=[])], elif=[], else=[]), Output(nodes=[TemplateData(data='  b')])])`,
+	},
+	{
+		input:        "  {% set a = 1 %}  ## comment\n  # set b = 2\n  {{ a }}#{{ b }}\n",
+		lstripBlocks: true,
+		res:          `Template(body=[Assign(target=Name(name='a', ctx='store'), node=Const(value=1)), Output(nodes=[TemplateData(data='\n')]), Assign(target=Name(name='b', ctx='store'), node=Const(value=2)), Output(nodes=[TemplateData(data='  '), Name(name='a', ctx='load'), TemplateData(data='#'), Name(name='b', ctx='load')])])`,
+	},
+}
+
+func TestLineStatements(t *testing.T) {
+	for _, c := range lineStatementCases {
+		info := lexer.DefaultEnvLexerInformation()
+		statementPrefix, commentPrefix := "#", "##"
+		info.LineStatementPrefix = &statementPrefix
+		info.LineCommentPrefix = &commentPrefix
+		info.TrimBlocks = c.trimBlocks
+		info.LStripBlocks = c.lstripBlocks
+		ts, err := lexer.GetLexer(info).Tokenize(c.input, nil, nil, nil)
+		if err != nil {
+			t.Fatal(c.input, err)
+		}
+		template, err := NewParser(ts, nil, nil, nil, nil).Parse()
+		if err != nil {
+			t.Fatal(c.input, err)
+		}
+		if res := nodes.Repr(template); res != c.res {
+			t.Fatalf("%q: expected\n%s\ngot\n%s", c.input, c.res, res)
+		}
+	}
+}
+
+// assignTargetCases are the targets of for loops and set tags, with the
+// representation of their first node.
+var assignTargetCases = map[string]string{
+	`{% for a, b in x %}{% endfor %}`:        `For(target=Tuple(items=[Name(name='a', ctx='store'), Name(name='b', ctx='store')], ctx='store'), iter=Name(name='x', ctx='load'), body=[], else=[], test=None, recursive=False)`,
+	`{% for (a, (b, c)) in x %}{% endfor %}`: `For(target=Tuple(items=[Name(name='a', ctx='store'), Tuple(items=[Name(name='b', ctx='store'), Name(name='c', ctx='store')], ctx='store')], ctx='store'), iter=Name(name='x', ctx='load'), body=[], else=[], test=None, recursive=False)`,
+	`{% set a, b = x, 1 %}`:                  `Assign(target=Tuple(items=[Name(name='a', ctx='store'), Name(name='b', ctx='store')], ctx='store'), node=Tuple(items=[Name(name='x', ctx='load'), Const(value=1)], ctx='load'))`,
+	`{% set (a, b) = x %}`:                   `Assign(target=Tuple(items=[Name(name='a', ctx='store'), Name(name='b', ctx='store')], ctx='store'), node=Name(name='x', ctx='load'))`,
+	`{% set a, %}x{% endset %}`:              `AssignBlock(target=Tuple(items=[Name(name='a', ctx='store')], ctx='store'), body=[Output(nodes=[TemplateData(data='x')])], filter=None)`,
+	`{% set a | upper %}x{% endset %}`:       `AssignBlock(target=Name(name='a', ctx='store'), body=[Output(nodes=[TemplateData(data='x')])], filter=Filter(node=None, name='upper', args=[], kwargs=[], dyn_args=None, dyn_kwargs=None))`,
+	`{% set ns.a = 1 %}`:                     `Assign(target=NSRef(name='ns', attr='a'), node=Const(value=1))`,
+}
+
+func TestAssignTargets(t *testing.T) {
+	for input, expected := range assignTargetCases {
+		template, err := NewParser(getTokenStream(input, t), nil, nil, nil, nil).Parse()
+		if err != nil {
+			t.Fatal(input, err)
+		}
+		if res := nodes.Repr(template.Body[0]); res != expected {
+			t.Fatalf("%q: expected\n%s\ngot\n%s", input, expected, res)
+		}
+	}
+
+	for _, input := range []string{`{% set a, 1 = x %}`, `{% for (a, b.c) in x %}{% endfor %}`, `{% set true = x %}`} {
+		_, err := NewParser(getTokenStream(input, t), nil, nil, nil, nil).Parse()
+		if sErr, ok := err.(*errors.SyntaxError); !ok || !strings.HasPrefix(sErr.Message, "can't assign to") {
+			t.Fatalf("%q: expected an assignment error, got %v", input, err)
+		}
 	}
 }
@@ -1,5 +1,25 @@
 package runtime
 
-type Context struct{}
+import "golang.org/x/exp/maps"
+
+// Context holds the variables of a render: the parent ones (the globals and
+// the arguments of the render) and the ones the template sets.
+type Context struct {
+	Parent map[string]any
+	Vars   map[string]any
+}
+
+func NewContext(parent map[string]any) *Context {
+	return &Context{Parent: parent, Vars: make(map[string]any)}
+}
+
+// GetAll returns all the variables of the context, the ones set by the
+// template hide the parent ones.
+func (c *Context) GetAll() map[string]any {
+	all := make(map[string]any, len(c.Parent)+len(c.Vars))
+	maps.Copy(all, c.Parent)
+	maps.Copy(all, c.Vars)
+	return all
+}
 
 type ContextClass struct{}
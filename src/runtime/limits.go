@@ -0,0 +1,122 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/errors"
+	"math"
+)
+
+// Limits are the resources a render may use, they protect the host from
+// untrusted templates. A limit that isn't positive is disabled, so the zero
+// value doesn't limit anything. Exceeding a limit aborts the render with an
+// `errors.LimitError` carrying the name of the limit's field.
+type Limits struct {
+	// MaxOutputBytes is the size of the rendered output.
+	MaxOutputBytes int
+	// MaxLoopIterations is the number of loop iterations of a render, summed
+	// over all the loops.
+	MaxLoopIterations int
+	// MaxRecursionDepth is how deep macro calls, recursive loops and includes can nest.
+	MaxRecursionDepth int
+	// MaxRangeSize is the number of items the `range` global can return.
+	MaxRangeSize int
+	// MaxRepetition is the length of the strings and lists the `*` operator can
+	// create by repeating a string or a list.
+	MaxRepetition int
+}
+
+// Budget tracks the resources used by a single render against its Limits.
+// The renderer reports what it does to the budget and aborts on the first error.
+type Budget struct {
+	limits     Limits
+	output     int
+	iterations int
+	depth      int
+}
+
+func NewBudget(limits Limits) *Budget {
+	return &Budget{limits: limits}
+}
+
+// Limits returns the limits the budget checks.
+func (b *Budget) Limits() Limits {
+	return b.limits
+}
+
+// Write records n more bytes of output.
+func (b *Budget) Write(n int) error {
+	b.output += n
+	if b.limits.MaxOutputBytes > 0 && b.output > b.limits.MaxOutputBytes {
+		return errors.LimitExceeded("MaxOutputBytes", b.limits.MaxOutputBytes)
+	}
+	return nil
+}
+
+// Iterate records a loop iteration, LoopContext.Run calls it for every item.
+func (b *Budget) Iterate() error {
+	b.iterations++
+	if b.limits.MaxLoopIterations > 0 && b.iterations > b.limits.MaxLoopIterations {
+		return errors.LimitExceeded("MaxLoopIterations", b.limits.MaxLoopIterations)
+	}
+	return nil
+}
+
+// Enter records entering a macro, a recursive loop or an included template.
+// Every successful Enter must be matched by a Leave. LoopContext.Call does it
+// for the recursive loops.
+func (b *Budget) Enter() error {
+	if b.limits.MaxRecursionDepth > 0 && b.depth >= b.limits.MaxRecursionDepth {
+		return errors.LimitExceeded("MaxRecursionDepth", b.limits.MaxRecursionDepth)
+	}
+	b.depth++
+	return nil
+}
+
+// Leave records leaving what was entered by the last Enter.
+func (b *Budget) Leave() {
+	if b.depth > 0 {
+		b.depth--
+	}
+}
+
+// Range works like Python's `range`, returning the numbers from start
+// (inclusive, 0 if omitted) to stop (exclusive) by step (1 if omitted).
+// It fails if the result would be longer than MaxRangeSize, or than
+// math.MaxInt32 items without a limit.
+func (l Limits) Range(args ...int64) ([]int64, error) {
+	var start, stop, step int64 = 0, 0, 1
+	switch len(args) {
+	case 1:
+		stop = args[0]
+	case 2:
+		start, stop = args[0], args[1]
+	case 3:
+		start, stop, step = args[0], args[1], args[2]
+	default:
+		return nil, fmt.Errorf("range expected 1 to 3 arguments, got %d", len(args))
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("range() arg 3 must not be zero")
+	}
+
+	// the differences are computed on uint64, they overflow int64 for
+	// extreme bounds
+	var n uint64
+	if step > 0 && start < stop {
+		n = (uint64(stop)-uint64(start)-1)/uint64(step) + 1
+	} else if step < 0 && start > stop {
+		n = (uint64(start)-uint64(stop)-1)/(-uint64(step)) + 1
+	}
+	if l.MaxRangeSize > 0 && n > uint64(l.MaxRangeSize) {
+		return nil, errors.LimitExceeded("MaxRangeSize", l.MaxRangeSize)
+	}
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("range() result has too many items")
+	}
+
+	ret := make([]int64, 0, n)
+	for i := uint64(0); i < n; i++ {
+		ret = append(ret, start+int64(i)*step)
+	}
+	return ret, nil
+}
@@ -0,0 +1,100 @@
+package runtime
+
+import (
+	stderrors "errors"
+	"github.com/gojinja/gojinja/src/errors"
+	"golang.org/x/exp/slices"
+	"math"
+	"testing"
+)
+
+func expectLimit(t *testing.T, err error, limit string) {
+	t.Helper()
+	var limitErr *errors.LimitError
+	if !stderrors.As(err, &limitErr) || limitErr.Limit != limit {
+		t.Fatal("expected", limit, "to be exceeded, got", err)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(Limits{MaxOutputBytes: 10, MaxLoopIterations: 3, MaxRecursionDepth: 2})
+
+	if err := b.Write(10); err != nil {
+		t.Fatal(err)
+	}
+	expectLimit(t, b.Write(1), "MaxOutputBytes")
+
+	for i := 0; i < 3; i++ {
+		if err := b.Iterate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectLimit(t, b.Iterate(), "MaxLoopIterations")
+
+	for i := 0; i < 2; i++ {
+		if err := b.Enter(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectLimit(t, b.Enter(), "MaxRecursionDepth")
+	b.Leave()
+	if err := b.Enter(); err != nil {
+		t.Fatal(err)
+	}
+
+	unlimited := NewBudget(Limits{})
+	for i := 0; i < 1000; i++ {
+		if err := unlimited.Write(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		if err := unlimited.Enter(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	cases := []struct {
+		args []int64
+		res  []int64
+	}{
+		{[]int64{3}, []int64{0, 1, 2}},
+		{[]int64{2, 5}, []int64{2, 3, 4}},
+		{[]int64{0, 10, 3}, []int64{0, 3, 6, 9}},
+		{[]int64{5, 0, -2}, []int64{5, 3, 1}},
+		{[]int64{5, 0}, []int64{}},
+		{[]int64{-3}, []int64{}},
+		{[]int64{math.MinInt64, math.MaxInt64, math.MaxInt64}, []int64{math.MinInt64, -1, math.MaxInt64 - 1}},
+		{[]int64{math.MaxInt64, math.MinInt64, math.MinInt64}, []int64{math.MaxInt64, -1}},
+	}
+	for _, c := range cases {
+		res, err := Limits{}.Range(c.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(res, c.res) {
+			t.Fatal("range", c.args, "expected", c.res, "got", res)
+		}
+	}
+
+	if _, err := (Limits{}).Range(1, 2, 0); err == nil {
+		t.Fatal("expected an error for a zero step")
+	}
+	if _, err := (Limits{}).Range(); err == nil {
+		t.Fatal("expected an error without arguments")
+	}
+
+	limits := Limits{MaxRangeSize: 4}
+	if _, err := limits.Range(0, 8, 2); err != nil {
+		t.Fatal(err)
+	}
+	_, err := limits.Range(1 << 40)
+	expectLimit(t, err, "MaxRangeSize")
+	_, err = limits.Range(math.MinInt64, math.MaxInt64)
+	expectLimit(t, err, "MaxRangeSize")
+	_, err = limits.Range(math.MaxInt64, math.MinInt64, -1)
+	expectLimit(t, err, "MaxRangeSize")
+	if _, err = (Limits{}).Range(math.MinInt64, math.MaxInt64); err == nil {
+		t.Fatal("expected an error for a range too large to allocate")
+	}
+}
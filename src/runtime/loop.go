@@ -0,0 +1,256 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/operator"
+	"github.com/gojinja/gojinja/src/utils"
+	"reflect"
+)
+
+// LoopControl is what the body of a loop asks the loop to do next.
+type LoopControl int
+
+const (
+	// LoopNext goes on with the next item, it's also what `{% continue %}` does
+	// once it stopped the body.
+	LoopNext LoopControl = iota
+	// LoopBreak stops the loop, it's what `{% break %}` does.
+	LoopBreak
+)
+
+// LoopContext is the `loop` variable of for loops. It fetches the items
+// lazily, the next item is only fetched when the template asks for
+// `loop.last`, `loop.nextitem`, or the length.
+type LoopContext struct {
+	iter      operator.Iterator
+	pending   []any
+	exhausted bool
+	length    int
+	hasLength bool
+
+	index0   int
+	depth0   int
+	current  any
+	previous any
+	hasPrev  bool
+
+	lastChanged []any
+	changed     bool
+	undefined   UndefinedConstructor
+	recurse     func(iterable any) (any, error)
+	budget      *Budget
+}
+
+var _ operator.IGetAttribute = &LoopContext{}
+
+// NewLoopContext creates the loop context iterating over iterable. depth0
+// is the depth of the loop in a recursive loop, recurse renders the loop
+// again over another iterable (it's nil if the loop isn't recursive) and
+// undefined creates the values of the missing items. The iterations and the
+// recursive calls are charged to budget, unless it's nil.
+func NewLoopContext(iterable any, undefined UndefinedConstructor, recurse func(iterable any) (any, error), depth0 int, budget *Budget) (*LoopContext, error) {
+	iter, err := operator.Iter(iterable)
+	if err != nil {
+		return nil, err
+	}
+	l := &LoopContext{iter: iter, index0: -1, depth0: depth0, undefined: undefined, recurse: recurse, budget: budget}
+	if length, err := operator.Len(iterable); err == nil {
+		l.length, l.hasLength = length, true
+	}
+	return l, nil
+}
+
+// Run calls body with every item until the items are exhausted or body
+// returns LoopBreak. It tells if body was called at least once, the `else`
+// block of the loop is rendered if it wasn't.
+func (l *LoopContext) Run(body func(item any) (LoopControl, error)) (bool, error) {
+	iterated := false
+	for l.advance() {
+		if l.budget != nil {
+			if err := l.budget.Iterate(); err != nil {
+				return iterated, err
+			}
+		}
+		iterated = true
+		control, err := body(l.current)
+		if err != nil {
+			return iterated, err
+		}
+		if control == LoopBreak {
+			break
+		}
+	}
+	return iterated, nil
+}
+
+// advance moves to the next item, it returns false if there's none.
+func (l *LoopContext) advance() bool {
+	if !l.fill(1) {
+		return false
+	}
+	if l.index0 >= 0 {
+		l.previous, l.hasPrev = l.current, true
+	}
+	l.current = l.pending[0]
+	l.pending = l.pending[1:]
+	l.index0++
+	return true
+}
+
+// fill fetches items until n of them are pending, it returns false if
+// there aren't enough items left.
+func (l *LoopContext) fill(n int) bool {
+	for len(l.pending) < n && !l.exhausted {
+		if l.iter.Next() {
+			l.pending = append(l.pending, l.iter.Elem())
+		} else {
+			l.exhausted = true
+		}
+	}
+	return len(l.pending) >= n
+}
+
+// Length returns the number of items, it fetches all the remaining items
+// if the iterable has no length.
+func (l *LoopContext) Length() int {
+	if !l.hasLength {
+		for !l.exhausted {
+			l.fill(len(l.pending) + 1)
+		}
+		l.length, l.hasLength = l.index0+1+len(l.pending), true
+	}
+	return l.length
+}
+
+func (l *LoopContext) Index0() int {
+	return l.index0
+}
+
+func (l *LoopContext) Index() int {
+	return l.index0 + 1
+}
+
+func (l *LoopContext) RevIndex0() int {
+	return l.Length() - l.index0 - 1
+}
+
+func (l *LoopContext) RevIndex() int {
+	return l.Length() - l.index0
+}
+
+func (l *LoopContext) First() bool {
+	return l.index0 == 0
+}
+
+// Last tells if the current item is the last one, whether the loop is
+// stopped with `{% break %}` doesn't matter.
+func (l *LoopContext) Last() bool {
+	return !l.fill(1)
+}
+
+func (l *LoopContext) Depth0() int {
+	return l.depth0
+}
+
+func (l *LoopContext) Depth() int {
+	return l.depth0 + 1
+}
+
+// PrevItem returns the item of the previous iteration, or an undefined on
+// the first one.
+func (l *LoopContext) PrevItem() any {
+	if !l.hasPrev {
+		return l.missing("there is no previous item", "previtem")
+	}
+	return l.previous
+}
+
+// NextItem returns the item of the next iteration, or an undefined on the
+// last one.
+func (l *LoopContext) NextItem() any {
+	if !l.fill(1) {
+		return l.missing("there is no next item", "nextitem")
+	}
+	return l.pending[0]
+}
+
+func (l *LoopContext) missing(hint string, name string) any {
+	if l.undefined == nil {
+		return nil
+	}
+	return l.undefined(&hint, utils.GetMissing(), &name, nil, nil)
+}
+
+// Cycle returns the argument at the index of the iteration, modulo the
+// number of arguments.
+func (l *LoopContext) Cycle(args ...any) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no items for cycling given")
+	}
+	return args[l.index0%len(args)], nil
+}
+
+// Changed tells if it's the first call or if the arguments differ from the
+// ones of the previous call.
+func (l *LoopContext) Changed(args ...any) bool {
+	if l.changed && reflect.DeepEqual(args, l.lastChanged) {
+		return false
+	}
+	l.lastChanged, l.changed = args, true
+	return true
+}
+
+func (l *LoopContext) GetAttribute(name string) (any, error) {
+	switch name {
+	case "index0":
+		return l.Index0(), nil
+	case "index":
+		return l.Index(), nil
+	case "revindex0":
+		return l.RevIndex0(), nil
+	case "revindex":
+		return l.RevIndex(), nil
+	case "first":
+		return l.First(), nil
+	case "last":
+		return l.Last(), nil
+	case "length":
+		return l.Length(), nil
+	case "depth0":
+		return l.Depth0(), nil
+	case "depth":
+		return l.Depth(), nil
+	case "previtem":
+		return l.PrevItem(), nil
+	case "nextitem":
+		return l.NextItem(), nil
+	case "cycle":
+		return l.Cycle, nil
+	case "changed":
+		return l.Changed, nil
+	default:
+		return nil, operator.NotFound("loop has no attribute '%s'", name)
+	}
+}
+
+// Call renders a recursive loop again over the given iterable, `loop(children)`
+// in templates.
+func (l *LoopContext) Call(args []any, kwargs map[string]any) (any, error) {
+	if l.recurse == nil {
+		return nil, fmt.Errorf("the loop must have the 'recursive' marker to be called recursively")
+	}
+	if len(args) != 1 || len(kwargs) > 0 {
+		return nil, fmt.Errorf("loop() takes exactly one argument")
+	}
+	if l.budget != nil {
+		if err := l.budget.Enter(); err != nil {
+			return nil, err
+		}
+		defer l.budget.Leave()
+	}
+	return l.recurse(args[0])
+}
+
+func (l *LoopContext) Repr() string {
+	return fmt.Sprintf("<LoopContext %d/%d>", l.Index(), l.Length())
+}
@@ -0,0 +1,218 @@
+package runtime
+
+import (
+	"github.com/gojinja/gojinja/src/operator"
+	"reflect"
+	"testing"
+)
+
+// countingIter is an iterator without a length, counting the items fetched.
+type countingIter struct {
+	items   []any
+	fetched int
+}
+
+func (c *countingIter) Next() bool {
+	if c.fetched == len(c.items) {
+		return false
+	}
+	c.fetched++
+	return true
+}
+
+func (c *countingIter) Elem() any {
+	return c.items[c.fetched-1]
+}
+
+type iterable struct {
+	it *countingIter
+}
+
+func (i iterable) Iter() (operator.Iterator, error) {
+	return i.it, nil
+}
+
+func attr(t *testing.T, l *LoopContext, name string) any {
+	t.Helper()
+	v, err := operator.GetAttr(l, name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestLoopContext(t *testing.T) {
+	l, err := NewLoopContext([]string{"a", "b", "c"}, ToConstructor(NewUndefined), nil, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]any
+	iterated, err := l.Run(func(item any) (LoopControl, error) {
+		cycle, err := operator.Call(attr(t, l, "cycle"), []any{"odd", "even"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, []any{item, attr(t, l, "index"), attr(t, l, "revindex0"), attr(t, l, "first"), attr(t, l, "last"), cycle})
+		return LoopNext, nil
+	})
+	if err != nil || !iterated {
+		t.Fatal("the loop should iterate", err)
+	}
+	expected := [][]any{
+		{"a", 1, 2, true, false, "odd"},
+		{"b", 2, 1, false, false, "even"},
+		{"c", 3, 0, false, true, "odd"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatal("expected", expected, "got", got)
+	}
+}
+
+func TestLoopContextBreak(t *testing.T) {
+	it := &countingIter{items: []any{1, 2, 3, 4, 5}}
+	l, err := NewLoopContext(iterable{it}, ToConstructor(NewUndefined), nil, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []any
+	_, err = l.Run(func(item any) (LoopControl, error) {
+		if item == 2 {
+			// `{% continue %}` ends the body early
+			return LoopNext, nil
+		}
+		seen = append(seen, item)
+		if l.Last() {
+			t.Fatal("the third item isn't the last one even if the loop breaks on it")
+		}
+		if item == 3 {
+			return LoopBreak, nil
+		}
+		return LoopNext, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(seen, []any{1, 3}) {
+		t.Fatal("unexpected items", seen)
+	}
+	// items are fetched lazily, only the one after the break was peeked at
+	if it.fetched != 4 {
+		t.Fatal("expected 4 items to be fetched, got", it.fetched)
+	}
+	if l.Length() != 5 || l.RevIndex() != 3 {
+		t.Fatal("unexpected length", l.Length(), l.RevIndex())
+	}
+}
+
+func TestLoopContextEmpty(t *testing.T) {
+	l, err := NewLoopContext([]int{}, nil, nil, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iterated, err := l.Run(func(item any) (LoopControl, error) {
+		t.Fatal("the body shouldn't be called")
+		return LoopNext, nil
+	})
+	if err != nil || iterated {
+		t.Fatal("the else block should be rendered for an empty loop")
+	}
+}
+
+func TestLoopContextItems(t *testing.T) {
+	l, err := NewLoopContext([]int{1, 1, 2}, ToConstructor(NewUndefined), nil, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changed []bool
+	_, _ = l.Run(func(item any) (LoopControl, error) {
+		if l.Index0() == 0 {
+			if _, ok := l.PrevItem().(BaseUndefined); !ok {
+				t.Fatal("previtem should be undefined on the first iteration")
+			}
+			if l.NextItem() != 1 {
+				t.Fatal("unexpected nextitem", l.NextItem())
+			}
+		}
+		if l.Index0() == 2 {
+			if l.PrevItem() != 1 {
+				t.Fatal("unexpected previtem", l.PrevItem())
+			}
+			if _, ok := l.NextItem().(BaseUndefined); !ok {
+				t.Fatal("nextitem should be undefined on the last iteration")
+			}
+		}
+		changed = append(changed, l.Changed(item))
+		return LoopNext, nil
+	})
+	if !reflect.DeepEqual(changed, []bool{true, false, true}) {
+		t.Fatal("unexpected changed results", changed)
+	}
+	if attr(t, l, "depth") != 2 {
+		t.Fatal("unexpected depth")
+	}
+	if _, err = operator.Call(l, []any{[]int{}}, nil); err == nil {
+		t.Fatal("a non recursive loop can't be called")
+	}
+
+	recursive, _ := NewLoopContext([]int{}, nil, func(iterable any) (any, error) {
+		return "rendered", nil
+	}, 0, nil)
+	if res, err := operator.Call(recursive, []any{[]int{1}}, nil); err != nil || res != "rendered" {
+		t.Fatal("unexpected recursive call result", res, err)
+	}
+}
+
+func TestLoopContextBudget(t *testing.T) {
+	budget := NewBudget(Limits{MaxLoopIterations: 4, MaxRecursionDepth: 3})
+	var items []any
+	body := func(item any) (LoopControl, error) {
+		items = append(items, item)
+		return LoopNext, nil
+	}
+	// the iterations of every loop of a render are summed
+	for _, loop := range [][]int{{1, 2}, {3, 4, 5}} {
+		l, err := NewLoopContext(loop, nil, nil, 0, budget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = l.Run(body)
+		if len(items) < 4 {
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expectLimit(t, err, "MaxLoopIterations")
+	}
+	if len(items) != 4 {
+		t.Fatal("the body shouldn't be called past the limit", items)
+	}
+
+	// {% for x in y recursive %}{{ loop(x) }}{% endfor %} with y = [[[[...]]]]
+	budget = NewBudget(Limits{MaxRecursionDepth: 3})
+	calls := 0
+	var render func(iterable any, depth0 int) (any, error)
+	render = func(iterable any, depth0 int) (any, error) {
+		calls++
+		l, err := NewLoopContext(iterable, nil, func(iterable any) (any, error) {
+			return render(iterable, depth0+1)
+		}, depth0, budget)
+		if err != nil {
+			return nil, err
+		}
+		_, err = l.Run(func(item any) (LoopControl, error) {
+			_, err := operator.Call(l, []any{item}, nil)
+			return LoopNext, err
+		})
+		return nil, err
+	}
+	nested := []any{}
+	for i := 0; i < 10; i++ {
+		nested = []any{nested}
+	}
+	_, err := render(nested, 0)
+	expectLimit(t, err, "MaxRecursionDepth")
+	if calls != 4 {
+		t.Fatal("expected the top loop and 3 recursive calls, got", calls)
+	}
+}
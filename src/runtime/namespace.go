@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/operator"
+	"golang.org/x/exp/maps"
+)
+
+// Namespace is a simple object whose attributes can be assigned from
+// templates with `{% set ns.attr = value %}`. Templates create them with
+// the `namespace` global.
+type Namespace struct {
+	attrs map[string]any
+}
+
+var _ operator.IGetAttribute = &Namespace{}
+var _ operator.ISetAttr = &Namespace{}
+
+// NewNamespace creates a namespace initialized like a Python dict would be
+// with the given arguments: args are maps whose items are copied, kwargs
+// are added after them.
+func NewNamespace(args []any, kwargs map[string]any) (*Namespace, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("namespace expected at most 1 argument, got %d", len(args))
+	}
+	attrs := make(map[string]any)
+	for _, arg := range args {
+		m, ok := arg.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("namespace argument must be a mapping, got %T", arg)
+		}
+		maps.Copy(attrs, m)
+	}
+	maps.Copy(attrs, kwargs)
+	return &Namespace{attrs}, nil
+}
+
+func (n *Namespace) GetAttribute(name string) (any, error) {
+	if v, ok := n.attrs[name]; ok {
+		return v, nil
+	}
+	return nil, operator.NotFound("namespace has no attribute '%s'", name)
+}
+
+func (n *Namespace) SetAttr(name string, value any) error {
+	n.attrs[name] = value
+	return nil
+}
+
+func (n *Namespace) Repr() string {
+	return fmt.Sprintf("<Namespace %v>", n.attrs)
+}
+
+// NamespaceClass is the `namespace` global, calling it creates a Namespace.
+type NamespaceClass struct{}
+
+func (NamespaceClass) Call(args []any, kwargs map[string]any) (any, error) {
+	return NewNamespace(args, kwargs)
+}
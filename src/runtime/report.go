@@ -0,0 +1,218 @@
+package runtime
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/utils"
+	"log"
+	"strings"
+	"sync"
+)
+
+// UndefinedAccess is a use of an undefined variable or attribute recorded by an UndefinedReport.
+type UndefinedAccess struct {
+	// Template is the name of the template being rendered, nil if it's unknown.
+	Template *string
+	Lineno   int
+	// Object is the type of the defined value the missing attribute was looked up
+	// on, it's empty if the first name of the path is undefined.
+	Object string
+	// Path is the expression that was undefined, like `user.address.city`.
+	// Lookups on undefined values extend the path of the undefined they come
+	// from, lookups on defined values start with the expression set by
+	// UndefinedReport.SetObject.
+	Path string
+}
+
+func (a UndefinedAccess) String() string {
+	var builder strings.Builder
+	if a.Template != nil {
+		builder.WriteString(*a.Template)
+	} else {
+		builder.WriteString("<template>")
+	}
+	_, _ = fmt.Fprintf(&builder, ":%d: %s is undefined", a.Lineno, a.Path)
+	if a.Object != "" {
+		_, _ = fmt.Fprintf(&builder, " (looked up on %s)", a.Object)
+	}
+	return builder.String()
+}
+
+// UndefinedReport collects the undefined values created during renders. It's
+// safe to use from multiple goroutines, but it has a single current location:
+// concurrent renders sharing a report credit their accesses to each other's
+// lines, they should use a report each.
+type UndefinedReport struct {
+	mu       sync.Mutex
+	template *string
+	lineno   int
+	object   string
+	accesses []*UndefinedAccess
+}
+
+func NewUndefinedReport() *UndefinedReport {
+	return &UndefinedReport{}
+}
+
+// SetLocation sets the template and the line that are being rendered, they are
+// recorded with the undefined values created and looked up from now on.
+func (r *UndefinedReport) SetLocation(template *string, lineno int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.template = template
+	r.lineno = lineno
+}
+
+// SetObject sets the expression of the object an attribute or an item is
+// looked up on next, like `author` in `{{ author.email }}`. If the lookup
+// creates an undefined value, it's recorded with the path `author.email`
+// rather than `email`. The expression is only used by the next undefined
+// value created for a defined object.
+func (r *UndefinedReport) SetObject(expr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.object = expr
+}
+
+// Accesses returns a copy of the recorded accesses, in the order they happened.
+func (r *UndefinedReport) Accesses() []UndefinedAccess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ret := make([]UndefinedAccess, 0, len(r.accesses))
+	for _, a := range r.accesses {
+		ret = append(ret, *a)
+	}
+	return ret
+}
+
+// Reset forgets the recorded accesses and the object expression.
+func (r *UndefinedReport) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accesses = nil
+	r.object = ""
+}
+
+func (r *UndefinedReport) String() string {
+	accesses := r.Accesses()
+	lines := make([]string, 0, len(accesses))
+	for _, a := range accesses {
+		lines = append(lines, a.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *UndefinedReport) record(object string, path string) *UndefinedAccess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if object != "" && r.object != "" {
+		path = r.object + "." + path
+		r.object = ""
+	}
+	a := &UndefinedAccess{Template: r.template, Lineno: r.lineno, Object: object, Path: path}
+	r.accesses = append(r.accesses, a)
+	return a
+}
+
+// extend records that the undefined value with the given path was looked up
+// further. The lookup replaces the access it comes from if it happens at the
+// same location and that access didn't already continue with another lookup,
+// otherwise it's recorded as a new access at the current location.
+func (r *UndefinedReport) extend(access *UndefinedAccess, from string, path string) *UndefinedAccess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if access.Path == from && access.Lineno == r.lineno && sameTemplate(access.Template, r.template) {
+		access.Path = path
+		return access
+	}
+	a := &UndefinedAccess{Template: r.template, Lineno: r.lineno, Object: access.Object, Path: path}
+	r.accesses = append(r.accesses, a)
+	return a
+}
+
+func sameTemplate(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// ReportingUndefined behaves like the default undefined (it renders as an
+// empty string), but records its path in an UndefinedReport. Lookups on it
+// don't fail, they return a reporting undefined with a longer path.
+type ReportingUndefined struct {
+	BaseUndefined
+	report *UndefinedReport
+	access *UndefinedAccess
+	path   string
+}
+
+var _ IUndefined = ReportingUndefined{}
+
+// MakeReportingUndefined returns an undefined constructor recording every
+// undefined name and attribute into report. Used as the `Undefined` of
+// `EnvOpts`, it collects the data a template expects but didn't get:
+//
+//	report := NewUndefinedReport()
+//	opts.Undefined = MakeReportingUndefined(report)
+//
+// The renderer tells the report the expression of the defined objects it
+// looks attributes up on with SetObject, so their missing attributes are
+// recorded with a full path.
+func MakeReportingUndefined(report *UndefinedReport) UndefinedConstructor {
+	return func(hint *string, obj any, name *string, exc func(msg string) error, logger *log.Logger) IUndefined {
+		path := "None"
+		if name != nil {
+			path = *name
+		}
+		base := NewUndefined(hint, obj, name, exc, logger)
+
+		if parent, ok := obj.(ReportingUndefined); ok {
+			return parent.child(base, parent.path+"."+path)
+		}
+		object := ""
+		if _, ok := obj.(utils.Missing); !ok {
+			object = utils.ObjectTypeRepr(obj)
+		}
+		access := report.record(object, path)
+		return ReportingUndefined{
+			BaseUndefined: base,
+			report:        report,
+			access:        access,
+			// the path starts with the expression of the object, if it's set
+			path: access.Path,
+		}
+	}
+}
+
+func (ru ReportingUndefined) child(base BaseUndefined, path string) ReportingUndefined {
+	return ReportingUndefined{
+		BaseUndefined: base,
+		report:        ru.report,
+		access:        ru.report.extend(ru.access, ru.path, path),
+		path:          path,
+	}
+}
+
+func (ru ReportingUndefined) lookup(name string, path string) ReportingUndefined {
+	base := NewUndefined(nil, ru, &name, ru.exc, ru.logger)
+	return ru.child(base, path)
+}
+
+func (ru ReportingUndefined) GetAttribute(name string) (any, error) {
+	return ru.lookup(name, ru.path+"."+name), nil
+}
+
+func (ru ReportingUndefined) GetItem(key any) (any, error) {
+	if s, ok := key.(string); ok {
+		return ru.lookup(s, fmt.Sprintf("%s['%s']", ru.path, s)), nil
+	}
+	return ru.lookup(fmt.Sprint(key), fmt.Sprintf("%s[%v]", ru.path, key)), nil
+}
+
+func (ru ReportingUndefined) Eq(a any) (any, error) {
+	return sameUndefined(ru, a), nil
+}
+
+func (ru ReportingUndefined) Ne(a any) (any, error) {
+	return !sameUndefined(ru, a), nil
+}
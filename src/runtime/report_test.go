@@ -0,0 +1,79 @@
+package runtime
+
+import (
+	"github.com/gojinja/gojinja/src/operator"
+	"github.com/gojinja/gojinja/src/utils"
+	"testing"
+)
+
+type user struct {
+	Name string
+}
+
+func TestReportingUndefined(t *testing.T) {
+	report := NewUndefinedReport()
+	undefined := MakeReportingUndefined(report)
+	tpl := "index.html"
+
+	// {{ user.address.city }} with user missing
+	report.SetLocation(&tpl, 2)
+	var v any = undefined(nil, utils.GetMissing(), strPtr("user"), nil, nil)
+	var err error
+	for _, attr := range []string{"address", "city"} {
+		if v, err = operator.GetAttr(v, attr, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s, err := v.(ReportingUndefined).String_(); err != nil || s != "" {
+		t.Fatal("reporting undefined should render as an empty string")
+	}
+
+	// {{ author.email }} with author defined
+	report.SetLocation(&tpl, 5)
+	report.SetObject("author")
+	u := undefined(nil, user{}, strPtr("email"), nil, nil)
+
+	// {{ u.phones[0] }} and {{ u.fax }}, reusing the same undefined
+	report.SetLocation(&tpl, 7)
+	phones, _ := operator.GetAttr(u, "phones", nil)
+	if _, err = operator.GetItem(phones, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = operator.GetAttr(u, "fax", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the object expression is only used once
+	report.SetLocation(&tpl, 8)
+	undefined(nil, user{}, strPtr("name"), nil, nil)
+
+	expected := []UndefinedAccess{
+		{Template: &tpl, Lineno: 2, Path: "user.address.city"},
+		{Template: &tpl, Lineno: 5, Object: "user object", Path: "author.email"},
+		{Template: &tpl, Lineno: 7, Object: "user object", Path: "author.email.phones[0]"},
+		{Template: &tpl, Lineno: 7, Object: "user object", Path: "author.email.fax"},
+		{Template: &tpl, Lineno: 8, Object: "user object", Path: "name"},
+	}
+	accesses := report.Accesses()
+	if len(accesses) != len(expected) {
+		t.Fatal("expected", expected, "got", accesses)
+	}
+	for i := range accesses {
+		if accesses[i] != expected[i] {
+			t.Fatal("expected", expected[i], "got", accesses[i])
+		}
+	}
+
+	if report.String() != `index.html:2: user.address.city is undefined
+index.html:5: author.email is undefined (looked up on user object)
+index.html:7: author.email.phones[0] is undefined (looked up on user object)
+index.html:7: author.email.fax is undefined (looked up on user object)
+index.html:8: name is undefined (looked up on user object)` {
+		t.Fatal("unexpected report", report.String())
+	}
+
+	report.Reset()
+	if len(report.Accesses()) != 0 {
+		t.Fatal("report should be empty after reset")
+	}
+}
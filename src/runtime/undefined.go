@@ -3,10 +3,12 @@ package runtime
 import (
 	"fmt"
 	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/operator"
 	"github.com/gojinja/gojinja/src/utils"
 	"log"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 type BaseUndefined struct {
@@ -40,6 +42,41 @@ var _ IUndefined = StrictUndefined{}
 var _ IUndefined = ChainableUndefined{}
 var _ IUndefined = DebugUndefined{}
 
+var _ operator.IIter = BaseUndefined{}
+var _ operator.ILen = StrictUndefined{}
+var _ operator.IGetAttribute = ChainableUndefined{}
+var _ operator.ICall = BaseUndefined{}
+
+// UndefinedConstructor creates the undefined object returned when a variable
+// or an attribute can't be found. Environments use it to create their undefined values.
+type UndefinedConstructor func(hint *string, obj any, name *string, exc func(msg string) error, logger *log.Logger) IUndefined
+
+// ToConstructor converts one of the NewXUndefined functions into an UndefinedConstructor.
+func ToConstructor[T IUndefined](newFn func(hint *string, obj any, name *string, exc func(msg string) error, logger *log.Logger) T) UndefinedConstructor {
+	return func(hint *string, obj any, name *string, exc func(msg string) error, logger *log.Logger) IUndefined {
+		return newFn(hint, obj, name, exc, logger)
+	}
+}
+
+// MakeLoggingUndefined returns an undefined constructor that creates
+// undefined objects of the base kind, logging to the given logger.
+// Warnings are logged when the undefined is printed, iterated or converted
+// to a bool, errors when using it fails.
+//
+//	logger := log.New(os.Stderr, "", log.LstdFlags)
+//	undefined := MakeLoggingUndefined(logger, ToConstructor(NewUndefined))
+func MakeLoggingUndefined(logger *log.Logger, base UndefinedConstructor) UndefinedConstructor {
+	if logger == nil {
+		logger = log.Default()
+	}
+	if base == nil {
+		base = ToConstructor(NewUndefined)
+	}
+	return func(hint *string, obj any, name *string, exc func(msg string) error, _ *log.Logger) IUndefined {
+		return base(hint, obj, name, exc, logger)
+	}
+}
+
 func NewUndefined(hint *string, obj any, name *string, exc func(msg string) error, logger *log.Logger) BaseUndefined {
 	if exc == nil {
 		exc = errors.TemplateError
@@ -55,8 +92,8 @@ func NewChainableUndefined(hint *string, obj any, name *string, exc func(msg str
 	return ChainableUndefined{NewUndefined(hint, obj, name, exc, logger)}
 }
 
-func NewDebugUndefined(hint *string, obj any, name *string, exc func(msg string) error, logger *log.Logger) StrictUndefined {
-	return StrictUndefined{NewUndefined(hint, obj, name, exc, logger)}
+func NewDebugUndefined(hint *string, obj any, name *string, exc func(msg string) error, logger *log.Logger) DebugUndefined {
+	return DebugUndefined{NewUndefined(hint, obj, name, exc, logger)}
 }
 
 func (u BaseUndefined) undefinedMessage() string {
@@ -64,6 +101,9 @@ func (u BaseUndefined) undefinedMessage() string {
 		return *u.hint
 	}
 	if _, ok := u.obj.(utils.Missing); ok {
+		if u.name == nil {
+			return "None is undefined"
+		}
 		return fmt.Sprintf("'%s' is undefined", *u.name)
 	}
 	// Following if is a rewrite of python code below. I don't undeestand neither the message nor the logic, as undefined_name ought to be Optional[string].
@@ -74,9 +114,9 @@ func (u BaseUndefined) undefinedMessage() string {
 	//f" element {self._undefined_name!r}"
 	//)
 	if u.name == nil {
-		return fmt.Sprintf("'%s' has no element 'None'", objectTypeRepr(u.obj))
+		return fmt.Sprintf("'%s' has no element 'None'", utils.ObjectTypeRepr(u.obj))
 	}
-	return fmt.Sprintf("'%s' has no attribute '%s'", objectTypeRepr(u.obj), *u.name)
+	return fmt.Sprintf("'%s' has no attribute '%s'", utils.ObjectTypeRepr(u.obj), *u.name)
 }
 
 func (u BaseUndefined) logMessage() {
@@ -88,7 +128,7 @@ func (u BaseUndefined) logMessage() {
 func (u BaseUndefined) failWithUndefinedError() error {
 	err := u.exc(u.undefinedMessage())
 	if u.logger != nil {
-		log.Printf("Template variable error: %v", err)
+		u.logger.Printf("Template variable error: %v", err)
 	}
 	return err
 }
@@ -141,13 +181,18 @@ func (u BaseUndefined) RMod(any) (any, error) {
 	return nil, u.failWithUndefinedError()
 }
 
+// sameUndefined tells if a is an undefined of the same kind as u, undefined
+// values are equal to each other if they are of the same kind.
+func sameUndefined(u IUndefined, a any) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(u)
+}
+
 func (u BaseUndefined) Eq(a any) (any, error) {
-	return reflect.TypeOf(a).Name() == reflect.TypeOf(u).Name(), nil
+	return sameUndefined(u, a), nil
 }
 
 func (u BaseUndefined) Ne(a any) (any, error) {
-	eq, err := u.Eq(a)
-	return !eq.(bool), err
+	return !sameUndefined(u, a), nil
 }
 
 func (u BaseUndefined) Lt(any) (any, error) {
@@ -200,11 +245,23 @@ func (u BaseUndefined) Len() (int, error) {
 	return 0, nil
 }
 
-func (u BaseUndefined) Iter() ([]any, error) {
-	return nil, nil
+func (u BaseUndefined) Iter() (operator.Iterator, error) {
+	u.logMessage()
+	return operator.Iter([]any(nil))
 }
 
-func (u BaseUndefined) Call(...any) (any, error) {
+func (u BaseUndefined) Contains(any) (bool, error) {
+	return false, nil
+}
+
+func (u BaseUndefined) GetAttribute(name string) (any, error) {
+	if strings.HasPrefix(name, "__") {
+		return nil, operator.NotFound("undefined has no attribute '%s'", name)
+	}
+	return nil, u.failWithUndefinedError()
+}
+
+func (u BaseUndefined) Call([]any, map[string]any) (any, error) {
 	return nil, u.failWithUndefinedError()
 }
 
@@ -239,11 +296,11 @@ func (su StrictUndefined) Bool() (bool, error) {
 	return false, su.failWithUndefinedError()
 }
 
-func (su StrictUndefined) Eq() (any, error) {
+func (su StrictUndefined) Eq(any) (any, error) {
 	return nil, su.failWithUndefinedError()
 }
 
-func (su StrictUndefined) Ne() (any, error) {
+func (su StrictUndefined) Ne(any) (any, error) {
 	return nil, su.failWithUndefinedError()
 }
 
@@ -251,11 +308,11 @@ func (su StrictUndefined) Hash() (int64, error) {
 	return 0, su.failWithUndefinedError()
 }
 
-func (su StrictUndefined) Len() (int64, error) {
+func (su StrictUndefined) Len() (int, error) {
 	return 0, su.failWithUndefinedError()
 }
 
-func (su StrictUndefined) Iter() ([]any, error) {
+func (su StrictUndefined) Iter() (operator.Iterator, error) {
 	return nil, su.failWithUndefinedError()
 }
 
@@ -263,10 +320,6 @@ func (su StrictUndefined) Contains(any) (bool, error) {
 	return false, su.failWithUndefinedError()
 }
 
-func objectTypeRepr(a any) string {
-	return reflect.TypeOf(a).Name()
-}
-
 func (du DebugUndefined) String_() (string, error) {
 	du.logMessage()
 	name := "None"
@@ -280,20 +333,36 @@ func (du DebugUndefined) String_() (string, error) {
 	} else if _, ok := du.obj.(utils.Missing); ok {
 		msg = name
 	} else {
-		msg = fmt.Sprintf("no such element: '%s' [%s]", objectTypeRepr(du.obj), name)
+		msg = fmt.Sprintf("no such element: %s['%s']", utils.ObjectTypeRepr(du.obj), name)
 	}
 
 	return fmt.Sprintf("{{ %s }}", msg), nil
 }
 
+func (du DebugUndefined) Eq(a any) (any, error) {
+	return sameUndefined(du, a), nil
+}
+
+func (du DebugUndefined) Ne(a any) (any, error) {
+	return !sameUndefined(du, a), nil
+}
+
 func (cu ChainableUndefined) HTML() (string, error) {
 	return cu.String_()
 }
 
-func (cu ChainableUndefined) GetAttr(string) (any, error) {
+func (cu ChainableUndefined) GetAttribute(string) (any, error) {
 	return cu, nil
 }
 
+func (cu ChainableUndefined) Eq(a any) (any, error) {
+	return sameUndefined(cu, a), nil
+}
+
+func (cu ChainableUndefined) Ne(a any) (any, error) {
+	return !sameUndefined(cu, a), nil
+}
+
 func (cu ChainableUndefined) GetItem(any) (any, error) {
 	return cu, nil
 }
@@ -0,0 +1,115 @@
+package runtime
+
+import (
+	"bytes"
+	"github.com/gojinja/gojinja/src/operator"
+	"github.com/gojinja/gojinja/src/utils"
+	"log"
+	"strings"
+	"testing"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestDebugUndefined(t *testing.T) {
+	cases := []struct {
+		u   DebugUndefined
+		res string
+	}{
+		{NewDebugUndefined(nil, utils.GetMissing(), strPtr("name"), nil, nil), "{{ name }}"},
+		{NewDebugUndefined(strPtr("no user"), nil, nil, nil, nil), "{{ undefined value printed: no user }}"},
+		{NewDebugUndefined(nil, map[string]int{}, strPtr("foo"), nil, nil), "{{ no such element: map[string]int object['foo'] }}"},
+	}
+	for _, c := range cases {
+		s, err := c.u.String_()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != c.res {
+			t.Fatal("expected", c.res, "got", s)
+		}
+	}
+}
+
+func TestChainableUndefined(t *testing.T) {
+	var v any = NewChainableUndefined(nil, utils.GetMissing(), strPtr("a"), nil, nil)
+	var err error
+	for _, attr := range []string{"b", "c", "__class__"} {
+		v, err = operator.GetAttr(v, attr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	v, err = operator.GetItem(v, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(ChainableUndefined); !ok {
+		t.Fatalf("expected a chainable undefined, got %T", v)
+	}
+	if eq, _ := operator.Eq(v, NewChainableUndefined(nil, nil, nil, nil, nil)); eq != true {
+		t.Fatal("chainable undefined values should be equal")
+	}
+}
+
+func TestUndefinedOperators(t *testing.T) {
+	u := NewUndefined(nil, utils.GetMissing(), strPtr("a"), nil, nil)
+	if _, err := operator.GetAttr(u, "b", nil); err == nil || err.Error() != "'a' is undefined" {
+		t.Fatal("expected an undefined error, got", err)
+	}
+	it, err := operator.Iter(u)
+	if err != nil || it.Next() {
+		t.Fatal("undefined should iterate as an empty sequence")
+	}
+	if l, err := operator.Len(u); err != nil || l != 0 {
+		t.Fatal("undefined should have no length")
+	}
+	if b, err := operator.Bool(u); err != nil || b {
+		t.Fatal("undefined should be false")
+	}
+	if in, err := operator.Contains(u, 1); err != nil || in {
+		t.Fatal("undefined shouldn't contain anything")
+	}
+	if eq, _ := operator.Eq(u, NewStrictUndefined(nil, nil, nil, nil, nil)); eq != false {
+		t.Fatal("undefined values of different kinds shouldn't be equal")
+	}
+
+	strict := NewStrictUndefined(nil, utils.GetMissing(), strPtr("a"), nil, nil)
+	if _, err := operator.Iter(strict); err == nil {
+		t.Fatal("strict undefined shouldn't be iterable")
+	}
+	if _, err := operator.Len(strict); err == nil {
+		t.Fatal("strict undefined shouldn't have a length")
+	}
+	if _, err := operator.Eq(strict, strict); err == nil {
+		t.Fatal("strict undefined shouldn't be comparable")
+	}
+}
+
+func TestMakeLoggingUndefined(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	constructor := MakeLoggingUndefined(logger, ToConstructor(NewStrictUndefined))
+
+	u := constructor(nil, utils.GetMissing(), strPtr("a"), nil, nil)
+	if _, ok := u.(StrictUndefined); !ok {
+		t.Fatalf("expected a strict undefined, got %T", u)
+	}
+	if _, err := operator.Add(u, 1); err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(buf.String(), "Template variable error: 'a' is undefined") {
+		t.Fatal("the error should be logged, got", buf.String())
+	}
+
+	buf.Reset()
+	u = MakeLoggingUndefined(logger, nil)(nil, utils.GetMissing(), strPtr("b"), nil, nil)
+	if _, err := u.(BaseUndefined).String_(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Template variable warning: 'b' is undefined\n" {
+		t.Fatal("the warning should be logged, got", buf.String())
+	}
+}
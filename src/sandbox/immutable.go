@@ -0,0 +1,117 @@
+package sandbox
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/operator"
+	"github.com/gojinja/gojinja/src/runtime"
+	"github.com/gojinja/gojinja/src/utils/set"
+	"reflect"
+	"strings"
+)
+
+// IMutatingAttributes is implemented by types with methods that modify the
+// value, immutable sandboxes don't allow accessing them.
+type IMutatingAttributes interface {
+	MutatingAttributes() []string
+}
+
+// sliceMutators are the names of the methods modifying sequences, for the
+// slice-like types exposing list methods.
+var sliceMutators = set.FrozenFromElems(
+	"append", "clear", "delete", "extend", "insert", "pop",
+	"push", "remove", "reverse", "set", "sort",
+)
+
+// mapMutators are the names of the methods modifying mappings, for the
+// map-like types exposing dict methods.
+var mapMutators = set.FrozenFromElems(
+	"clear", "delete", "pop", "popitem", "set", "setdefault", "update",
+)
+
+// ModifiesKnownMutable tells if accessing attr of obj gives a way to modify
+// obj. Methods of slice and map types and attributes of objects with dynamic
+// attributes are checked against the usual mutating method names (append,
+// pop, update, ...). Methods with a pointer receiver are considered
+// mutating, as well as the attributes listed by IMutatingAttributes.
+//
+//	ModifiesKnownMutable(map[string]any{}, "update") // true
+//	ModifiesKnownMutable(&user, "SetName")           // true, if SetName has a pointer receiver
+//	ModifiesKnownMutable("foo", "upper")             // false
+func ModifiesKnownMutable(obj any, attr string) bool {
+	if m, ok := obj.(IMutatingAttributes); ok {
+		for _, name := range m.MutatingAttributes() {
+			if name == attr {
+				return true
+			}
+		}
+	}
+	if obj == nil {
+		return false
+	}
+
+	name := strings.ToLower(attr)
+	switch obj.(type) {
+	case operator.IGetAttr, operator.IGetAttribute:
+		// attributes are dynamic, the name is all we know
+		if sliceMutators.Has(name) || mapMutators.Has(name) {
+			return true
+		}
+	}
+
+	t := reflect.TypeOf(obj)
+	kind := t.Kind()
+	if kind == reflect.Pointer {
+		kind = t.Elem().Kind()
+	}
+	switch kind {
+	case reflect.Slice, reflect.Array:
+		if sliceMutators.Has(name) {
+			return true
+		}
+	case reflect.Map:
+		if mapMutators.Has(name) {
+			return true
+		}
+	}
+
+	if t.Kind() == reflect.Pointer {
+		_, isPointerMethod := t.MethodByName(attr)
+		_, isValueMethod := t.Elem().MethodByName(attr)
+		return isPointerMethod && !isValueMethod
+	}
+	return false
+}
+
+// ImmutablePolicy works like Policy, but it doesn't allow modifying the
+// values passed to templates: mutating methods can't be accessed (see
+// ModifiesKnownMutable) and only namespaces (the objects the `namespace`
+// global creates) can have their attributes assigned.
+type ImmutablePolicy struct {
+	Policy
+}
+
+var _ environment.SandboxSetattrPolicy = ImmutablePolicy{}
+
+func (p ImmutablePolicy) IsSafeAttribute(obj any, attr string, value any) bool {
+	return p.Policy.IsSafeAttribute(obj, attr, value) && !ModifiesKnownMutable(obj, attr)
+}
+
+func (p ImmutablePolicy) IsSafeSetattr(obj any, _ string, _ any) bool {
+	_, ok := obj.(*runtime.Namespace)
+	return ok
+}
+
+// NewImmutable creates an immutable sandboxed environment, using
+// ImmutablePolicy unless opts has a sandbox policy.
+func NewImmutable(opts *environment.EnvOpts) (*environment.Environment, error) {
+	sandboxOpts := *opts
+	if sandboxOpts.Sandbox == nil {
+		sandboxOpts.Sandbox = ImmutablePolicy{}
+	}
+	env, err := environment.New(&sandboxOpts)
+	if err != nil {
+		return nil, err
+	}
+	interceptOperators(env)
+	return env, nil
+}
@@ -0,0 +1,127 @@
+package sandbox
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"testing"
+)
+
+type tags []string
+
+func (t tags) Len() int {
+	return len(t)
+}
+
+func (t *tags) Append(tag string) {
+	*t = append(*t, tag)
+}
+
+type dynamic struct{}
+
+func (dynamic) GetAttr(name string) (any, error) {
+	return func() {}, nil
+}
+
+type counter struct {
+	N int
+}
+
+func (c counter) Get() int {
+	return c.N
+}
+
+func (c *counter) Incr() {
+	c.N++
+}
+
+func (c *counter) MutatingAttributes() []string {
+	return []string{"Reset"}
+}
+
+type mutableCase struct {
+	obj      any
+	attr     string
+	mutating bool
+}
+
+func TestModifiesKnownMutable(t *testing.T) {
+	tagsV := tags{"a"}
+	cases := []mutableCase{
+		{[]int{1}, "append", true},
+		{[]int{1}, "index", false},
+		{map[string]int{}, "update", true},
+		{map[string]int{}, "Pop", true},
+		{map[string]int{}, "append", false},
+		{tagsV, "Len", false},
+		{&tagsV, "Append", true},
+		{&tagsV, "Len", false},
+		{dynamic{}, "pop", true},
+		{dynamic{}, "get", false},
+		{counter{}, "Get", false},
+		{&counter{}, "Get", false},
+		{&counter{}, "Incr", true},
+		{&counter{}, "Reset", true},
+		{"foo", "upper", false},
+		{nil, "append", false},
+	}
+	for _, c := range cases {
+		if ModifiesKnownMutable(c.obj, c.attr) != c.mutating {
+			t.Fatalf("%T.%s: expected %v", c.obj, c.attr, c.mutating)
+		}
+	}
+}
+
+func TestImmutable(t *testing.T) {
+	env, err := NewImmutable(environment.DefaultEnvOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &counter{N: 1}
+	if _, err := env.Getattr(c, "Incr"); !isSecurityError(err) {
+		t.Fatal("expected a security error, got", err)
+	}
+	if v, err := env.Getattr(c, "N"); err != nil || v != 1 {
+		t.Fatal("expected 1, got", v, err)
+	}
+	if _, err := env.Getitem(dynamic{}, "update"); !isSecurityError(err) {
+		t.Fatal("expected a security error, got", err)
+	}
+
+	ns, err := env.Call(env.Globals["namespace"], nil, map[string]any{"count": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = env.Setattr(ns, "count", 1); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := env.Getattr(ns, "count"); v != 1 {
+		t.Fatal("expected the namespace to be updated, got", v)
+	}
+	if err = env.Setattr(c, "N", 2); err == nil || isSecurityError(err) {
+		t.Fatal("expected a runtime error, got", err)
+	}
+	if err = env.Setattr(dynamicSetter{}, "x", 2); !isSecurityError(err) {
+		t.Fatal("expected a security error, got", err)
+	}
+
+	// the regular sandbox lets templates call mutating methods
+	sandboxed, err := New(environment.DefaultEnvOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	incr, err := sandboxed.Getattr(c, "Incr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sandboxed.Call(incr, nil, nil); err != nil || c.N != 2 {
+		t.Fatal("expected the counter to be incremented", err)
+	}
+	if err = sandboxed.Setattr(dynamicSetter{}, "x", 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type dynamicSetter struct{}
+
+func (dynamicSetter) SetAttr(string, any) error {
+	return nil
+}
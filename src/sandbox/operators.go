@@ -0,0 +1,54 @@
+package sandbox
+
+import (
+	"fmt"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/lexer"
+	"github.com/gojinja/gojinja/src/utils/numbers"
+	"math"
+	"math/cmplx"
+)
+
+// MaxExponent is the largest exponent the `**` operator accepts in the
+// environments created by New.
+const MaxExponent = 1000
+
+// Forbid returns a binary operator that always fails with a SecurityError,
+// it's used to disable an operator in an environment:
+//
+//	env.Binops[lexer.TokenPow] = sandbox.Forbid(lexer.TokenPow)
+func Forbid(op string) environment.BinaryOperator {
+	return func(any, any) (any, error) {
+		return nil, errors.TemplateSecurityError(fmt.Sprintf("the operator '%s' is not allowed", op))
+	}
+}
+
+// ClampPow wraps the pow operator to refuse numeric exponents whose absolute
+// value is bigger than maxExponent.
+func ClampPow(pow environment.BinaryOperator, maxExponent float64) environment.BinaryOperator {
+	return func(a any, b any) (any, error) {
+		if exp, ok := magnitude(b); ok && !(exp <= maxExponent) {
+			return nil, errors.TemplateSecurityError(fmt.Sprintf("exponent %v is too big, the maximum is %v", b, maxExponent))
+		}
+		return pow(a, b)
+	}
+}
+
+// magnitude returns the absolute value of a number.
+func magnitude(v any) (float64, bool) {
+	if i, ok := numbers.ToInt(v); ok {
+		return math.Abs(float64(i)), true
+	}
+	if f, ok := numbers.ToFloat(v); ok {
+		return math.Abs(f), true
+	}
+	if c, ok := numbers.ToComplex(v); ok {
+		return cmplx.Abs(c), true
+	}
+	return 0, false
+}
+
+func interceptOperators(env *environment.Environment) {
+	env.Binops[lexer.TokenPow] = ClampPow(env.Binops[lexer.TokenPow], MaxExponent)
+}
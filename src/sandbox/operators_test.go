@@ -0,0 +1,68 @@
+package sandbox
+
+import (
+	stderrors "errors"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/lexer"
+	"testing"
+)
+
+func TestClampPow(t *testing.T) {
+	env := newEnv(t)
+	cases := []struct {
+		a, b   any
+		secErr bool
+	}{
+		{2, 10, false},
+		{2., -3, false},
+		{2, MaxExponent, false},
+		{2, MaxExponent + 1, true},
+		{10, -1e9, true},
+		{2, complex(0, 5000), true},
+	}
+	for _, c := range cases {
+		_, err := env.CallBinop(lexer.TokenPow, c.a, c.b)
+		var secErr *errors.SecurityError
+		if stderrors.As(err, &secErr) != c.secErr {
+			t.Fatal("unexpected result for", c.a, "**", c.b, ":", err)
+		}
+	}
+	if res, err := env.CallBinop(lexer.TokenPow, 2, 10); err != nil || res != int64(1024) {
+		t.Fatal("expected 1024, got", res, err)
+	}
+}
+
+func TestInterceptOperators(t *testing.T) {
+	env := newEnv(t)
+	env.Binops[lexer.TokenPow] = Forbid(lexer.TokenPow)
+	env.Unops[lexer.TokenSub] = func(a any) (any, error) {
+		return "negated", nil
+	}
+
+	var secErr *errors.SecurityError
+	if _, err := env.CallBinop(lexer.TokenPow, 2, 2); !stderrors.As(err, &secErr) {
+		t.Fatal("expected a security error, got", err)
+	}
+	if res, err := env.CallUnop(lexer.TokenSub, 1); err != nil || res != "negated" {
+		t.Fatal("the overridden operator should be used, got", res, err)
+	}
+	if res, err := env.CallBinop(lexer.TokenAdd, 1, 2); err != nil || res != int64(3) {
+		t.Fatal("expected 3, got", res, err)
+	}
+	if res, err := env.CallUnop("not", 0); err != nil || res != true {
+		t.Fatal("expected true, got", res, err)
+	}
+	if _, err := env.CallBinop("and", 1, 2); err == nil {
+		t.Fatal("expected an unknown operator error")
+	}
+
+	// The operators of other environments aren't affected.
+	other, err := environment.New(environment.DefaultEnvOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := other.CallBinop(lexer.TokenPow, 2, MaxExponent+1); err != nil || res == nil {
+		t.Fatal("unsandboxed pow shouldn't be clamped, got", res, err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package sandbox provides sandboxed environments, for rendering templates
+// written by untrusted authors. A sandboxed environment checks every
+// attribute access and every call the templates do against a policy, and
+// fails with a SecurityError if it's unsafe.
+package sandbox
+
+import (
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/operator"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+// IUnsafe marks values that sandboxed templates must not call.
+type IUnsafe interface {
+	Unsafe()
+}
+
+// IUnsafeAttributes is implemented by types with fields or methods that
+// sandboxed templates must not access.
+type IUnsafeAttributes interface {
+	UnsafeAttributes() []string
+}
+
+// TagKey is the struct tag key used to mark fields: fields tagged with
+// `gojinja:"unsafe"` can't be accessed from sandboxed templates.
+const TagKey = "gojinja"
+
+type unsafeCallable struct {
+	fn any
+}
+
+func (unsafeCallable) Unsafe() {}
+
+func (u unsafeCallable) Call(args []any, kwargs map[string]any) (any, error) {
+	return operator.Call(u.fn, args, kwargs)
+}
+
+// Unsafe marks fn as unsafe: it can be called from regular templates, but not
+// from sandboxed ones.
+func Unsafe(fn any) any {
+	return unsafeCallable{fn}
+}
+
+var (
+	reflectValueType  = reflect.TypeOf(reflect.Value{})
+	reflectTypeType   = reflect.TypeOf((*reflect.Type)(nil)).Elem()
+	unsafePointerType = reflect.TypeOf(unsafe.Pointer(nil))
+)
+
+// isUnsafeType tells if values of the type give access to the internals of
+// the program.
+func isUnsafeType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		if t == reflectTypeType || t.Implements(reflectTypeType) {
+			return true
+		}
+		t = t.Elem()
+	}
+	if t == reflectValueType || t == unsafePointerType || t.Kind() == reflect.UnsafePointer || t.Kind() == reflect.Uintptr {
+		return true
+	}
+	return t.Kind() == reflect.Interface && t.Implements(reflectTypeType)
+}
+
+func isUnsafeValue(v any) bool {
+	if v == nil {
+		return false
+	}
+	if _, ok := v.(reflect.Type); ok {
+		return true
+	}
+	return isUnsafeType(reflect.TypeOf(v))
+}
+
+// returnsChannel tells if t is a function type returning a channel, calling
+// such a function could block the render forever.
+func returnsChannel(t reflect.Type) bool {
+	if t.Kind() != reflect.Func {
+		return false
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		if t.Out(i).Kind() == reflect.Chan {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy is the default sandbox policy.
+//
+// Attributes are unsafe if their name starts with an underscore, if they
+// are unexported or tagged `gojinja:"unsafe"` struct fields, if the object
+// lists them in UnsafeAttributes, or if the object or the value are
+// reflection or unsafe values. Callables are unsafe if they implement
+// IUnsafe, or if they are functions returning channels.
+type Policy struct{}
+
+var _ environment.SandboxPolicy = Policy{}
+
+func (p Policy) IsSafeAttribute(obj any, attr string, value any) bool {
+	if strings.HasPrefix(attr, "_") || isUnsafeValue(obj) || isUnsafeValue(value) {
+		return false
+	}
+	if u, ok := obj.(IUnsafeAttributes); ok {
+		for _, unsafeAttr := range u.UnsafeAttributes() {
+			if unsafeAttr == attr {
+				return false
+			}
+		}
+	}
+
+	t := reflect.TypeOf(obj)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Struct {
+		if field, ok := t.FieldByName(attr); ok {
+			if !field.IsExported() || field.Tag.Get(TagKey) == "unsafe" {
+				return false
+			}
+		}
+	}
+
+	if value != nil && returnsChannel(reflect.TypeOf(value)) {
+		return false
+	}
+	return true
+}
+
+func (p Policy) IsSafeCallable(obj any) bool {
+	if _, ok := obj.(IUnsafe); ok {
+		return false
+	}
+	if obj == nil {
+		return true
+	}
+	return !isUnsafeValue(obj) && !returnsChannel(reflect.TypeOf(obj))
+}
+
+// New creates a sandboxed environment. If opts doesn't have a sandbox
+// policy, the default Policy is used. The `**` operator of the environment
+// refuses exponents bigger than MaxExponent.
+func New(opts *environment.EnvOpts) (*environment.Environment, error) {
+	sandboxOpts := *opts
+	if sandboxOpts.Sandbox == nil {
+		sandboxOpts.Sandbox = Policy{}
+	}
+	env, err := environment.New(&sandboxOpts)
+	if err != nil {
+		return nil, err
+	}
+	interceptOperators(env)
+	return env, nil
+}
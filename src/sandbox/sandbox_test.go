@@ -0,0 +1,137 @@
+package sandbox
+
+import (
+	stderrors "errors"
+	"github.com/gojinja/gojinja/src/environment"
+	"github.com/gojinja/gojinja/src/errors"
+	"github.com/gojinja/gojinja/src/runtime"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+type account struct {
+	Name     string
+	Password string `gojinja:"unsafe"`
+	Type     reflect.Type
+	Ptr      unsafe.Pointer
+	balance  int
+}
+
+func (a *account) Greeting() string {
+	return "Hello " + a.Name
+}
+
+func (a *account) Delete() error {
+	return nil
+}
+
+func (a *account) Events() chan string {
+	return nil
+}
+
+func (a *account) UnsafeAttributes() []string {
+	return []string{"Delete"}
+}
+
+func newEnv(t *testing.T) *environment.Environment {
+	env, err := New(environment.DefaultEnvOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func isSecurityError(err error) bool {
+	var sErr *errors.SecurityError
+	return stderrors.As(err, &sErr)
+}
+
+func TestGetattr(t *testing.T) {
+	env := newEnv(t)
+	if !env.Sandboxed {
+		t.Fatal("environment should be sandboxed")
+	}
+	acc := &account{Name: "joe", Password: "secret", Type: reflect.TypeOf(0)}
+
+	v, err := env.Getattr(acc, "Name")
+	if err != nil || v != "joe" {
+		t.Fatal("expected the name, got", v, err)
+	}
+	greeting, err := env.Getattr(acc, "Greeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err = env.Call(greeting, nil, nil); err != nil || v != "Hello joe" {
+		t.Fatal("expected the greeting, got", v, err)
+	}
+
+	for _, attr := range []string{"Password", "Type", "Ptr", "Delete", "Events"} {
+		if _, err := env.Getattr(acc, attr); !isSecurityError(err) {
+			t.Fatal("expected a security error for", attr, "got", err)
+		}
+	}
+	if _, err := env.Getitem(acc, "Password"); !isSecurityError(err) {
+		t.Fatal("expected a security error, got", err)
+	}
+
+	// unexported fields aren't attributes at all
+	v, err = env.Getattr(acc, "balance")
+	if _, ok := v.(runtime.IUndefined); err != nil || !ok {
+		t.Fatal("expected an undefined, got", v, err)
+	}
+	if Policy.IsSafeAttribute(Policy{}, acc, "balance", 0) {
+		t.Fatal("unexported fields should be unsafe")
+	}
+}
+
+func TestCall(t *testing.T) {
+	env := newEnv(t)
+	add := func(a, b int) int { return a + b }
+
+	v, err := env.Call(add, []any{int64(1), int64(2)}, nil)
+	if err != nil || v != 3 {
+		t.Fatal("expected 3, got", v, err)
+	}
+	if _, err = env.Call(Unsafe(add), []any{1, 2}, nil); !isSecurityError(err) {
+		t.Fatal("expected a security error, got", err)
+	}
+	if _, err = env.Call(func() <-chan int { return nil }, nil, nil); !isSecurityError(err) {
+		t.Fatal("expected a security error, got", err)
+	}
+
+	// unsafe callables can still be used by regular environments
+	regular, err := environment.New(environment.DefaultEnvOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err = regular.Call(Unsafe(add), []any{1, 2}, nil); err != nil || v != 3 {
+		t.Fatal("expected 3, got", v, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	opts := environment.DefaultEnvOpts()
+	opts.Limits = runtime.Limits{MaxRangeSize: 100, MaxRepetition: 1000}
+	env, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var limitErr *errors.LimitError
+	_, err = env.Call(env.Globals["range"], []any{1 << 30}, nil)
+	if !stderrors.As(err, &limitErr) || limitErr.Limit != "MaxRangeSize" {
+		t.Fatal("expected the range size to be limited, got", err)
+	}
+	res, err := env.Call(env.Globals["range"], []any{3}, nil)
+	if err != nil || !reflect.DeepEqual(res, []int64{0, 1, 2}) {
+		t.Fatal("unexpected range", res, err)
+	}
+
+	if _, err = env.Mul("spam", 1<<30); !stderrors.As(err, &limitErr) || limitErr.Limit != "MaxRepetition" {
+		t.Fatal("expected the repetition to be limited, got", err)
+	}
+	if err.Error() != "template exceeded MaxRepetition (1000)" {
+		t.Fatal("unexpected message", err)
+	}
+}
@@ -0,0 +1,15 @@
+package utils
+
+import "reflect"
+
+// ObjectTypeRepr returns the name of the type of obj, for error messages.
+func ObjectTypeRepr(obj any) string {
+	if obj == nil {
+		return "None"
+	}
+	t := reflect.TypeOf(obj)
+	if t.Name() != "" {
+		return t.Name() + " object"
+	}
+	return t.String() + " object"
+}